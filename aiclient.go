@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// newAIClient returns the HTTP client AI requests share. One client (and so
+// one connection pool) lives as long as the watcher, so frequent polls reuse a
+// kept-alive connection rather than paying a TCP and TLS handshake each time.
+// The pool keeps an idle connection per request AIConcurrency lets run at
+// once.
+func newAIClient(cfg Config) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = cfg.AIConcurrency
+	t.IdleConnTimeout = cfg.AIIdleConnTimeout
+	t.DisableKeepAlives = cfg.AIIdleConnTimeout == 0
+	return &http.Client{Timeout: cfg.AITimeout, Transport: t}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countDials makes client's transport count the connections it opens.
+func countDials(client *http.Client) *atomic.Int32 {
+	var dials atomic.Int32
+	t := client.Transport.(*http.Transport)
+	dial := t.DialContext
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return dial(ctx, network, addr)
+	}
+	return &dials
+}
+
+func TestAIClientReused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"stockPrice": 4521.25}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	dials := countDials(w.aiClient)
+	for range 3 {
+		if res, err := w.checkOnce(context.Background()); err != nil || res.StockPrice != 4521.25 {
+			t.Fatalf("price %v, err %v; want 4521.25", res.StockPrice, err)
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("%d connections for 3 AI calls, want the first one reused", n)
+	}
+
+	cfg.AIIdleConnTimeout = 0 // keep-alive off
+	client := newAIClient(cfg)
+	dials = countDials(client)
+	for range 3 {
+		if _, err := getStockPriceFromAIBytes(context.Background(), client, []byte("png"), nil, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := dials.Load(); n != 3 {
+		t.Errorf("%d connections for 3 AI calls with keep-alive off, want 3", n)
+	}
+}
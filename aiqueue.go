@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"image"
+	"net/url"
+	"sync"
+)
+
+// aiFrameHashDivisor is how far a frame is downscaled before hashing it for
+// aiQueue; with each channel also cut to 4 bits, frames that differ only by
+// encoder noise or a flickering pixel hash the same.
+const aiFrameHashDivisor = 8
+
+// aiQueue sits in front of the AI endpoint. At most its capacity of requests
+// run at once (AIConcurrency), the rest wait their turn, and a request for a
+// frame that is already queued or in flight, with the same hints, waits for
+// that one's answer instead of being sent again.
+//
+// checkOnce scans several displays at once, so their requests meet here. A
+// frame shown on two displays (a mirrored screen, the same Bookmap window
+// captured twice) may still reach the queue only once the first display's
+// request is done, so the queue also keeps the poll's successful answers
+// until endPoll. They aren't kept any longer: the key is coarse enough that a
+// new price in the bubble may not change it, and the next poll has to ask
+// again.
+type aiQueue struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	pending map[uint64]*aiCall
+	answers map[uint64]float64 // this poll's successful answers, see endPoll
+}
+
+// aiCall is one request, shared by every caller with the same key.
+type aiCall struct {
+	done  chan struct{} // closed once price and err are set
+	price float64
+	err   error
+}
+
+func newAIQueue(concurrency int) *aiQueue {
+	return &aiQueue{slots: make(chan struct{}, max(concurrency, 1)), pending: map[uint64]*aiCall{}, answers: map[uint64]float64{}}
+}
+
+// do returns fn's result, running fn once a slot is free unless a call with
+// the same key is already pending, or succeeded earlier this poll, whose
+// result is returned instead. It gives up waiting when ctx is cancelled.
+func (q *aiQueue) do(ctx context.Context, key uint64, fn func() (float64, error)) (float64, error) {
+	q.mu.Lock()
+	if price, ok := q.answers[key]; ok {
+		q.mu.Unlock()
+		metrics.aiRequestsDeduped.Add(1)
+		return price, nil
+	}
+	if c, ok := q.pending[key]; ok {
+		q.mu.Unlock()
+		metrics.aiRequestsDeduped.Add(1)
+		select {
+		case <-c.done:
+			return c.price, c.err
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	c := &aiCall{done: make(chan struct{})}
+	q.pending[key] = c
+	q.mu.Unlock()
+
+	metrics.aiQueueDepth.Add(1)
+	defer metrics.aiQueueDepth.Add(-1)
+	defer func() {
+		q.mu.Lock()
+		delete(q.pending, key)
+		if c.err == nil {
+			q.answers[key] = c.price
+		}
+		q.mu.Unlock()
+		close(c.done)
+	}()
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return 0, c.err
+	}
+	defer func() { <-q.slots }()
+	c.price, c.err = fn()
+	return c.price, c.err
+}
+
+// endPoll forgets the poll's answers.
+func (q *aiQueue) endPoll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	clear(q.answers)
+}
+
+// aiRequestKey identifies an AI request for deduplication: a hash of img
+// downscaled by aiFrameHashDivisor, with colors quantized, plus the hints
+// sent with it.
+func aiRequestKey(img image.Image, hints url.Values) uint64 {
+	h := fnv.New64a()
+	small := downscale(img, aiFrameHashDivisor)
+	h.Write([]byte(small.Rect.Size().String()))
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		h.Write([]byte{small.Pix[i] >> 4, small.Pix[i+1] >> 4, small.Pix[i+2] >> 4})
+	}
+	h.Write([]byte(hints.Encode()))
+	return h.Sum64()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"image"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAIQueueConcurrency(t *testing.T) {
+	q := newAIQueue(2)
+	var running, peak atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.do(context.Background(), uint64(i), func() (float64, error) {
+				n := running.Add(1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+				return 0, nil
+			})
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d, want 2", p)
+	}
+	if d := metrics.aiQueueDepth.Load(); d != 0 {
+		t.Errorf("queue depth = %d after all requests finished, want 0", d)
+	}
+}
+
+func TestAIQueueDedup(t *testing.T) {
+	q := newAIQueue(1)
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int64
+	fn := func() (float64, error) {
+		calls.Add(1)
+		close(started)
+		<-release
+		return 4521.25, nil
+	}
+
+	deduped := metrics.aiRequestsDeduped.Load()
+	first := make(chan float64)
+	go func() {
+		p, _ := q.do(context.Background(), 42, fn)
+		first <- p
+	}()
+	<-started
+
+	second := make(chan float64)
+	go func() {
+		p, _ := q.do(context.Background(), 42, fn)
+		second <- p
+	}()
+	for metrics.aiRequestsDeduped.Load() == deduped {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	if p1, p2 := <-first, <-second; p1 != 4521.25 || p2 != 4521.25 {
+		t.Errorf("prices = %v, %v; want both callers to get 4521.25", p1, p2)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want once", n)
+	}
+}
+
+func TestAIRequestKey(t *testing.T) {
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+	noisy := newFixture(150, image.Rect(330, 145, 350, 155))
+	noisy.Pix[0]++ // one channel off by one, as a lossy re-capture might be
+
+	if aiRequestKey(img, nil) != aiRequestKey(noisy, nil) {
+		t.Error("near-identical frames hash differently")
+	}
+	if aiRequestKey(img, nil) == aiRequestKey(newFixture(80, image.Rectangle{}), nil) {
+		t.Error("different frames hash the same")
+	}
+	if aiRequestKey(img, nil) == aiRequestKey(img, url.Values{"lineY": {"150"}}) {
+		t.Error("the hints don't change the key")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gen2brain/beeep"
+)
+
+// Alert kinds.
+const (
+	alertBubble    = "bubble"     // a price bubble reached a line
+	alertCrossing  = "crossing"   // a vertical line crossed a horizontal one
+	alertSummary   = "summary"    // several alerts batched into one, see AlertBatchWindow
+	alertLineMoved = "line_moved" // the strongest line jumped more than LineMoveThreshold between polls
+)
+
+// AlertEvent is one alert decided by checkOnce.
+type AlertEvent struct {
+	Kind         string
+	Display      int // index of the display the line is on
+	LineY        int
+	LineX        int // crossing alerts only
+	PrevLineY    int // line-moved alerts only: where the line was the poll before
+	Color        string
+	Price        float64       // NaN when unknown
+	BrightPixels int           // bubble alerts only
+	Sustained    time.Duration // bubble alerts only: how long the bubble has been at the line
+	Confidence   float64       // the line's Confidence; 0 for summaries
+	Escalation   int           // AlertEscalation level reached, set by triggerAlert; 0 none
+	Time         time.Time
+	Batch        []AlertEvent // summary alerts only: the alerts it stands for
+}
+
+// alertsInFlight tracks alert goroutines so shutdown (and -once) can let them
+// finish instead of cutting a notification off mid-way.
+var alertsInFlight sync.WaitGroup
+
+// alertDeliveries counts the alert goroutines started by dispatchAlerts that
+// haven't finished yet.
+var alertDeliveries alertLimiter
+
+// dispatchAlerts fires each event on its own goroutine, tracked by
+// alertsInFlight. Alerts already dispatched are not cut short when ctx is
+// cancelled. At most cfg.MaxConcurrentAlerts run at once; when that many are
+// still busy (a hung webhook, an alert storm) further events are dropped
+// rather than piling up goroutines and connections. While alerts are paused
+// (see alertsPaused) the events are only logged.
+func dispatchAlerts(ctx context.Context, events []AlertEvent, notifiers []Notifier, cfg Config) {
+	ctx = context.WithoutCancel(ctx)
+	for _, ev := range events {
+		if alertsPaused.Load() {
+			slog.Info("alerts paused, not sending", alertAttrs(ev)...)
+			continue
+		}
+		if !alertDeliveries.tryAcquire(cfg.MaxConcurrentAlerts) {
+			metrics.alertsDropped.Add(1)
+			slog.Warn("too many alerts still being delivered, dropping this one",
+				append(alertAttrs(ev), "limit", cfg.MaxConcurrentAlerts)...)
+			continue
+		}
+		alertsInFlight.Add(1)
+		go func() {
+			defer alertsInFlight.Done()
+			defer alertDeliveries.release()
+			triggerAlert(ctx, ev, notifiers, cfg)
+		}()
+	}
+}
+
+// alertLimiter is a counting semaphore whose limit is given per call, so a
+// reloaded config takes effect at once.
+type alertLimiter struct {
+	mu   sync.Mutex
+	busy int
+}
+
+// tryAcquire takes a slot if fewer than limit are taken; limit 0 means
+// unlimited.
+func (l *alertLimiter) tryAcquire(limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit > 0 && l.busy >= limit {
+		return false
+	}
+	l.busy++
+	return true
+}
+
+func (l *alertLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.busy--
+}
+
+// triggerAlert records ev in recentAlerts and alertLog and notifies about it,
+// or with AlertBatchWindow set queues it for the next batch summary. It sets
+// ev.Escalation from how long the condition has been sustained. The notifiers
+// are those AlertRules picks for ev (see ruleNotifiers); during quiet hours
+// only the QuietHoursNotifiers among them hear about it. A batch goes out
+// to every notifier any of its alerts would have gone to.
+func triggerAlert(ctx context.Context, ev AlertEvent, notifiers []Notifier, cfg Config) {
+	ev.Escalation = cfg.escalationLevel(ev.Sustained)
+	metrics.alertsFired.Add(1)
+	recentAlerts.add(ev)
+	alertLog.write(ev)
+	if cfg.inQuietHours(ev.Time) {
+		slog.Info("quiet hours, alert only sent to QuietHoursNotifiers", "kind", ev.Kind,
+			"display", ev.Display, "lineY", ev.LineY, "notifiers", cfg.QuietHoursNotifiers)
+	}
+	if cfg.AlertBatchWindow > 0 {
+		alertBatch.add(ctx, ev, notifiers, cfg)
+		return
+	}
+	notifyAll(ctx, ev, alertNotifiers(ev, notifiers, cfg), cfg)
+}
+
+// alertNotifiers returns the notifiers ev goes to: those AlertRules picks,
+// narrowed to the QuietHoursNotifiers during quiet hours.
+func alertNotifiers(ev AlertEvent, notifiers []Notifier, cfg Config) []Notifier {
+	notifiers = ruleNotifiers(ev, notifiers, cfg)
+	if cfg.inQuietHours(ev.Time) {
+		notifiers = quietNotifiers(notifiers, cfg)
+	}
+	return notifiers
+}
+
+// notifyAll hands ev to every notifier at once, so a slow webhook can't hold
+// up the desktop notification, and waits for them all. In dry-run mode it
+// only logs what it would have done.
+func notifyAll(ctx context.Context, ev AlertEvent, notifiers []Notifier, cfg Config) {
+	if cfg.DryRun {
+		slog.Info("DRY RUN ALERT", alertAttrs(ev)...)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.Notify(ctx, ev); err != nil {
+				log.Println("alert error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// alertAttrs returns the slog attributes describing ev.
+func alertAttrs(ev AlertEvent) []any {
+	_, msg := alertText(ev)
+	attrs := []any{"event", eventAlert, "kind", ev.Kind, "message", msg,
+		"display", ev.Display, "color", ev.Color, "lineY", ev.LineY, priceAttr(ev.Price)}
+	switch ev.Kind {
+	case alertBubble:
+		attrs = append(attrs, "brightPixels", ev.BrightPixels, "sustained", ev.Sustained, "escalation", ev.Escalation)
+	case alertCrossing:
+		attrs = append(attrs, "lineX", ev.LineX)
+	case alertLineMoved:
+		attrs = append(attrs, "prevLineY", ev.PrevLineY)
+	case alertSummary:
+		attrs = append(attrs, "count", len(ev.Batch))
+	}
+	return attrs
+}
+
+// playSound plays n.SoundFile with the platform's player (see playSoundFile),
+// or the synthesized beep if no file is set or playback fails. An escalated
+// alert always beeps, with its AlertEscalation step's tone. It blocks until
+// the sound is done; it runs on the alert goroutine. Only a failed beep is an
+// error; a bad sound file just falls back.
+func (n BeepNotifier) playSound(ev AlertEvent) error {
+	freq, ms := n.FreqHz, n.DurationMs
+	if ev.Escalation > 0 && ev.Escalation <= len(n.Escalation) {
+		step := n.Escalation[ev.Escalation-1]
+		freq, ms = step.FreqHz, step.DurationMs
+	} else if n.SoundFile != "" {
+		err := playSoundFile(n.SoundFile)
+		if err == nil {
+			return nil
+		}
+		log.Println("sound file error, falling back to beep:", err)
+	}
+	if err := beeep.Beep(freq, ms); err != nil {
+		return fmt.Errorf("beep: %w", err)
+	}
+	return nil
+}
+
+// alertTemplates renders notification text from NotifyTitleTemplate and
+// NotifyBodyTemplate. A nil template keeps alertText's wording.
+type alertTemplates struct {
+	title, body *template.Template
+}
+
+// parseAlertTemplates parses cfg's notification templates, so a bad one is
+// reported at startup rather than on the first alert.
+func parseAlertTemplates(cfg Config) (alertTemplates, error) {
+	var t alertTemplates
+	for _, tmpl := range []struct {
+		name, text string
+		dst        **template.Template
+	}{
+		{"NotifyTitleTemplate", cfg.NotifyTitleTemplate, &t.title},
+		{"NotifyBodyTemplate", cfg.NotifyBodyTemplate, &t.body},
+	} {
+		if tmpl.text == "" {
+			continue
+		}
+		parsed, err := template.New(tmpl.name).Option("missingkey=error").Parse(tmpl.text)
+		if err != nil {
+			return alertTemplates{}, fmt.Errorf("%s: %w", tmpl.name, err)
+		}
+		*tmpl.dst = parsed
+	}
+	return t, nil
+}
+
+// render returns the title and body for ev, executing the templates against
+// the AlertEvent (so {{.Color}}, {{.LineY}}, {{printf "%.2f" .Price}}; Price
+// is NaN when unknown). A template that fails to execute falls back to the
+// built-in text.
+func (t alertTemplates) render(ev AlertEvent) (title, msg string) {
+	title, msg = alertText(ev)
+	exec := func(tmpl *template.Template, fallback string) string {
+		if tmpl == nil {
+			return fallback
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, ev); err != nil {
+			log.Println("notification template error:", err)
+			return fallback
+		}
+		return b.String()
+	}
+	return exec(t.title, title), exec(t.body, msg)
+}
+
+// alertText returns the notification title and body for ev.
+func alertText(ev AlertEvent) (title, msg string) {
+	havePrice := !math.IsNaN(ev.Price)
+
+	switch ev.Kind {
+	case alertSummary:
+		parts := make([]string, len(ev.Batch))
+		for i, b := range ev.Batch {
+			parts[i] = b.Color + " line Y=" + strconv.Itoa(b.LineY)
+			if !math.IsNaN(b.Price) {
+				parts[i] += fmt.Sprintf(" at $%.2f", b.Price)
+			}
+		}
+		return fmt.Sprintf("Bookmap: %d alerts", len(ev.Batch)), strings.Join(parts, "; ")
+	case alertCrossing:
+		msg = "Vertical line (X=" + strconv.Itoa(ev.LineX) + ") crossed " + ev.Color + " line (Y=" + strconv.Itoa(ev.LineY) + ")"
+		if havePrice {
+			msg += fmt.Sprintf(" at $%.2f", ev.Price)
+		}
+		return "Bookmap alert", msg
+	case alertLineMoved:
+		msg = fmt.Sprintf("%s line moved from Y=%d to Y=%d", ev.Color, ev.PrevLineY, ev.LineY)
+		if havePrice {
+			msg += fmt.Sprintf(" at $%.2f", ev.Price)
+		}
+		return "Bookmap: " + ev.Color + " line moved", msg
+	default:
+		if havePrice {
+			return fmt.Sprintf("Bookmap: $%.2f at %s line", ev.Price, ev.Color),
+				fmt.Sprintf("Price $%.2f reached %s line (Y=%d)", ev.Price, ev.Color, ev.LineY)
+		}
+		return "Bookmap: " + ev.Color + " line hit",
+			"Price bubble reached " + ev.Color + " line (Y=" + strconv.Itoa(ev.LineY) + ")"
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps every event it is handed.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []AlertEvent
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, ev)
+	return nil
+}
+
+func TestTriggerAlertFansOut(t *testing.T) {
+	a, b := &recordingNotifier{}, &recordingNotifier{}
+	ev := AlertEvent{Kind: alertBubble, LineY: 120, Color: "red", Price: 4521.25, Time: time.Now()}
+
+	cfg := testConfig()
+	triggerAlert(context.Background(), ev, []Notifier{a, b}, cfg)
+	if len(a.events) != 1 || len(b.events) != 1 || a.events[0].LineY != 120 {
+		t.Errorf("notifiers got %v and %v, want the event once each", a.events, b.events)
+	}
+
+	cfg.DryRun = true
+	triggerAlert(context.Background(), ev, []Notifier{a}, cfg)
+	if len(a.events) != 1 {
+		t.Errorf("dry run reached the notifier")
+	}
+}
+
+// blockingNotifier holds every delivery until release is closed.
+type blockingNotifier struct {
+	recordingNotifier
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	<-n.release
+	return n.recordingNotifier.Notify(ctx, ev)
+}
+
+func TestDispatchAlertsLimit(t *testing.T) {
+	n := &blockingNotifier{release: make(chan struct{})}
+	cfg := testConfig()
+	cfg.MaxConcurrentAlerts = 2
+	events := make([]AlertEvent, 5)
+	dropped := metrics.alertsDropped.Load()
+
+	dispatchAlerts(context.Background(), events, []Notifier{n}, cfg)
+	close(n.release)
+	alertsInFlight.Wait()
+
+	if len(n.events) != 2 {
+		t.Errorf("%d alerts delivered, want the 2 that fit the limit", len(n.events))
+	}
+	if got := metrics.alertsDropped.Load() - dropped; got != 3 {
+		t.Errorf("%d alerts dropped, want 3", got)
+	}
+	if !alertDeliveries.tryAcquire(1) {
+		t.Error("slots weren't released after delivery")
+	}
+	alertDeliveries.release()
+}
+
+func TestNewNotifiers(t *testing.T) {
+	cfg := testConfig()
+	cfg.Notifiers = []string{notifierWebhook, notifierLog}
+
+	ns, err := newNotifiers(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns) != 1 {
+		t.Errorf("got %d notifiers, want only log while AlertWebhookURL is empty", len(ns))
+	}
+
+	cfg.AlertWebhookURL = "http://example.invalid/hook"
+	if ns, _ = newNotifiers(cfg); len(ns) != 2 {
+		t.Errorf("got %d notifiers, want webhook and log", len(ns))
+	}
+
+	cfg.Notifiers = []string{"slack"}
+	if _, err := newNotifiers(cfg); err == nil {
+		t.Error("unknown notifier accepted")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n := WebhookNotifier{URL: srv.URL}
+	ev := AlertEvent{Kind: alertBubble, LineY: 120, Color: "red", Price: math.NaN(), Time: time.Now()}
+	if err := n.Notify(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if got["lineY"] != 120.0 || got["color"] != "red" || got["price"] != nil {
+		t.Errorf("payload = %v", got)
+	}
+}
+
+func TestFailureTracker(t *testing.T) {
+	tr := &failureTracker{limit: 3}
+	fail := errString("no GUI session")
+
+	tr.record(fail)
+	tr.record(nil) // a success in between starts the count over
+	if tr.record(fail) || tr.record(fail) || tr.disabled() {
+		t.Fatal("tripped before 3 consecutive failures")
+	}
+	if !tr.record(fail) || !tr.disabled() {
+		t.Fatal("didn't trip on the 3rd consecutive failure")
+	}
+	if tr.record(fail) {
+		t.Error("reported tripping twice")
+	}
+
+	tr.reset()
+	if tr.disabled() {
+		t.Error("still disabled after reset")
+	}
+
+	var never *failureTracker
+	if never.record(fail) || never.disabled() {
+		t.Error("nil tracker tripped")
+	}
+}
+
+func TestAlertTemplates(t *testing.T) {
+	cfg := testConfig()
+	cfg.NotifyTitleTemplate = `{{.Color}} line @ ${{printf "%.2f" .Price}} (y={{.LineY}})`
+	tmpl, err := parseAlertTemplates(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := AlertEvent{Kind: alertBubble, LineY: 150, Color: "red", Price: 4521.25}
+	title, msg := tmpl.render(ev)
+	if title != "red line @ $4521.25 (y=150)" {
+		t.Errorf("title = %q", title)
+	}
+	if _, want := alertText(ev); msg != want {
+		t.Errorf("body = %q, want the built-in %q", msg, want)
+	}
+
+	cfg.NotifyBodyTemplate = "{{.Colour}}"
+	if tmpl, err = parseAlertTemplates(cfg); err != nil {
+		t.Fatal(err) // field names are only checked on execution
+	}
+	if _, msg := tmpl.render(ev); msg != "Price $4521.25 reached red line (Y=150)" {
+		t.Errorf("body = %q, want the built-in text when the template fails", msg)
+	}
+
+	cfg.NotifyBodyTemplate = "{{.Color"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted an unparseable template")
+	}
+	if _, err := newNotifiers(cfg); err == nil {
+		t.Error("newNotifiers accepted an unparseable template")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Overlay colors for annotated frames, picked to stand out against a dark
+// chart with red lines.
+var (
+	annotateROIColor    = color.RGBA{255, 255, 0, 255} // yellow
+	annotateLineColor   = color.RGBA{0, 255, 255, 255} // cyan
+	annotateSearchColor = color.RGBA{80, 140, 255, 255}
+	annotateBlobColor   = color.RGBA{0, 255, 0, 255}
+)
+
+// annotateFrame returns a copy of img with the detection overlaid: the ROI, a
+// marker across it at line.Y, the bubble search region and the bright blob
+// found in it. line.Y < 0 means no line; only the ROI is drawn then.
+// Coordinates are in img's pixels.
+func annotateFrame(img image.Image, roi image.Rectangle, line Line, cfg Config) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Rect, img, img.Bounds().Min, draw.Src)
+
+	strokeRect(out, roi, annotateROIColor)
+	if line.Y < 0 {
+		return out
+	}
+
+	fillRect(out, image.Rect(roi.Min.X, line.Y-1, roi.Max.X, line.Y+2), annotateLineColor)
+	region := bubbleRegion(roi, line, cfg)
+	strokeRect(out, region, annotateSearchColor)
+	if n, blob := brightBlob(img, region, cfg.withBubbleThreshold(img, roi, region)); n > 0 {
+		strokeRect(out, blob.Inset(-2), annotateBlobColor)
+	}
+	return out
+}
+
+// strokeRect draws a 1px outline just inside r.
+func strokeRect(dst *image.RGBA, r image.Rectangle, c color.Color) {
+	fillRect(dst, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), c)
+	fillRect(dst, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), c)
+	fillRect(dst, image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), c)
+	fillRect(dst, image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), c)
+}
+
+func fillRect(dst *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(dst, r.Intersect(dst.Rect), &image.Uniform{c}, image.Point{}, draw.Src)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// alertLogHeader is the first row of a new AlertLogPath file.
+var alertLogHeader = []string{"time", "kind", "display", "color", "lineY", "price", "escalation", "message"}
+
+// alertLog is the AlertLogPath audit trail, nil when that isn't set. Unlike
+// recentAlerts it lives on disk, so it outlasts restarts.
+var alertLog *alertCSV
+
+// alertCSV appends one CSV row per alert fired. Rows are buffered and written
+// out once resultsFlushInterval has passed since the last flush, and on
+// Close.
+type alertCSV struct {
+	mu        sync.Mutex
+	f         *os.File
+	w         *csv.Writer
+	lastFlush time.Time
+}
+
+// openAlertLog opens path for appending, writing the header row first if the
+// file is new or empty.
+func openAlertLog(path string) (*alertCSV, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alert log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open alert log: %w", err)
+	}
+	l := &alertCSV{f: f, w: csv.NewWriter(f), lastFlush: time.Now()}
+	if info.Size() == 0 {
+		if err := l.w.Write(alertLogHeader); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write alert log header: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// write appends ev. A nil log does nothing. It is called from the alert
+// goroutines, so it locks.
+func (l *alertCSV) write(ev AlertEvent) {
+	if l == nil {
+		return
+	}
+	_, msg := alertText(ev)
+	price := ""
+	if !math.IsNaN(ev.Price) {
+		price = strconv.FormatFloat(ev.Price, 'f', -1, 64)
+	}
+	row := []string{ev.Time.Format(time.RFC3339Nano), ev.Kind, strconv.Itoa(ev.Display), ev.Color,
+		strconv.Itoa(ev.LineY), price, strconv.Itoa(ev.Escalation), msg}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.w.Write(row); err != nil {
+		log.Println("alert log error:", err)
+		return
+	}
+	if time.Since(l.lastFlush) >= resultsFlushInterval {
+		l.lastFlush = time.Now()
+		if err := l.flushLocked(); err != nil {
+			log.Println("alert log error:", err)
+		}
+	}
+}
+
+func (l *alertCSV) flushLocked() error {
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		return fmt.Errorf("failed to flush alert log: %w", err)
+	}
+	return nil
+}
+
+// Close flushes anything buffered and closes the file.
+func (l *alertCSV) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.flushLocked(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAlertLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.csv")
+	at := time.Date(2026, 3, 9, 14, 30, 0, 0, time.UTC)
+	cfg := testConfig()
+	cfg.Notifiers = nil
+
+	// two runs: the second appends without repeating the header
+	for _, ev := range []AlertEvent{
+		{Kind: alertBubble, Display: 1, Color: "red", LineY: 120, Price: 4521.25, Time: at},
+		{Kind: alertLineMoved, Color: "blue", LineY: 80, PrevLineY: 140, Price: math.NaN(), Time: at.Add(time.Minute)},
+	} {
+		var err error
+		if alertLog, err = openAlertLog(path); err != nil {
+			t.Fatal(err)
+		}
+		triggerAlert(context.Background(), ev, nil, cfg)
+		if err := alertLog.Close(); err != nil {
+			t.Fatal(err)
+		}
+		alertLog = nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		alertLogHeader,
+		{"2026-03-09T14:30:00Z", alertBubble, "1", "red", "120", "4521.25", "0", "Price $4521.25 reached red line (Y=120)"},
+		{"2026-03-09T14:31:00Z", alertLineMoved, "0", "blue", "80", "", "0", "blue line moved from Y=140 to Y=80"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %q, want %q", rows, want)
+	}
+	for i := range want {
+		if !slices.Equal(rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
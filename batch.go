@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// alertBatcher coalesces alerts that arrive within AlertBatchWindow of the
+// first one into a single summary notification, so several lines triggering
+// at once don't produce a burst of notifications.
+type alertBatcher struct {
+	mu        sync.Mutex
+	pending   []AlertEvent
+	notifiers []Notifier // all of them, as passed to the add that opened the batch
+}
+
+// alertBatch is the batcher used by triggerAlert.
+var alertBatch alertBatcher
+
+// add queues ev. The first alert of a batch arms a timer that flushes the
+// batch after cfg.AlertBatchWindow, routing it only then (see
+// batchNotifiers); it counts as in flight until then, so
+// shutdown waits for the summary to go out. The summary's delivery takes an
+// alertDeliveries slot like any dispatched alert, and is dropped when
+// cfg.MaxConcurrentAlerts are still busy.
+func (b *alertBatcher) add(ctx context.Context, ev AlertEvent, notifiers []Notifier, cfg Config) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, ev)
+	if len(b.pending) > 1 {
+		return
+	}
+	b.notifiers = notifiers
+
+	alertsInFlight.Add(1)
+	time.AfterFunc(cfg.AlertBatchWindow, func() {
+		defer alertsInFlight.Done()
+		ev, notifiers := b.flush(cfg)
+		if !alertDeliveries.tryAcquire(cfg.MaxConcurrentAlerts) {
+			metrics.alertsDropped.Add(1)
+			slog.Warn("too many alerts still being delivered, dropping this one",
+				append(alertAttrs(ev), "limit", cfg.MaxConcurrentAlerts)...)
+			return
+		}
+		defer alertDeliveries.release()
+		notifyAll(ctx, ev, notifiers, cfg)
+	})
+}
+
+// flush empties the batch and returns what to notify, the alert itself if it
+// was alone, otherwise a summary of all of them, and whom to notify.
+func (b *alertBatcher) flush(cfg Config) (AlertEvent, []Notifier) {
+	b.mu.Lock()
+	events, notifiers := b.pending, b.notifiers
+	b.pending, b.notifiers = nil, nil
+	b.mu.Unlock()
+
+	notifiers = batchNotifiers(events, notifiers, cfg)
+	if len(events) == 1 {
+		return events[0], notifiers
+	}
+	return summarizeAlerts(events), notifiers
+}
+
+// batchNotifiers returns, in their configured order, the notifiers at least
+// one of events goes to (see alertNotifiers). Routing the summary by the
+// alert that opened the batch would let a rule that tells no one, say for
+// crossings, swallow the bubble alerts batched behind it.
+func batchNotifiers(events []AlertEvent, notifiers []Notifier, cfg Config) []Notifier {
+	var out []Notifier
+	for _, n := range notifiers {
+		for _, ev := range events {
+			if len(alertNotifiers(ev, []Notifier{n}, cfg)) > 0 {
+				out = append(out, n)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// summarizeAlerts builds the summary alert for a batch. Its line, color and
+// price are the first alert's, its time the latest one's (alert times come
+// from the watcher's Clock); Batch has them all.
+func summarizeAlerts(events []AlertEvent) AlertEvent {
+	first := events[0]
+	latest := first.Time
+	for _, ev := range events[1:] {
+		if ev.Time.After(latest) {
+			latest = ev.Time
+		}
+	}
+	return AlertEvent{
+		Kind: alertSummary, Display: first.Display, LineY: first.LineY, Color: first.Color,
+		Price: first.Price, Time: latest, Batch: events,
+	}
+}
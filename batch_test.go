@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertBatching(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertBatchWindow = 20 * time.Millisecond
+	rec := &recordingNotifier{}
+	t0 := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	dispatchAlerts(context.Background(), []AlertEvent{
+		{Kind: alertBubble, LineY: 120, Color: "red", Price: 4521.25, Time: t0},
+		{Kind: alertBubble, LineY: 80, Color: "blue", Price: 4519.5, Time: t0},
+		{Kind: alertCrossing, LineY: 200, Color: "red", Price: 4530, Time: t0.Add(time.Second)},
+	}, []Notifier{rec}, cfg)
+	alertsInFlight.Wait()
+
+	if len(rec.events) != 1 {
+		t.Fatalf("got %d notifications, want one summary", len(rec.events))
+	}
+	sum := rec.events[0]
+	if sum.Kind != alertSummary || len(sum.Batch) != 3 {
+		t.Fatalf("notification = %+v, want a summary of 3 alerts", sum)
+	}
+	if !sum.Time.Equal(t0.Add(time.Second)) {
+		t.Errorf("summary time = %v, want the latest alert's, %v", sum.Time, t0.Add(time.Second))
+	}
+	_, msg := alertText(sum)
+	for _, want := range []string{"Y=120 at $4521.25", "Y=80 at $4519.50", "Y=200 at $4530.00"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("summary %q doesn't mention %q", msg, want)
+		}
+	}
+
+	// a lone alert goes out as itself
+	dispatchAlerts(context.Background(), []AlertEvent{{Kind: alertBubble, LineY: 50, Color: "red"}}, []Notifier{rec}, cfg)
+	alertsInFlight.Wait()
+	if len(rec.events) != 2 || rec.events[1].Kind != alertBubble {
+		t.Errorf("lone alert delivered as %+v", rec.events[len(rec.events)-1])
+	}
+}
+
+func TestAlertBatchRespectsMaxConcurrentAlerts(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertBatchWindow = 20 * time.Millisecond
+	cfg.MaxConcurrentAlerts = 1
+	rec := &recordingNotifier{}
+
+	// the summary is due while another delivery holds the only slot
+	triggerAlert(context.Background(), AlertEvent{Kind: alertBubble, LineY: 120, Color: "red"}, []Notifier{rec}, cfg)
+	if !alertDeliveries.tryAcquire(cfg.MaxConcurrentAlerts) {
+		t.Fatal("no free delivery slot before the batch is flushed")
+	}
+	dropped := metrics.alertsDropped.Load()
+	alertsInFlight.Wait()
+	alertDeliveries.release()
+
+	if len(rec.events) != 0 {
+		t.Errorf("got %d notifications over MaxConcurrentAlerts, want none", len(rec.events))
+	}
+	if n := metrics.alertsDropped.Load() - dropped; n != 1 {
+		t.Errorf("alertsDropped went up by %d, want 1", n)
+	}
+}
+
+func TestBatchNotifiers(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertRules = []alertRule{
+		{ruleFaint, []string{notifierLog}},
+		{alertCrossing, nil},
+		{alertBubble, []string{notifierBeep, notifierLog}},
+	}
+	beep, webhook, logn := BeepNotifier{}, WebhookNotifier{URL: "http://example.invalid"}, LogNotifier{}
+	all := []Notifier{beep, webhook, logn}
+	crossing := AlertEvent{Kind: alertCrossing, Confidence: 3}
+	faint := AlertEvent{Kind: alertBubble, Confidence: 1.2}
+	bubble := AlertEvent{Kind: alertBubble, Confidence: 3}
+
+	tests := []struct {
+		name   string
+		events []AlertEvent
+		want   []Notifier
+	}{
+		{"crossing alone", []AlertEvent{crossing}, nil},
+		{"crossing opens the batch", []AlertEvent{crossing, bubble}, []Notifier{beep, logn}},
+		{"faint opens the batch", []AlertEvent{faint, bubble}, []Notifier{beep, logn}},
+		{"faint alone", []AlertEvent{faint}, []Notifier{logn}},
+	}
+	for _, tt := range tests {
+		if got := batchNotifiers(tt.events, all, cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: notifiers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// end to end: a batch opened by an alert that tells no one still goes out
+	cfg.AlertRules = []alertRule{{alertCrossing, nil}}
+	cfg.AlertBatchWindow = 20 * time.Millisecond
+	rec := &recordingNotifier{}
+	triggerAlert(context.Background(), AlertEvent{Kind: alertCrossing, LineY: 200}, []Notifier{rec}, cfg)
+	triggerAlert(context.Background(), AlertEvent{Kind: alertBubble, LineY: 120}, []Notifier{rec}, cfg)
+	alertsInFlight.Wait()
+	if len(rec.events) != 1 || len(rec.events[0].Batch) != 2 {
+		t.Errorf("got %+v, want one summary of both alerts", rec.events)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+)
+
+// blinkFrames keeps each display's previous bubble band for
+// DetectBlinkingBubble. Bookmap's urgent alerts blink, and a poll that lands
+// on the "off" phase would otherwise see no bubble at all.
+type blinkFrames struct {
+	prev map[int]*image.RGBA // per display, last poll's band as captured
+}
+
+func newBlinkFrames() *blinkFrames {
+	return &blinkFrames{prev: map[int]*image.RGBA{}}
+}
+
+// merge returns a copy of img's roi for the bubble search in which every
+// pixel of the bubble band is the more bubble-like (brighter, or darker with
+// BubblePolarity "dark") of this frame's and the previous frame's. That ORs
+// the two frames' bubble masks, so a bubble lit in either still counts. The
+// band remembered for next time is this frame's own, so a bubble that has
+// gone for good drops out after one poll.
+func (b *blinkFrames) merge(display int, img image.Image, roi image.Rectangle, cfg Config) image.Image {
+	band := blinkBand(roi, cfg)
+	out := image.NewRGBA(roi)
+	draw.Draw(out, roi, img, roi.Min, draw.Src)
+	cur := image.NewRGBA(band)
+	draw.Draw(cur, band, out, band.Min, draw.Src)
+
+	// a resized capture or ROI leaves nothing to compare against
+	if prev, ok := b.prev[display]; ok && prev.Rect == band {
+		dark := cfg.BubblePolarity == bubblePolarityDark
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			o, p := pixRow(out, band, y), pixRow(prev, band, y)
+			for i := 0; i < len(o); i += 4 {
+				so := int(o[i]) + int(o[i+1]) + int(o[i+2])
+				sp := int(p[i]) + int(p[i+1]) + int(p[i+2])
+				if sp > so && !dark || sp < so && dark {
+					copy(o[i:i+4], p[i:i+4])
+				}
+			}
+		}
+	}
+	b.prev[display] = cur
+	return out
+}
+
+// blinkBand is the part of roi any bubbleRegion can fall in: the
+// bubbleSearchColumns band at full ROI height, or with BubbleAtLineEnd, where
+// lines can end anywhere, the whole ROI.
+func blinkBand(roi image.Rectangle, cfg Config) image.Rectangle {
+	if cfg.BubbleAtLineEnd {
+		return roi
+	}
+	xStart, xEnd := bubbleSearchColumns(roi, cfg)
+	return image.Rect(xStart, roi.Min.Y, xEnd, roi.Max.Y).Intersect(roi)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestDetectBlinkingBubble(t *testing.T) {
+	on := newFixture(150, image.Rect(330, 145, 350, 155))
+	off := newFixture(150, image.Rectangle{})
+
+	detected := func(cfg Config) []bool {
+		w := newTestWatcher(cfg, nil)
+		poll := 0
+		w.capture = func(int) (image.Image, error) {
+			poll++
+			if poll%2 == 1 {
+				return on, nil
+			}
+			return off, nil
+		}
+		var got []bool
+		for range 4 {
+			res, err := w.checkOnce(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, res.BubbleDetected)
+		}
+		return got
+	}
+
+	cfg := testConfig()
+	if got := detected(cfg); got[1] || got[3] {
+		t.Errorf("single-frame check: BubbleDetected = %v, want the dark frames missed", got)
+	}
+	cfg.DetectBlinkingBubble = true
+	for i, ok := range detected(cfg) {
+		if !ok {
+			t.Errorf("poll %d: blinking bubble not detected", i+1)
+		}
+	}
+}
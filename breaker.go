@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errAICircuitOpen is the AI step's error while aiBreaker is holding calls
+// back.
+const errAICircuitOpen = errString("AI circuit open, call skipped")
+
+// AI circuit states, as reported by the bookmap_ai_circuit_state gauge.
+const (
+	circuitClosed   = 0
+	circuitOpen     = 1
+	circuitHalfOpen = 2 // one probe in flight
+)
+
+// aiBreaker stops calling an AI endpoint that keeps failing, so a dead
+// backend doesn't cost every poll a full timeout. After threshold
+// consecutive failures it opens for cooldown, then lets a single probe
+// through: success closes it again, failure opens it for another cooldown.
+// threshold 0 disables it.
+type aiBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newAIBreaker(threshold int, cooldown time.Duration) *aiBreaker {
+	metrics.aiCircuitState.Store(circuitClosed)
+	return &aiBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether to call the AI at now. A true while open makes the
+// caller the probe, which must report back through record.
+func (b *aiBreaker) allow(now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || now.Before(b.openUntil) {
+		metrics.aiCallsShortCircuited.Add(1)
+		return false
+	}
+	b.probing = true
+	metrics.aiCircuitState.Store(circuitHalfOpen)
+	slog.Info("AI circuit half-open, sending a probe", "failures", b.failures)
+	return true
+}
+
+// record counts the outcome, at now, of a call allow let through.
+func (b *aiBreaker) record(err error, now time.Time) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := b.failures >= b.threshold
+	b.probing = false
+	if err == nil {
+		if wasOpen {
+			slog.Info("AI circuit closed, the endpoint is answering again", "failures", b.failures)
+		}
+		b.failures = 0
+		metrics.aiCircuitState.Store(circuitClosed)
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+		metrics.aiCircuitState.Store(circuitOpen)
+		slog.Warn("AI circuit open, skipping AI calls", "failures", b.failures, "cooldown", b.cooldown, "error", err)
+	}
+}
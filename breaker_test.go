@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAIBreaker(t *testing.T) {
+	b := newAIBreaker(2, 20*time.Second)
+	clock := newFakeClock()
+	for i := range 2 {
+		if !b.allow(clock.Now()) {
+			t.Fatalf("call %d held back before the threshold", i)
+		}
+		b.record(errString("connection refused"), clock.Now())
+	}
+	if b.allow(clock.Now()) {
+		t.Fatal("the circuit didn't open after 2 failures")
+	}
+	if s := metrics.aiCircuitState.Load(); s != circuitOpen {
+		t.Errorf("state gauge = %d, want open (%d)", s, circuitOpen)
+	}
+
+	clock.Advance(20*time.Second - time.Nanosecond)
+	if b.allow(clock.Now()) {
+		t.Fatal("a probe went out before the cooldown was over")
+	}
+	clock.Advance(time.Nanosecond)
+	if !b.allow(clock.Now()) {
+		t.Fatal("no probe after the cooldown")
+	}
+	if b.allow(clock.Now()) {
+		t.Error("a second call went through while the probe was in flight")
+	}
+	b.record(errString("connection refused"), clock.Now())
+	if b.allow(clock.Now()) {
+		t.Fatal("a failed probe didn't reopen the circuit")
+	}
+
+	clock.Advance(20 * time.Second)
+	if !b.allow(clock.Now()) {
+		t.Fatal("no probe after the second cooldown")
+	}
+	b.record(nil, clock.Now())
+	if !b.allow(clock.Now()) || metrics.aiCircuitState.Load() != circuitClosed {
+		t.Error("a successful probe didn't close the circuit")
+	}
+}
+
+func TestCheckOnceAICircuit(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"stockPrice": 101}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AIMaxRetries = 0
+	cfg.AIBreakerFailures = 2
+	cfg.AIBreakerCooldown = 20 * time.Second
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	clock := newFakeClock()
+	w.clock = clock
+
+	skipped := metrics.aiCallsShortCircuited.Load()
+	for range 4 {
+		w.checkOnce(context.Background()) // the AI error, or errAICircuitOpen
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("AI called %d times, want 2 before the circuit opened", n)
+	}
+	if n := metrics.aiCallsShortCircuited.Load() - skipped; n != 2 {
+		t.Errorf("%d calls short-circuited, want 2", n)
+	}
+
+	healthy.Store(true)
+	clock.Advance(20 * time.Second)
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StockPrice != 101 {
+		t.Errorf("price after the probe = %v, want 101", res.StockPrice)
+	}
+}
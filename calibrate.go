@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+)
+
+// calibrationFactor is the share of an observed value suggested as its
+// threshold: low enough to tolerate a slightly weaker line or smaller bubble,
+// high enough to stay well clear of noise.
+const calibrationFactor = 0.7
+
+// calibration is what -calibrate observed in one frame, and the thresholds it
+// suggests from that.
+type calibration struct {
+	ROI             image.Rectangle
+	LineFound       bool
+	LineColor       string
+	LineY           int
+	MaxRowPixels    int // matching pixels in the strongest row
+	MaxRunLength    int // longest contiguous run in any row
+	MaxBubblePixels int // bright pixels in the bubble region at LineY
+
+	SuggestedMinRedPixelsPerRow    int
+	SuggestedMinRedRunLength       int
+	SuggestedBubbleMinBrightPixels int
+}
+
+// calibrate measures img the way detection would see it, ignoring the
+// current thresholds.
+func calibrate(img image.Image, cfg Config) (calibration, error) {
+	roi, err := cfg.detectionROI(img.Bounds())
+	if err != nil {
+		return calibration{}, err
+	}
+
+	c := calibration{ROI: roi}
+	lineEnd, rows := 0, cfg.lineScanRows(roi)
+	for _, p := range cfg.lineProfiles() {
+		for i, st := range lineRowStats(img, rows, p, cfg) {
+			if st.count > c.MaxRowPixels {
+				c.MaxRowPixels, c.LineY, c.LineColor, c.LineFound = st.count, rows.Min.Y+i, p.Name, true
+				lineEnd = st.last
+			}
+			c.MaxRunLength = max(c.MaxRunLength, st.runLen)
+		}
+	}
+	if c.LineFound {
+		region := bubbleRegion(roi, Line{Y: c.LineY, EndX: lineEnd}, cfg)
+		c.MaxBubblePixels, _ = brightBlob(img, region, cfg.withBubbleThreshold(img, roi, region))
+	}
+
+	suggest := func(v int) int { return int(float64(v) * calibrationFactor) }
+	c.SuggestedMinRedPixelsPerRow = suggest(c.MaxRowPixels)
+	c.SuggestedMinRedRunLength = suggest(c.MaxRunLength)
+	c.SuggestedBubbleMinBrightPixels = suggest(c.MaxBubblePixels)
+	return c, nil
+}
+
+// writeText prints the calibration for a person, with the suggestions as
+// environment variables ready to paste.
+func (c calibration) writeText(out io.Writer) {
+	fmt.Fprintf(out, "ROI: %v\n", c.ROI)
+	if !c.LineFound {
+		fmt.Fprintln(out, "No line-colored pixels found in the ROI; is the chart visible and are the line colors right?")
+		return
+	}
+	fmt.Fprintf(out, "Strongest row: %s at Y=%d with %d matching pixels; longest run in any row: %d\n",
+		c.LineColor, c.LineY, c.MaxRowPixels, c.MaxRunLength)
+	fmt.Fprintf(out, "Bubble region at that row: %d bright pixels\n", c.MaxBubblePixels)
+	fmt.Fprintf(out, "\nSuggested thresholds (%.0f%% of observed):\n", calibrationFactor*100)
+	fmt.Fprintf(out, "  WATCHER_MIN_RED_PIXELS=%d\n", c.SuggestedMinRedPixelsPerRow)
+	fmt.Fprintf(out, "  WATCHER_MIN_RED_RUN_LENGTH=%d\n", c.SuggestedMinRedRunLength)
+	fmt.Fprintf(out, "  WATCHER_BUBBLE_MIN_BRIGHT_PIXELS=%d\n", c.SuggestedBubbleMinBrightPixels)
+	if c.MaxBubblePixels == 0 {
+		fmt.Fprintln(out, "  (no bubble at the line right now; calibrate again while one is showing)")
+	}
+}
+
+// calibrationJSON is the -calibrate -json output. The suggestions are keyed
+// by environment variable, so a script can write them straight into a
+// -config file.
+type calibrationJSON struct {
+	ROI             string         `json:"roi"` // "x0,y0,x1,y1", as WATCHER_ROI_RECT takes it
+	LineFound       bool           `json:"lineFound"`
+	LineColor       string         `json:"lineColor,omitempty"`
+	LineY           *int           `json:"lineY"` // null without a line
+	MaxRedPerRow    int            `json:"maxRedPerRow"`
+	MaxRunLength    int            `json:"maxRunLength"`
+	MaxBubbleBright int            `json:"maxBubbleBright"`
+	Factor          float64        `json:"factor"` // calibrationFactor
+	Suggested       map[string]int `json:"suggested,omitempty"`
+}
+
+// writeJSON prints the calibration as one JSON object. Like writeText it
+// suggests nothing when no line was found.
+func (c calibration) writeJSON(out io.Writer) error {
+	r := c.ROI
+	j := calibrationJSON{
+		ROI:       fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y),
+		LineFound: c.LineFound, LineColor: c.LineColor,
+		MaxRedPerRow: c.MaxRowPixels, MaxRunLength: c.MaxRunLength, MaxBubbleBright: c.MaxBubblePixels,
+		Factor: calibrationFactor,
+	}
+	if c.LineFound {
+		j.LineY = &c.LineY
+		j.Suggested = map[string]int{
+			"WATCHER_MIN_RED_PIXELS":     c.SuggestedMinRedPixelsPerRow,
+			"WATCHER_MIN_RED_RUN_LENGTH": c.SuggestedMinRedRunLength,
+		}
+		if c.MaxBubblePixels > 0 {
+			j.Suggested["WATCHER_BUBBLE_MIN_BRIGHT_PIXELS"] = c.SuggestedBubbleMinBrightPixels
+		}
+	}
+	return json.NewEncoder(out).Encode(j)
+}
+
+// runCalibrate captures one frame from the first configured display and
+// prints its calibration, as JSON if asJSON is set. It returns the process
+// exit code.
+func (w *Watcher) runCalibrate(out io.Writer, asJSON bool) int {
+	img, err := w.capture(w.cfg.displays()[0])
+	if err != nil {
+		fmt.Fprintln(out, "capture failed:", err)
+		return 2
+	}
+	c, err := calibrate(img, w.cfg)
+	if err != nil {
+		fmt.Fprintln(out, "calibration failed:", err)
+		return 2
+	}
+	if asJSON {
+		if err := c.writeJSON(out); err != nil {
+			fmt.Fprintln(out, "failed to write calibration:", err)
+			return 2
+		}
+		return 0
+	}
+	c.writeText(out)
+	return 0
+}
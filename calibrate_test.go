@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestCalibrate(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(150, image.Rect(330, 145, 350, 155)) // the bubble covers 20 of the line's 320 ROI pixels
+
+	c, err := calibrate(img, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.LineFound || c.LineY != 150 || c.MaxRowPixels != 300 || c.MaxRunLength != 290 || c.MaxBubblePixels != 200 {
+		t.Errorf("calibration = %+v, want line at 150 with 300 px (run 290) and a 200 px bubble", c)
+	}
+	if c.SuggestedMinRedPixelsPerRow != 210 || c.SuggestedBubbleMinBrightPixels != 140 {
+		t.Errorf("suggestions = %d / %d, want 210 / 140", c.SuggestedMinRedPixelsPerRow, c.SuggestedBubbleMinBrightPixels)
+	}
+
+	var out bytes.Buffer
+	c.writeText(&out)
+	if !strings.Contains(out.String(), "WATCHER_MIN_RED_PIXELS=210") {
+		t.Errorf("output doesn't suggest the pixel threshold:\n%s", out.String())
+	}
+}
+
+func TestCalibrateJSON(t *testing.T) {
+	w := newTestWatcher(testConfig(), newFixture(150, image.Rect(330, 145, 350, 155)))
+	var out bytes.Buffer
+	if code := w.runCalibrate(&out, true); code != 0 {
+		t.Fatalf("exit code %d: %s", code, out.String())
+	}
+
+	var got calibrationJSON
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, out.String())
+	}
+	if got.ROI != "40,30,360,270" || got.LineY == nil || *got.LineY != 150 || got.MaxRedPerRow != 300 || got.MaxBubbleBright != 200 {
+		t.Errorf("calibration = %+v, want the line at 150 (300 px) and a 200 px bubble in 40,30,360,270", got)
+	}
+	want := map[string]int{"WATCHER_MIN_RED_PIXELS": 210, "WATCHER_MIN_RED_RUN_LENGTH": 203, "WATCHER_BUBBLE_MIN_BRIGHT_PIXELS": 140}
+	if !maps.Equal(got.Suggested, want) {
+		t.Errorf("suggested = %v, want %v", got.Suggested, want)
+	}
+
+	out.Reset()
+	newTestWatcher(testConfig(), newFixture(-1, image.Rectangle{})).runCalibrate(&out, true)
+	if !strings.Contains(out.String(), `"lineY":null`) || strings.Contains(out.String(), "suggested") {
+		t.Errorf("no line: output %s, want a null lineY and no suggestions", out.String())
+	}
+}
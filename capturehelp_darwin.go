@@ -0,0 +1,9 @@
+package main
+
+// captureHelp is printed when the startup self-check can't capture anything.
+// Without Screen Recording permission macOS either refuses the capture or
+// hands back a blank frame, and says nothing about why.
+const captureHelp = `macOS needs Screen Recording permission to capture the screen:
+  1. open System Settings > Privacy & Security > Screen Recording
+  2. turn on the app running the watcher (Terminal, iTerm, your IDE, or the binary itself)
+  3. quit and restart that app; the permission only applies to new processes`
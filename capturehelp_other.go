@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package main
+
+// captureHelp is printed when the startup self-check can't capture anything.
+const captureHelp = `check that a desktop session is running and unlocked, that the display is
+awake, and that this process may capture the screen (e.g. DISPLAY is set on X11)`
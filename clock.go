@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// Clock tells the time. The watcher's time-based logic (cooldowns,
+// escalation, AIMinInterval, the AI circuit breaker) reads it through one so
+// tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCheckOnceCooldownClock(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertCooldown = time.Minute
+	cfg.AlertEscalation = []escalationStep{{90 * time.Second, 1320, 800}}
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	clock := newFakeClock()
+	w.clock = clock
+
+	// the bubble stays put; the cooldown lets one alert through a minute
+	for i, step := range []struct {
+		advance    time.Duration
+		alerts     int
+		sustained  time.Duration
+		escalation int
+	}{
+		{0, 1, 0, 0},
+		{time.Minute - time.Nanosecond, 0, 0, 0},
+		{time.Nanosecond, 1, time.Minute, 0},
+		{time.Minute, 1, 2 * time.Minute, 1},
+	} {
+		clock.Advance(step.advance)
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Alerts) != step.alerts {
+			t.Fatalf("poll %d: %d alerts, want %d", i, len(res.Alerts), step.alerts)
+		}
+		if step.alerts == 0 {
+			continue
+		}
+		ev := res.Alerts[0]
+		if !ev.Time.Equal(clock.Now()) || ev.Sustained != step.sustained {
+			t.Errorf("poll %d: alert at %v sustained %s, want %v and %s", i, ev.Time, ev.Sustained, clock.Now(), step.sustained)
+		}
+		if level := cfg.escalationLevel(ev.Sustained); level != step.escalation {
+			t.Errorf("poll %d: escalation %d, want %d", i, level, step.escalation)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Color spaces for line classification.
+const (
+	colorSpaceRGB = "rgb"
+	colorSpaceHSV = "hsv"
+	colorSpaceLab = "lab"
+)
+
+// rgbToHSV converts 8-bit RGB to hue in degrees [0,360) and saturation and
+// value in [0,1].
+func rgbToHSV(r, g, b uint8) (h, s, v float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := max(rf, gf, bf)
+	min := min(rf, gf, bf)
+	delta := max - min
+
+	v = max
+	if max == 0 || delta == 0 {
+		return 0, 0, v // black or grey: no hue
+	}
+	s = delta / max
+
+	switch max {
+	case rf:
+		h = 60 * ((gf - bf) / delta)
+	case gf:
+		h = 60 * ((bf-rf)/delta + 2)
+	default:
+		h = 60 * ((rf-gf)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// labColor is a CIE L*a*b* color (D65 white point).
+type labColor struct{ L, A, B float64 }
+
+// srgbLinear maps an 8-bit sRGB channel to linear light, so rgbToLab needn't
+// call math.Pow for every pixel.
+var srgbLinear = func() (t [256]float64) {
+	for i := range t {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			t[i] = c / 12.92
+		} else {
+			t[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return t
+}()
+
+// rgbToLab converts 8-bit sRGB to CIE L*a*b*, by way of linear RGB and XYZ.
+func rgbToLab(r, g, b uint8) labColor {
+	rl, gl, bl := srgbLinear[r], srgbLinear[g], srgbLinear[b]
+	x := (0.4124564*rl + 0.3575761*gl + 0.1804375*bl) / 0.95047
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := (0.0193339*rl + 0.1191920*gl + 0.9503041*bl) / 1.08883
+	f := func(t float64) float64 {
+		const e = 6.0 / 29
+		if t > e*e*e {
+			return math.Cbrt(t)
+		}
+		return t/(3*e*e) + 4.0/29
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return labColor{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// labDistance is the CIE76 color difference (ΔE*ab) between c and d. About
+// 2.3 is just noticeable; Bookmap's red and orange lines are some 30 apart.
+func labDistance(c, d labColor) float64 {
+	return math.Sqrt((c.L-d.L)*(c.L-d.L) + (c.A-d.A)*(c.A-d.A) + (c.B-d.B)*(c.B-d.B))
+}
+
+// labMatch reports whether the pixel is within p's LabTolerance of its
+// target color. Unlike the RGB box, the tolerance is perceptually even: a
+// darker or paler shade of the target counts the same as a slightly
+// different hue.
+func labMatch(r, g, b uint8, p ColorProfile) bool {
+	return labDistance(rgbToLab(r, g, b), p.target) <= p.labTolerance
+}
+
+// hexColor formats c as #rrggbb, ignoring alpha.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// hsvMatch reports whether the pixel's hue is inside p's band and it is
+// saturated and bright enough. Because it looks at hue rather than the raw
+// channel values, a dim or anti-aliased red still reads as red.
+func hsvMatch(r, g, b uint8, p ColorProfile) bool {
+	h, s, v := rgbToHSV(r, g, b)
+	if s < p.MinSat || v < p.MinVal {
+		return false
+	}
+	if p.HueMin <= p.HueMax {
+		return h >= p.HueMin && h <= p.HueMax
+	}
+	return h >= p.HueMin || h <= p.HueMax // band wraps through 0
+}
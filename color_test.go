@@ -0,0 +1,135 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestRGBToHSV(t *testing.T) {
+	tests := []struct {
+		r, g, b uint8
+		h, s, v float64
+	}{
+		{255, 0, 0, 0, 1, 1},
+		{0, 255, 0, 120, 1, 1},
+		{0, 0, 255, 240, 1, 1},
+		{255, 0, 255, 300, 1, 1},
+		{128, 128, 128, 0, 0, 128.0 / 255},
+		{0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		h, s, v := rgbToHSV(tt.r, tt.g, tt.b)
+		if math.Abs(h-tt.h) > 1e-9 || math.Abs(s-tt.s) > 1e-9 || math.Abs(v-tt.v) > 1e-9 {
+			t.Errorf("rgbToHSV(%d,%d,%d) = %.2f,%.2f,%.2f, want %.2f,%.2f,%.2f",
+				tt.r, tt.g, tt.b, h, s, v, tt.h, tt.s, tt.v)
+		}
+	}
+}
+
+func TestClassifierRGBvsHSV(t *testing.T) {
+	rgbCfg := testConfig()
+	hsvCfg := testConfig()
+	hsvCfg.ColorSpace = colorSpaceHSV
+	rgb, hsv := rgbCfg.lineProfiles()[0], hsvCfg.lineProfiles()[0]
+
+	tests := []struct {
+		name             string
+		c                color.RGBA
+		wantRGB, wantHSV bool
+	}{
+		{"bright red", fixtureRed, true, true},
+		{"dim red line", color.RGBA{150, 30, 30, 255}, false, true},
+		{"anti-aliased red on dark", color.RGBA{120, 28, 32, 255}, false, true},
+		{"orange", color.RGBA{230, 110, 30, 255}, true, true},
+		{"pinkish grey", color.RGBA{200, 110, 110, 255}, true, false},
+		{"background", fixtureBackground, false, false},
+		{"white", fixtureWhite, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLineColor(tt.c.R, tt.c.G, tt.c.B, rgb); got != tt.wantRGB {
+				t.Errorf("rgb = %v, want %v", got, tt.wantRGB)
+			}
+			if got := isLineColor(tt.c.R, tt.c.G, tt.c.B, hsv); got != tt.wantHSV {
+				t.Errorf("hsv = %v, want %v", got, tt.wantHSV)
+			}
+		})
+	}
+}
+
+func TestFindRedLineHSVCatchesDimLine(t *testing.T) {
+	img := newFixture(-1, image.Rectangle{})
+	dim := color.RGBA{150, 30, 30, 255}
+	draw.Draw(img, image.Rect(0, 120, 400, 121), &image.Uniform{dim}, image.Point{}, draw.Src)
+
+	cfg := testConfig()
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	if _, ok := findRedLine(img, roi, cfg); ok {
+		t.Error("rgb found the dim line; the fixture no longer exercises the difference")
+	}
+
+	cfg.ColorSpace = colorSpaceHSV
+	if line, ok := findRedLine(img, roi, cfg); !ok || line.Y != 120 {
+		t.Errorf("hsv: line = %+v (found %v), want Y=120", line, ok)
+	}
+}
+
+func TestRGBToLab(t *testing.T) {
+	tests := []struct {
+		r, g, b uint8
+		want    labColor
+	}{
+		{255, 255, 255, labColor{100, 0, 0}},
+		{0, 0, 0, labColor{0, 0, 0}},
+		{255, 0, 0, labColor{53.24, 80.09, 67.20}},
+		{0, 0, 255, labColor{32.30, 79.19, -107.86}},
+	}
+	for _, tt := range tests {
+		if got := rgbToLab(tt.r, tt.g, tt.b); labDistance(got, tt.want) > 0.02 {
+			t.Errorf("rgbToLab(%d,%d,%d) = %.2f, want %.2f", tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClassifierRGBvsLab(t *testing.T) {
+	rgbCfg := testConfig()
+	labCfg := testConfig()
+	labCfg.ColorSpace = colorSpaceLab // #e62828, ΔE 25
+	rgb, lab := rgbCfg.lineProfiles()[0], labCfg.lineProfiles()[0]
+
+	tests := []struct {
+		name             string
+		c                color.RGBA
+		wantRGB, wantLab bool
+	}{
+		{"target", color.RGBA{230, 40, 40, 255}, true, true},
+		{"dim red below RedMinR", color.RGBA{175, 35, 35, 255}, false, true},
+		{"darker red just inside", color.RGBA{165, 30, 30, 255}, false, true},   // ΔE 24.9
+		{"darker red just outside", color.RGBA{160, 30, 30, 255}, false, false}, // ΔE 27.2
+		{"bluish red inside", color.RGBA{230, 40, 80, 255}, true, true},         // ΔE 22.3
+		{"bluish red outside", color.RGBA{230, 40, 90, 255}, true, false},       // ΔE 28.1
+		{"orange button", color.RGBA{230, 110, 30, 255}, true, false},           // ΔE 31.3
+		{"pinkish grey", color.RGBA{200, 110, 110, 255}, true, false},
+		{"background", fixtureBackground, false, false},
+		{"white", fixtureWhite, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLineColor(tt.c.R, tt.c.G, tt.c.B, rgb); got != tt.wantRGB {
+				t.Errorf("rgb = %v, want %v", got, tt.wantRGB)
+			}
+			if got := isLineColor(tt.c.R, tt.c.G, tt.c.B, lab); got != tt.wantLab {
+				t.Errorf("lab = %v, want %v", got, tt.wantLab)
+			}
+		})
+	}
+
+	// a LineColors profile is matched against the middle of its box
+	labCfg.LineColors = []ColorProfile{blueLineProfile}
+	if blue := labCfg.lineProfiles()[0]; !isLineColor(60, 80, 217, blue) || isLineColor(230, 40, 40, blue) {
+		t.Error("the blue profile's lab target isn't the middle of its RGB box")
+	}
+}
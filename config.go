@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+)
+
+// Config lets you tune detection.
+type Config struct {
+	Theme                      string  // preset thresholds for a Bookmap color theme, see themes; empty = defaults
+	Sensitivity                float64 // 0 (strict) to 1 (lenient) scales the detection thresholds together, see applySensitivity; 0.5 = as set
+	PollInterval               time.Duration
+	IdleAfterMisses            int           // polls with no line on a flat screen before backing off; 0 never
+	IdlePollInterval           time.Duration // poll interval while backed off
+	IdleUniformity             float64       // share of the ROI in one color that counts as a flat screen
+	MaxRuntime                 time.Duration // exit cleanly after running this long; 0 runs until stopped
+	RedMinR                    uint8
+	RedMaxG                    uint8
+	RedMaxB                    uint8
+	ColorSpace                 string     // "rgb" (RedMinR etc.), "hsv" (RedHue*, RedMinSat, RedMinVal) or "lab" (LineTargetColor, LabTolerance)
+	LineTargetColor            color.RGBA // lab: the line color pixels are compared with
+	LabTolerance               float64    // lab: the most a pixel's CIE76 ΔE may be from the target
+	RedHueMin                  float64    // hsv: red hue band in degrees, wrapping through 0
+	RedHueMax                  float64
+	RedMinSat                  float64        // hsv: 0-1
+	RedMinVal                  float64        // hsv: 0-1
+	LineDetectMode             string         // "run" (longest unbroken run), "count" (total pixels per row) or "edge" (see EdgeContrastDelta)
+	EdgeContrastDelta          int            // edge mode: how much redder than the row above or below a pixel must be
+	DetectDashed               bool           // also accept rows of evenly spaced dashes spanning the threshold; see Config.dashedLine
+	DashedGapTolerance         float64        // most the dash gaps may vary, as stddev/mean
+	MinRedRunLength            int            // run mode threshold
+	MinRedPixelsPerRow         int            // count mode threshold
+	MinRedPixelsPerRowFraction float64        // if > 0, count mode threshold as a fraction of ROI width instead
+	MinRedPixelsPerCol         int            // vertical line threshold, see DetectVertical
+	DetectVertical             bool           // also look for vertical lines crossing horizontal ones
+	LineMoveThreshold          int            // >0: alert when the strongest line's Y jumps more than this many pixels between polls
+	LineSmoothing              int            // >1: report the strongest line at the median of its last this many Ys; see lineSmoother
+	LineMergeGap               int            // rows this close together count as one line
+	LineColors                 []ColorProfile // empty = red profile from RedMinR/RedMaxG/RedMaxB
+	MaxDistanceBubbleToLine    int
+	BubbleDistanceAbove        int     // rows searched above the line; 0 = MaxDistanceBubbleToLine
+	BubbleDistanceBelow        int     // rows searched below the line; 0 = MaxDistanceBubbleToLine
+	BubbleSearchSide           string  // "left" or "right" edge of the ROI
+	BubbleSearchWidthPercent   float64 // fraction of ROI width to search, (0,1]
+	BubbleAtLineEnd            bool    // search around where each line ends instead of the BubbleSearchSide band
+	BubbleLineEndWindow        int     // with BubbleAtLineEnd: pixels searched either side of the line's end
+	DetectBlinkingBubble       bool    // count bubble pixels lit in this frame or the previous one, for blinking alerts
+	BubbleBrightThreshold      int
+	BubblePolarity             string // "bright" (light pill on a dark chart, r+g+b >= BubbleBrightThreshold) or "dark" (r+g+b <= BubbleDarkThreshold)
+	BubbleDarkThreshold        int
+	BubbleRelativeBrightness   bool // judge bubble pixels against the chart around the line instead of BubbleBrightThreshold
+	BubbleBrightnessDelta      int  // with BubbleRelativeBrightness: how far above (dark: below) the band's mean r+g+b a bubble pixel must be
+	BubbleMinBrightPixels      int
+	BubbleMinWidth             int // bounding box of the bright blob, in pixels;
+	BubbleMaxWidth             int // a zero max is unbounded
+	BubbleMinHeight            int
+	BubbleMaxHeight            int
+	ConfirmFrames              int             // consecutive polls a bubble must sit on a line before alerting
+	WarmupPolls                int             // polls after startup whose alerts are held back while the display settles (not -once)
+	AlertCooldown              time.Duration   // after an alert, hold back repeats for the same color and level this long; 0 off
+	RearmAfterClearPolls       int             // after a bubble alert, hold back repeats until the line's bubble has been gone this many polls; 0 off
+	DisplayIndex               int             // display to capture
+	CaptureRegion              image.Rectangle // if set, capture only this region instead of the whole display
+	RegionRelativeToDisplay    bool            // CaptureRegion is relative to each display's top-left instead of the virtual desktop
+	DisplayIndices             []int           // if set, every one of these is scanned each poll instead
+	ROIMarginPercent           float64         // margin cut off every edge whose ROIMargin<Edge> is 0
+	ROIMarginTop               float64         // fraction of the height cut off the top, e.g. for the menu bar
+	ROIMarginBottom            float64         // ...and off the bottom, e.g. for the dock
+	ROIMarginLeft              float64         // fraction of the width cut off the left
+	ROIMarginRight             float64
+	ROIRect                    image.Rectangle // capture pixels to scan; overrides the ROI margins when non-empty
+	LineScanYRange             [2]float64      // rows of the ROI scanned for lines, as fractions of its height from the top
+	ScaleDivisor               int             // >1 scans a 1/N-size copy of each frame; thresholds stay in full-res pixels
+	ScanStride                 int             // >1 samples every Nth pixel (and bubble row); counts are scaled back up
+	ScanWorkers                int             // goroutines the line scan splits a large ROI's rows over; 0 = GOMAXPROCS, 1 = serial
+	DiffScan                   bool            // rescan only the ROI rows that changed since the display's last frame
+	IgnoreCursorRegion         bool            // paint over the mouse cursor before scanning, where the platform can tell where it is
+	CursorRadius               int             // with IgnoreCursorRegion: pixels masked either side of the cursor
+	MinCaptureBrightness       float64         // average 0-255 brightness below which a capture is rejected as blank
+	TargetWindowTitle          string          // capture just the window whose title contains this (macOS)
+	AIEndpoint                 string          // empty disables the AI price step
+	AIAlwaysRun                bool            // call the AI even on frames with no line
+	AIMinInterval              time.Duration   // >0: call the AI at most this often per display, reusing the last price in between
+	AITimeout                  time.Duration   // per-request limit for the AI call
+	AIMaxRetries               int             // extra attempts on connection errors / 5xx
+	AIConcurrency              int             // AI requests allowed in flight at once; see aiQueue
+	AIPriceMin                 float64         // >0: AI or OCR prices below this are misreads and discarded
+	AIPriceMax                 float64         // >0: prices above this are discarded
+	AIIdleConnTimeout          time.Duration   // how long an idle AI connection is kept open for reuse; 0 turns keep-alive off
+	AIBreakerFailures          int             // consecutive AI failures that open the circuit; 0 never opens it
+	AIBreakerCooldown          time.Duration   // how long an open circuit skips AI calls before a probe
+	AIRequestMode              string          // "raw" (PNG body) or "multipart"
+	AIFormField                string          // form field name in multipart mode
+	AIPriceField               string          // dot path to the price in the AI response, e.g. "result.price"
+	AIConfidenceField          string          // optional dot path to a confidence value to log
+	SendDetectionHints         bool            // add lineY, roi and bubble query parameters to the AI request
+	EnableOCRFallback          bool            // when the AI call fails, read the price off the bubble with tesseract
+	AIAuthHeader               string          // request header carrying AIAuthToken; "Authorization" sends "Bearer <token>"
+	AIAuthToken                secret          // empty sends no auth header; set it with WATCHER_AI_AUTH_TOKEN
+	SaveFrames                 bool            // debug: archive each frame under FrameDir
+	FrameDir                   string          // where SaveFrames writes timestamped frames in ImageFormat
+	SaveFailureFatal           bool            // fail the poll when a frame can't be saved, instead of logging it and carrying on
+	MaxFrames                  int             // keep at most this many frames; 0 = unlimited
+	ImageFormat                string          // "png" or "jpeg", for saved frames and the AI upload
+	JPEGQuality                int             // 1-100, with ImageFormat "jpeg" and for /stream
+	ResultsLogPath             string          // if set, every poll's result is appended here as a JSON line
+	AlertLogPath               string          // if set, every alert fired is appended here as a CSV row, for audit
+	MetricsAddr                string          // e.g. ":9108"; empty disables /healthz, /metrics, /alerts, /pause and /resume
+	ProfileAddr                string          // where -profile serves pprof; keep it on localhost, profiles expose the process's internals
+	StreamFrames               bool            // serve each captured frame as MJPEG on MetricsAddr's /stream; bandwidth-heavy
+	StreamAnnotated            bool            // stream the frames with the detection overlaid, as annotateFrame draws it
+	OverlayPath                string          // if set, each poll's annotated frame replaces this PNG, for viewers that poll a file
+	AlertHistorySize           int             // alerts kept for /alerts
+	StatePath                  string          // if set, the /metrics counters are saved here and restored at startup
+	StateSaveInterval          time.Duration   // how often StatePath is written besides on shutdown
+	DryRun                     bool            // log alerts instead of notifying/beeping
+	AlertPriceAbove            float64         // >0: only alert when the AI price is above this
+	AlertPriceBelow            float64         // >0: only alert when the AI price is below this
+	AlertOnMissingPrice        bool            // let alerts through a price gate when there is no AI price
+	RequirePriceChange         bool            // only alert on frames whose fresh AI price moved MinPriceDelta from the display's last one
+	MinPriceDelta              float64         // with RequirePriceChange: the smallest AI price move that counts
+	AlertBatchWindow           time.Duration   // >0 coalesces alerts this close together into one summary
+	NotifyFailureLimit         int             // consecutive desktop notify/beep failures before they're disabled; 0 never
+	MaxConcurrentAlerts        int             // alert deliveries allowed at once; more are dropped. 0 = unlimited
+	Notifiers                  []string        // any of "beep", "webhook", "log"
+	AlertWebhookURL            string          // target of the "webhook" notifier; empty skips it
+	QuietHoursStart            string          // local "15:04"; alerts from here to QuietHoursEnd only reach QuietHoursNotifiers
+	QuietHoursEnd              string          // may be earlier than the start, for a window past midnight
+	QuietHoursNotifiers        []string        // notifiers still used during quiet hours, e.g. "log,webhook"; empty silences all
+	AlertRules                 []alertRule     // per condition, which notifiers an alert goes to; first match wins, none = all Notifiers
+	FaintLineConfidence        float64         // alerts on lines below this Confidence meet the "faint" rule condition
+	BeepEnabled                bool            // false keeps the notification but drops the sound
+	BeepFreqHz                 float64
+	BeepDurationMs             int
+	AlertEscalation            []escalationStep // louder/longer beeps the longer a bubble stays at its line, by ascending After
+	SoundFilePath              string           // sound played instead of the beep; see playSoundFile for formats
+	NotifyTitleTemplate        string           // text/template over the AlertEvent for the desktop notification title; empty = built-in text
+	NotifyBodyTemplate         string           // likewise for the body
+	LogFormat                  string           // "text" or "json"
+	LogLevel                   string           // "debug", "info", "warn" or "error"
+	LogFilePath                string           // if set, logs go here instead of stderr
+	LogMaxSizeMB               int              // LogFilePath is rotated once it would grow past this; 0 never rotates
+}
+
+// defaultConfig returns the built-in settings.
+func defaultConfig() Config {
+	return Config{
+		Sensitivity:              defaultSensitivity,
+		PollInterval:             10 * time.Second,
+		IdleAfterMisses:          30, // 5 minutes at the default interval
+		IdlePollInterval:         time.Minute,
+		IdleUniformity:           0.9,
+		RedMinR:                  180,
+		RedMaxG:                  120, // allow orange/yellow, not just pure red
+		RedMaxB:                  120,
+		ColorSpace:               colorSpaceRGB,
+		LineTargetColor:          color.RGBA{R: 230, G: 40, B: 40, A: 255}, // Bookmap's default bright red
+		LabTolerance:             25,                                       // darker reds, not orange
+		RedHueMin:                340,                                      // through red to orange
+		RedHueMax:                40,
+		RedMinSat:                0.5,
+		RedMinVal:                0.35,
+		LineDetectMode:           lineModeRun,
+		EdgeContrastDelta:        60,
+		DashedGapTolerance:       0.25,
+		MinRedRunLength:          300,     // tune by screen size
+		MinRedPixelsPerRow:       500,     // tune by screen size
+		MinRedPixelsPerCol:       300,     // screens are shorter than they are wide
+		LineMergeGap:             3,       // a thick line spans several rows
+		MaxDistanceBubbleToLine:  10,      // pixels above/below line
+		BubbleSearchSide:         "right", // price labels on the right axis
+		BubbleSearchWidthPercent: 0.20,
+		BubbleLineEndWindow:      80,
+		BubbleBrightThreshold:    600, // r+g+b >= this
+		BubblePolarity:           bubblePolarityBright,
+		BubbleDarkThreshold:      150, // r+g+b <= this, with BubblePolarity "dark"
+		BubbleBrightnessDelta:    100,
+		BubbleMinBrightPixels:    150, // how many “bright” pixels = bubble
+		BubbleMinWidth:           10,  // a price pill, not a stray glyph...
+		BubbleMaxWidth:           120, // ...and not a legend or panel
+		BubbleMinHeight:          6,
+		BubbleMaxHeight:          40,
+		ConfirmFrames:            1,    // alert on the first frame
+		ROIMarginPercent:         0.10, // ignore outer 10% around screen
+		LineScanYRange:           [2]float64{0, 1},
+		ScaleDivisor:             1,
+		ScanStride:               1,
+		CursorRadius:             24,
+		MinCaptureBrightness:     1.0, // anything darker is a black frame
+		AIEndpoint:               "http://localhost:8000/api/detect-stock-price",
+		AITimeout:                5 * time.Second,
+		AIMaxRetries:             3, // 200ms, 400ms, 800ms
+		AIConcurrency:            1, // a single-GPU inference server
+		AIIdleConnTimeout:        90 * time.Second,
+		AIBreakerFailures:        5,
+		AIBreakerCooldown:        30 * time.Second,
+		AIRequestMode:            "raw",
+		AIFormField:              "image",
+		AIPriceField:             "stockPrice",
+		AIConfidenceField:        "confidence",
+		AIAuthHeader:             "Authorization",
+		NotifyFailureLimit:       3,
+		MaxConcurrentAlerts:      8,
+		Notifiers:                []string{notifierBeep, notifierWebhook, notifierLog},
+		FaintLineConfidence:      1.5, // no AlertRules by default, so every alert reaches every notifier
+		BeepEnabled:              true,
+		BeepFreqHz:               880,
+		BeepDurationMs:           500,
+		FrameDir:                 "frames",
+		MaxFrames:                200,
+		ImageFormat:              imageFormatPNG,
+		JPEGQuality:              85,
+		ProfileAddr:              "localhost:6060",
+		AlertHistorySize:         50,
+		StateSaveInterval:        time.Minute,
+		LogFormat:                "text",
+		LogLevel:                 "info",
+		LogMaxSizeMB:             10,
+	}
+}
+
+// Validate checks ranges and the combinations that can't work, and reports
+// every problem at once rather than just the first.
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, knownTheme := themes[cfg.Theme]
+	check(cfg.Theme == "" || knownTheme, "Theme must be one of %s, got %q", themeNames(), cfg.Theme)
+	check(cfg.Sensitivity >= 0 && cfg.Sensitivity <= 1, "Sensitivity must be in [0,1], got %v", cfg.Sensitivity)
+	check(cfg.PollInterval > 0, "PollInterval must be positive, got %s", cfg.PollInterval)
+	check(cfg.MaxRuntime >= 0, "MaxRuntime must not be negative, got %s", cfg.MaxRuntime)
+	check(cfg.IdleAfterMisses >= 0, "IdleAfterMisses must not be negative, got %d", cfg.IdleAfterMisses)
+	check(cfg.IdleAfterMisses == 0 || cfg.IdlePollInterval > 0,
+		"IdlePollInterval must be positive when IdleAfterMisses is set, got %s", cfg.IdlePollInterval)
+	check(cfg.IdleUniformity >= 0 && cfg.IdleUniformity <= 1, "IdleUniformity must be in [0,1], got %v", cfg.IdleUniformity)
+
+	check(cfg.ROIMarginPercent >= 0 && cfg.ROIMarginPercent < 0.5,
+		"ROIMarginPercent must be in [0,0.5), got %v", cfg.ROIMarginPercent)
+	for _, m := range []struct {
+		name string
+		v    float64
+	}{
+		{"ROIMarginTop", cfg.ROIMarginTop}, {"ROIMarginBottom", cfg.ROIMarginBottom},
+		{"ROIMarginLeft", cfg.ROIMarginLeft}, {"ROIMarginRight", cfg.ROIMarginRight},
+	} {
+		check(m.v >= 0 && m.v < 1, "%s must be in [0,1), got %v", m.name, m.v)
+	}
+	m := cfg.roiMargins()
+	check(m.Top+m.Bottom < 1, "ROIMarginTop + ROIMarginBottom must be below 1, got %v", m.Top+m.Bottom)
+	check(m.Left+m.Right < 1, "ROIMarginLeft + ROIMarginRight must be below 1, got %v", m.Left+m.Right)
+
+	check(cfg.ColorSpace == colorSpaceRGB || cfg.ColorSpace == colorSpaceHSV || cfg.ColorSpace == colorSpaceLab,
+		"ColorSpace must be %q, %q or %q, got %q", colorSpaceRGB, colorSpaceHSV, colorSpaceLab, cfg.ColorSpace)
+	check(cfg.LabTolerance > 0, "LabTolerance must be positive, got %v", cfg.LabTolerance)
+	check(cfg.RedHueMin >= 0 && cfg.RedHueMin < 360 && cfg.RedHueMax >= 0 && cfg.RedHueMax < 360,
+		"RedHueMin/RedHueMax must be in [0,360), got %v/%v", cfg.RedHueMin, cfg.RedHueMax)
+	check(cfg.RedMinSat >= 0 && cfg.RedMinSat <= 1 && cfg.RedMinVal >= 0 && cfg.RedMinVal <= 1,
+		"RedMinSat/RedMinVal must be in [0,1], got %v/%v", cfg.RedMinSat, cfg.RedMinVal)
+	check(cfg.LineDetectMode == lineModeRun || cfg.LineDetectMode == lineModeCount || cfg.LineDetectMode == lineModeEdge,
+		"LineDetectMode must be %q, %q or %q, got %q", lineModeRun, lineModeCount, lineModeEdge, cfg.LineDetectMode)
+	check(cfg.LineMoveThreshold >= 0, "LineMoveThreshold must not be negative, got %d", cfg.LineMoveThreshold)
+	check(cfg.LineSmoothing >= 0, "LineSmoothing must not be negative, got %d", cfg.LineSmoothing)
+	check(cfg.EdgeContrastDelta >= 0, "EdgeContrastDelta must not be negative, got %d", cfg.EdgeContrastDelta)
+	check(cfg.DashedGapTolerance >= 0, "DashedGapTolerance must not be negative, got %v", cfg.DashedGapTolerance)
+	check(cfg.MinRedRunLength >= 0, "MinRedRunLength must not be negative, got %d", cfg.MinRedRunLength)
+	check(cfg.MinRedPixelsPerRow >= 0, "MinRedPixelsPerRow must not be negative, got %d", cfg.MinRedPixelsPerRow)
+	check(cfg.MinRedPixelsPerRowFraction >= 0 && cfg.MinRedPixelsPerRowFraction <= 1,
+		"MinRedPixelsPerRowFraction must be in [0,1], got %v", cfg.MinRedPixelsPerRowFraction)
+	check(cfg.MinRedPixelsPerCol >= 0, "MinRedPixelsPerCol must not be negative, got %d", cfg.MinRedPixelsPerCol)
+	check(cfg.LineMergeGap >= 0, "LineMergeGap must not be negative, got %d", cfg.LineMergeGap)
+	for _, p := range cfg.LineColors {
+		check(p.Name != "", "LineColors entries need a Name")
+		check(p.MinR <= p.MaxR && p.MinG <= p.MaxG && p.MinB <= p.MaxB,
+			"LineColors %q has a min above its max", p.Name)
+	}
+
+	check(cfg.MaxDistanceBubbleToLine >= 0, "MaxDistanceBubbleToLine must not be negative, got %d", cfg.MaxDistanceBubbleToLine)
+	check(cfg.BubbleDistanceAbove >= 0 && cfg.BubbleDistanceBelow >= 0,
+		"BubbleDistanceAbove/BubbleDistanceBelow must not be negative, got %d/%d", cfg.BubbleDistanceAbove, cfg.BubbleDistanceBelow)
+	check(cfg.BubbleSearchSide == "left" || cfg.BubbleSearchSide == "right",
+		"BubbleSearchSide must be \"left\" or \"right\", got %q", cfg.BubbleSearchSide)
+	check(cfg.BubbleSearchWidthPercent > 0 && cfg.BubbleSearchWidthPercent <= 1,
+		"BubbleSearchWidthPercent must be in (0,1], got %v", cfg.BubbleSearchWidthPercent)
+	check(cfg.BubbleLineEndWindow >= 0, "BubbleLineEndWindow must not be negative, got %d", cfg.BubbleLineEndWindow)
+	check(cfg.BubbleBrightThreshold >= 0 && cfg.BubbleBrightThreshold <= 3*255,
+		"BubbleBrightThreshold must be in [0,765], got %d", cfg.BubbleBrightThreshold)
+	check(cfg.BubblePolarity == bubblePolarityBright || cfg.BubblePolarity == bubblePolarityDark,
+		"BubblePolarity must be %q or %q, got %q", bubblePolarityBright, bubblePolarityDark, cfg.BubblePolarity)
+	check(cfg.BubbleDarkThreshold >= 0 && cfg.BubbleDarkThreshold <= 3*255,
+		"BubbleDarkThreshold must be in [0,765], got %d", cfg.BubbleDarkThreshold)
+	check(cfg.BubbleBrightnessDelta >= 0 && cfg.BubbleBrightnessDelta <= 3*255,
+		"BubbleBrightnessDelta must be in [0,765], got %d", cfg.BubbleBrightnessDelta)
+	check(cfg.BubbleMinBrightPixels >= 0, "BubbleMinBrightPixels must not be negative, got %d", cfg.BubbleMinBrightPixels)
+	check(cfg.BubbleMinWidth >= 0 && cfg.BubbleMinHeight >= 0,
+		"BubbleMinWidth/BubbleMinHeight must not be negative, got %d/%d", cfg.BubbleMinWidth, cfg.BubbleMinHeight)
+	check(cfg.BubbleMaxWidth == 0 || cfg.BubbleMaxWidth >= cfg.BubbleMinWidth,
+		"BubbleMaxWidth (%d) must be 0 or at least BubbleMinWidth (%d)", cfg.BubbleMaxWidth, cfg.BubbleMinWidth)
+	check(cfg.BubbleMaxHeight == 0 || cfg.BubbleMaxHeight >= cfg.BubbleMinHeight,
+		"BubbleMaxHeight (%d) must be 0 or at least BubbleMinHeight (%d)", cfg.BubbleMaxHeight, cfg.BubbleMinHeight)
+	check(cfg.ConfirmFrames >= 0, "ConfirmFrames must not be negative, got %d", cfg.ConfirmFrames)
+	check(cfg.WarmupPolls >= 0, "WarmupPolls must not be negative, got %d", cfg.WarmupPolls)
+	check(cfg.AlertCooldown >= 0, "AlertCooldown must not be negative, got %s", cfg.AlertCooldown)
+	check(cfg.RearmAfterClearPolls >= 0, "RearmAfterClearPolls must not be negative, got %d", cfg.RearmAfterClearPolls)
+
+	check(cfg.ROIRect == (image.Rectangle{}) || (cfg.ROIRect.Min.X < cfg.ROIRect.Max.X && cfg.ROIRect.Min.Y < cfg.ROIRect.Max.Y),
+		"ROIRect must have Min < Max, got %v", cfg.ROIRect)
+	check(cfg.ROIRect.Min.X >= 0 && cfg.ROIRect.Min.Y >= 0,
+		"ROIRect must not start at negative coordinates, got %v", cfg.ROIRect)
+	check(0 <= cfg.LineScanYRange[0] && cfg.LineScanYRange[0] < cfg.LineScanYRange[1] && cfg.LineScanYRange[1] <= 1,
+		"LineScanYRange must be two fractions with 0 <= from < to <= 1, got %v", cfg.LineScanYRange)
+	check(cfg.AlertHistorySize >= 0, "AlertHistorySize must not be negative, got %d", cfg.AlertHistorySize)
+	check(!cfg.StreamFrames || cfg.MetricsAddr != "", "StreamFrames needs MetricsAddr to serve /stream on")
+	check(cfg.ProfileAddr != "", "ProfileAddr must not be empty")
+	check(cfg.StatePath == "" || cfg.StateSaveInterval > 0, "StateSaveInterval must be positive, got %s", cfg.StateSaveInterval)
+	check(cfg.CaptureRegion == (image.Rectangle{}) || (cfg.CaptureRegion.Min.X < cfg.CaptureRegion.Max.X && cfg.CaptureRegion.Min.Y < cfg.CaptureRegion.Max.Y),
+		"CaptureRegion must have Min < Max, got %v", cfg.CaptureRegion)
+	check(!cfg.RegionRelativeToDisplay || (cfg.CaptureRegion.Min.X >= 0 && cfg.CaptureRegion.Min.Y >= 0),
+		"CaptureRegion relative to a display must not start at negative coordinates, got %v", cfg.CaptureRegion)
+	check(cfg.DisplayIndex >= 0, "DisplayIndex must not be negative, got %d", cfg.DisplayIndex)
+	for _, d := range cfg.DisplayIndices {
+		check(d >= 0, "DisplayIndices must not contain negative indices, got %d", d)
+	}
+	check(cfg.ScaleDivisor >= 1, "ScaleDivisor must be at least 1, got %d", cfg.ScaleDivisor)
+	check(cfg.CursorRadius >= 0, "CursorRadius must not be negative, got %d", cfg.CursorRadius)
+	check(cfg.ScanStride >= 1, "ScanStride must be at least 1, got %d", cfg.ScanStride)
+	check(cfg.ScanWorkers >= 0, "ScanWorkers must not be negative, got %d", cfg.ScanWorkers)
+	check(cfg.MinCaptureBrightness >= 0 && cfg.MinCaptureBrightness <= 255,
+		"MinCaptureBrightness must be in [0,255], got %v", cfg.MinCaptureBrightness)
+
+	check(cfg.AITimeout >= 0, "AITimeout must not be negative, got %s", cfg.AITimeout)
+	check(cfg.AIMinInterval >= 0, "AIMinInterval must not be negative, got %s", cfg.AIMinInterval)
+	check(cfg.AIMaxRetries >= 0, "AIMaxRetries must not be negative, got %d", cfg.AIMaxRetries)
+	check(cfg.AIConcurrency >= 1, "AIConcurrency must be at least 1, got %d", cfg.AIConcurrency)
+	check(cfg.AIPriceMin >= 0 && cfg.AIPriceMax >= 0, "AIPriceMin/AIPriceMax must not be negative, got %v/%v", cfg.AIPriceMin, cfg.AIPriceMax)
+	check(cfg.AIPriceMax == 0 || cfg.AIPriceMin < cfg.AIPriceMax,
+		"AIPriceMin must be below AIPriceMax, got %v/%v", cfg.AIPriceMin, cfg.AIPriceMax)
+	check(cfg.AIIdleConnTimeout >= 0, "AIIdleConnTimeout must not be negative, got %s", cfg.AIIdleConnTimeout)
+	check(cfg.AIBreakerFailures >= 0, "AIBreakerFailures must not be negative, got %d", cfg.AIBreakerFailures)
+	check(cfg.AIBreakerFailures == 0 || cfg.AIBreakerCooldown > 0,
+		"AIBreakerCooldown must be positive when AIBreakerFailures is set, got %s", cfg.AIBreakerCooldown)
+	check(cfg.AIRequestMode == "raw" || cfg.AIRequestMode == "multipart",
+		"AIRequestMode must be \"raw\" or \"multipart\", got %q", cfg.AIRequestMode)
+	check(cfg.AIRequestMode != "multipart" || cfg.AIFormField != "", "AIFormField must be set in multipart mode")
+	check(cfg.AIAuthToken == "" || cfg.AIAuthHeader != "", "AIAuthHeader must be set when AIAuthToken is")
+	check(cfg.AIPriceField != "", "AIPriceField must be set")
+
+	check(cfg.MinPriceDelta >= 0, "MinPriceDelta must not be negative, got %v", cfg.MinPriceDelta)
+	check(!cfg.RequirePriceChange || cfg.AIEndpoint != "",
+		"RequirePriceChange needs AIEndpoint: without an AI price no alert would ever fire")
+	check(cfg.AlertPriceAbove >= 0 && cfg.AlertPriceBelow >= 0,
+		"AlertPriceAbove/AlertPriceBelow must not be negative, got %v/%v", cfg.AlertPriceAbove, cfg.AlertPriceBelow)
+	check(cfg.AlertPriceAbove == 0 || cfg.AlertPriceBelow == 0 || cfg.AlertPriceAbove < cfg.AlertPriceBelow,
+		"AlertPriceAbove (%v) must be below AlertPriceBelow (%v) when both are set", cfg.AlertPriceAbove, cfg.AlertPriceBelow)
+	check(cfg.AlertBatchWindow >= 0, "AlertBatchWindow must not be negative, got %s", cfg.AlertBatchWindow)
+	check(cfg.MaxConcurrentAlerts >= 0, "MaxConcurrentAlerts must not be negative, got %d", cfg.MaxConcurrentAlerts)
+	check(cfg.NotifyFailureLimit >= 0, "NotifyFailureLimit must not be negative, got %d", cfg.NotifyFailureLimit)
+	for _, name := range cfg.Notifiers {
+		check(name == notifierBeep || name == notifierWebhook || name == notifierLog,
+			"Notifiers: unknown notifier %q (want %q, %q or %q)", name, notifierBeep, notifierWebhook, notifierLog)
+	}
+	check((cfg.QuietHoursStart == "") == (cfg.QuietHoursEnd == ""),
+		"QuietHoursStart and QuietHoursEnd must be set together, got %q and %q", cfg.QuietHoursStart, cfg.QuietHoursEnd)
+	if cfg.QuietHoursStart != "" {
+		_, err := parseTimeOfDay(cfg.QuietHoursStart)
+		check(err == nil, "QuietHoursStart: %v", err)
+	}
+	if cfg.QuietHoursEnd != "" {
+		_, err := parseTimeOfDay(cfg.QuietHoursEnd)
+		check(err == nil, "QuietHoursEnd: %v", err)
+	}
+	check(cfg.QuietHoursStart == "" || cfg.QuietHoursStart != cfg.QuietHoursEnd,
+		"QuietHoursStart and QuietHoursEnd must differ, got %q for both", cfg.QuietHoursStart)
+	for _, name := range cfg.QuietHoursNotifiers {
+		check(name == notifierBeep || name == notifierWebhook || name == notifierLog,
+			"QuietHoursNotifiers: unknown notifier %q (want %q, %q or %q)", name, notifierBeep, notifierWebhook, notifierLog)
+	}
+	for i, r := range cfg.AlertRules {
+		switch r.Condition {
+		case alertBubble, alertCrossing, alertLineMoved, ruleFaint, ruleAny:
+		default:
+			check(false, "AlertRules rule %d: unknown condition %q (want %q, %q, %q, %q or %q)",
+				i+1, r.Condition, alertBubble, alertCrossing, alertLineMoved, ruleFaint, ruleAny)
+		}
+		for _, name := range r.Notifiers {
+			check(name == notifierBeep || name == notifierWebhook || name == notifierLog,
+				"AlertRules rule %d: unknown notifier %q (want %q, %q or %q)", i+1, name, notifierBeep, notifierWebhook, notifierLog)
+		}
+	}
+	check(cfg.FaintLineConfidence >= 0, "FaintLineConfidence must not be negative, got %v", cfg.FaintLineConfidence)
+	_, tmplErr := parseAlertTemplates(cfg)
+	check(tmplErr == nil, "%v", tmplErr)
+	if cfg.BeepEnabled {
+		check(cfg.BeepDurationMs > 0, "BeepDurationMs must be positive, got %d", cfg.BeepDurationMs)
+		check(cfg.BeepFreqHz > 0, "BeepFreqHz must be positive, got %v", cfg.BeepFreqHz)
+	}
+	for i, step := range cfg.AlertEscalation {
+		check(step.After > 0, "AlertEscalation step %d: After must be positive, got %s", i+1, step.After)
+		check(i == 0 || step.After > cfg.AlertEscalation[i-1].After,
+			"AlertEscalation step %d: After must be later than the step before, got %s", i+1, step.After)
+		check(step.FreqHz > 0 && step.DurationMs > 0,
+			"AlertEscalation step %d: FreqHz and DurationMs must be positive, got %v and %d", i+1, step.FreqHz, step.DurationMs)
+	}
+
+	check(!cfg.SaveFrames || cfg.FrameDir != "", "FrameDir must be set when SaveFrames is on")
+	check(cfg.MaxFrames >= 0, "MaxFrames must not be negative, got %d", cfg.MaxFrames)
+	check(cfg.ImageFormat == imageFormatPNG || cfg.ImageFormat == imageFormatJPEG,
+		"ImageFormat must be %q or %q, got %q", imageFormatPNG, imageFormatJPEG, cfg.ImageFormat)
+	check(cfg.JPEGQuality >= 1 && cfg.JPEGQuality <= 100, "JPEGQuality must be in 1-100, got %d", cfg.JPEGQuality)
+	check(cfg.LogMaxSizeMB >= 0, "LogMaxSizeMB must not be negative, got %d", cfg.LogMaxSizeMB)
+
+	return errors.Join(errs...)
+}
+
+// displays returns the display indices to scan each poll: DisplayIndices, or
+// just DisplayIndex when that is empty. A TargetWindowTitle or an absolute
+// CaptureRegion is one area of the desktop, so it is captured once.
+func (cfg Config) displays() []int {
+	single := cfg.TargetWindowTitle != "" || (!cfg.CaptureRegion.Empty() && !cfg.RegionRelativeToDisplay)
+	if len(cfg.DisplayIndices) > 0 && !single {
+		return cfg.DisplayIndices
+	}
+	return []int{cfg.DisplayIndex}
+}
+
+// priceInRange reports whether price lies within AIPriceMin/AIPriceMax, i.e.
+// is plausibly a real reading rather than an OCR glitch like 0 or 1e9.
+func (cfg Config) priceInRange(price float64) bool {
+	return (cfg.AIPriceMin == 0 || price >= cfg.AIPriceMin) &&
+		(cfg.AIPriceMax == 0 || price <= cfg.AIPriceMax)
+}
+
+// priceGateOK reports whether price passes AlertPriceAbove/AlertPriceBelow.
+// With neither set every price passes; a missing (NaN) price passes a gate
+// only with AlertOnMissingPrice.
+func (cfg Config) priceGateOK(price float64) bool {
+	if cfg.AlertPriceAbove == 0 && cfg.AlertPriceBelow == 0 {
+		return true
+	}
+	if math.IsNaN(price) {
+		return cfg.AlertOnMissingPrice
+	}
+	return (cfg.AlertPriceAbove == 0 || price > cfg.AlertPriceAbove) &&
+		(cfg.AlertPriceBelow == 0 || price < cfg.AlertPriceBelow)
+}
+
+// roiMargins are the fractions of a capture centralROI cuts off each edge.
+type roiMargins struct {
+	Top, Bottom, Left, Right float64
+}
+
+// roiMargins resolves the per-edge ROI margins, falling back to
+// ROIMarginPercent for each edge left at 0.
+func (cfg Config) roiMargins() roiMargins {
+	or := func(v float64) float64 {
+		if v == 0 {
+			return cfg.ROIMarginPercent
+		}
+		return v
+	}
+	return roiMargins{
+		Top: or(cfg.ROIMarginTop), Bottom: or(cfg.ROIMarginBottom),
+		Left: or(cfg.ROIMarginLeft), Right: or(cfg.ROIMarginRight),
+	}
+}
+
+// secret is a string config value, such as a token, that is kept out of logs:
+// it prints and marshals as "<redacted>" when set.
+type secret string
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
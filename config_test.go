@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigValid(t *testing.T) {
+	if err := defaultConfig().Validate(); err != nil {
+		t.Fatalf("defaultConfig is invalid: %v", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PollInterval = 0
+	cfg.ROIMarginPercent = 0.5
+	cfg.MinRedPixelsPerRow = -1
+	cfg.BubbleSearchWidthPercent = 1.5
+	cfg.RequirePriceChange, cfg.AIEndpoint = true, ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted a broken config")
+	}
+	for _, field := range []string{"PollInterval", "ROIMarginPercent", "MinRedPixelsPerRow", "BubbleSearchWidthPercent", "RequirePriceChange"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error doesn't mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPriceGateOK(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name         string
+		above, below float64
+		missingOK    bool
+		price        float64
+		want         bool
+	}{
+		{"no gate", 0, 0, false, nan, true},
+		{"above met", 4500, 0, false, 4520, true},
+		{"above not met", 4500, 0, false, 4480, false},
+		{"below met", 0, 4500, false, 4480, true},
+		{"band", 4500, 4600, false, 4550, true},
+		{"outside band", 4500, 4600, false, 4650, false},
+		{"missing price", 4500, 0, false, nan, false},
+		{"missing price allowed", 4500, 0, true, nan, true},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.AlertPriceAbove, cfg.AlertPriceBelow, cfg.AlertOnMissingPrice = tt.above, tt.below, tt.missingOK
+		if got := cfg.priceGateOK(tt.price); got != tt.want {
+			t.Errorf("%s: priceGateOK(%v) = %v, want %v", tt.name, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AIAuthToken = "hunter2"
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []string{string(b), fmt.Sprintf("%+v", cfg)} {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("token leaked: %s", out)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import "time"
+
+// lineBucketPx is the height of the Y buckets used to recognise "the same
+// line" across frames; a line's reported Y wobbles by a pixel or two between
+// polls.
+const lineBucketPx = 10
+
+// lineKey identifies a line across frames by display, color and Y bucket.
+type lineKey struct {
+	display int
+	color   string
+	bucket  int
+}
+
+func keyForLine(display int, l Line) lineKey {
+	return lineKey{display: display, color: l.Color, bucket: l.Y / lineBucketPx}
+}
+
+// maxConfirmWeight is the most one frame can count towards ConfirmFrames; a
+// line detected with at least this confidence confirms twice as fast as a
+// borderline one.
+const maxConfirmWeight = 2.0
+
+// confirmTracker counts how many consecutive frames the bubble-at-line
+// condition has held for each line, so a single noisy frame can't fire an
+// alert on its own. Frames are weighted by how confidently the line was
+// detected.
+type confirmTracker struct {
+	counts map[lineKey]float64
+	seen   map[lineKey]bool // hit during the current frame
+}
+
+func newConfirmTracker() *confirmTracker {
+	return &confirmTracker{counts: map[lineKey]float64{}, seen: map[lineKey]bool{}}
+}
+
+// hit records that the condition held for key this frame, for a line of the
+// given confidence (see Line.Confidence), and returns the weighted number of
+// consecutive frames it has now held.
+func (t *confirmTracker) hit(key lineKey, confidence float64) float64 {
+	if !t.seen[key] {
+		t.seen[key] = true
+		t.counts[key] += min(max(confidence, 1), maxConfirmWeight)
+	}
+	return t.counts[key]
+}
+
+// endFrame resets every line that wasn't hit since the previous endFrame.
+func (t *confirmTracker) endFrame() {
+	for key := range t.counts {
+		if !t.seen[key] {
+			delete(t.counts, key)
+		}
+	}
+	clear(t.seen)
+}
+
+// sustainTracker remembers since when the bubble-at-line condition has held
+// for each line, across consecutive frames, for AlertEscalation. Like
+// confirmTracker it forgets a line as soon as a frame goes by without it.
+type sustainTracker struct {
+	since map[lineKey]time.Time
+	seen  map[lineKey]bool // hit during the current frame
+}
+
+func newSustainTracker() *sustainTracker {
+	return &sustainTracker{since: map[lineKey]time.Time{}, seen: map[lineKey]bool{}}
+}
+
+// hit records that the condition holds for key at now and returns how long
+// it has held without a break.
+func (t *sustainTracker) hit(key lineKey, now time.Time) time.Duration {
+	t.seen[key] = true
+	since, ok := t.since[key]
+	if !ok {
+		t.since[key] = now
+		return 0
+	}
+	return now.Sub(since)
+}
+
+// endFrame resets every line that wasn't hit since the previous endFrame.
+func (t *sustainTracker) endFrame() {
+	for key := range t.since {
+		if !t.seen[key] {
+			delete(t.since, key)
+		}
+	}
+	clear(t.seen)
+}
+
+// alertCooldown throttles repeat alerts: once an alert fires for a line, the
+// same kind of alert for that line (same display, color and Y bucket) is held
+// back for period. Other lines, including a different color at the same level,
+// keep their own timers, so a busy blue line can't suppress a red one.
+type alertCooldown struct {
+	period time.Duration // 0 disables the cooldown
+	last   map[cooldownKey]time.Time
+}
+
+type cooldownKey struct {
+	kind string
+	line lineKey
+}
+
+func newAlertCooldown(period time.Duration) *alertCooldown {
+	return &alertCooldown{period: period, last: map[cooldownKey]time.Time{}}
+}
+
+// allow reports whether an alert of kind for key may fire at now, and if so
+// starts its cooldown.
+func (c *alertCooldown) allow(kind string, key lineKey, now time.Time) bool {
+	if c.period <= 0 {
+		return true
+	}
+	k := cooldownKey{kind, key}
+	if t, ok := c.last[k]; ok && now.Sub(t) < c.period {
+		return false
+	}
+	for k, t := range c.last {
+		if now.Sub(t) >= c.period {
+			delete(c.last, k) // expired; keeps the map from growing
+		}
+	}
+	c.last[k] = now
+	return true
+}
+
+// rearmTracker makes bubble alerts edge-triggered for RearmAfterClearPolls:
+// once one fires for a line, that line is disarmed until its bubble has been
+// gone for clearPolls polls in a row, however long it stays. Unlike
+// alertCooldown it waits for the condition to clear, not for time to pass.
+type rearmTracker struct {
+	disarmed map[lineKey]int  // per line that alerted, consecutive polls since without its bubble
+	seen     map[lineKey]bool // bubble seen during the current poll
+}
+
+func newRearmTracker() *rearmTracker {
+	return &rearmTracker{disarmed: map[lineKey]int{}, seen: map[lineKey]bool{}}
+}
+
+// hit records that key's bubble is present this poll.
+func (t *rearmTracker) hit(key lineKey) {
+	t.seen[key] = true
+}
+
+// armed reports whether a bubble alert may fire for key.
+func (t *rearmTracker) armed(key lineKey) bool {
+	_, disarmed := t.disarmed[key]
+	return !disarmed
+}
+
+// fired disarms key after its alert.
+func (t *rearmTracker) fired(key lineKey) {
+	t.disarmed[key] = 0
+}
+
+// endFrame counts another clear poll for every disarmed line whose bubble
+// wasn't seen since the previous endFrame, re-arming those clear for
+// clearPolls, and starts the count over for the rest. clearPolls 0 re-arms
+// everything.
+func (t *rearmTracker) endFrame(clearPolls int) {
+	for key, n := range t.disarmed {
+		switch {
+		case t.seen[key]:
+			t.disarmed[key] = 0
+		case n+1 >= clearPolls:
+			delete(t.disarmed, key)
+		default:
+			t.disarmed[key] = n + 1
+		}
+	}
+	clear(t.seen)
+}
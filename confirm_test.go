@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestConfirmTracker(t *testing.T) {
+	tr := newConfirmTracker()
+	red := lineKey{color: "red", bucket: 15}
+	blue := lineKey{color: "blue", bucket: 15}
+
+	// frame 1: both lines hit
+	if n := tr.hit(red, 1); n != 1 {
+		t.Fatalf("red after 1 frame = %v, want 1", n)
+	}
+	tr.hit(blue, 1)
+	tr.endFrame()
+
+	// frame 2: only red; a duplicate hit in the same frame doesn't count twice
+	tr.hit(red, 1)
+	if n := tr.hit(red, 1); n != 2 {
+		t.Fatalf("red after 2 frames = %v, want 2", n)
+	}
+	tr.endFrame()
+
+	// frame 3: blue was missing in frame 2, so it starts over
+	if n := tr.hit(blue, 1); n != 1 {
+		t.Errorf("blue after a missed frame = %v, want 1", n)
+	}
+	if n := tr.hit(red, 1); n != 3 {
+		t.Errorf("red after 3 frames = %v, want 3", n)
+	}
+}
+
+func TestConfirmTrackerWeightsConfidence(t *testing.T) {
+	tr := newConfirmTracker()
+	key := lineKey{color: "red", bucket: 15}
+
+	// a strong line counts double, but no more than maxConfirmWeight
+	if n := tr.hit(key, 4); n != maxConfirmWeight {
+		t.Fatalf("after one strong frame = %v, want %v", n, maxConfirmWeight)
+	}
+	tr.endFrame()
+	if n := tr.hit(key, 1.5); n != maxConfirmWeight+1.5 {
+		t.Errorf("after a medium frame = %v, want %v", n, maxConfirmWeight+1.5)
+	}
+}
+
+func TestSustainTracker(t *testing.T) {
+	tr := newSustainTracker()
+	key := lineKey{color: "red", bucket: 15}
+	start := time.Now()
+
+	for i, want := range []time.Duration{0, time.Minute, 2 * time.Minute} {
+		if d := tr.hit(key, start.Add(time.Duration(i)*time.Minute)); d != want {
+			t.Errorf("frame %d: sustained %s, want %s", i, d, want)
+		}
+		tr.endFrame()
+	}
+
+	tr.endFrame() // a frame without the bubble
+	if d := tr.hit(key, start.Add(5*time.Minute)); d != 0 {
+		t.Errorf("after the condition cleared: sustained %s, want it to start over", d)
+	}
+}
+
+func TestAlertCooldownPerColor(t *testing.T) {
+	c := newAlertCooldown(time.Minute)
+	red := keyForLine(0, Line{Y: 150, Color: "red"})
+	blue := keyForLine(0, Line{Y: 152, Color: "blue"}) // same level, other color
+	t0 := time.Now()
+
+	if !c.allow(alertBubble, red, t0) {
+		t.Fatal("first red alert held back")
+	}
+	// blue keeps firing; each repeat inside the minute is held back...
+	if !c.allow(alertBubble, blue, t0.Add(time.Second)) {
+		t.Fatal("first blue alert held back by red's cooldown")
+	}
+	if c.allow(alertBubble, blue, t0.Add(10*time.Second)) {
+		t.Error("repeat blue alert allowed inside its cooldown")
+	}
+	// ...without touching red's timer
+	if c.allow(alertBubble, red, t0.Add(30*time.Second)) {
+		t.Error("repeat red alert allowed inside its cooldown")
+	}
+	if !c.allow(alertCrossing, red, t0.Add(30*time.Second)) {
+		t.Error("crossing alert held back by the bubble cooldown")
+	}
+	if !c.allow(alertBubble, red, t0.Add(time.Minute)) {
+		t.Error("red alert still held back after the cooldown")
+	}
+
+	off := newAlertCooldown(0)
+	if !off.allow(alertBubble, red, t0) || !off.allow(alertBubble, red, t0) {
+		t.Error("a zero cooldown held an alert back")
+	}
+}
+
+func TestRearmAfterClearPolls(t *testing.T) {
+	on := newFixture(150, image.Rect(330, 145, 350, 155))
+	off := newFixture(150, image.Rectangle{})
+	cfg := testConfig()
+	cfg.AlertCooldown = 0
+	cfg.RearmAfterClearPolls = 2
+
+	w := newTestWatcher(cfg, nil)
+	var frame *image.RGBA
+	w.capture = func(int) (image.Image, error) { return frame, nil }
+	steps := []struct {
+		frame *image.RGBA
+		alert bool
+		why   string
+	}{
+		{on, true, "armed at start"},
+		{on, false, "disarmed while the bubble stays"},
+		{off, false, "one clear poll"},
+		{on, false, "back before it cleared for two polls"},
+		{off, false, "clear count starts over"},
+		{off, false, "second clear poll re-arms"},
+		{on, true, "re-armed"},
+		{on, false, "disarmed again"},
+	}
+	for i, s := range steps {
+		frame = s.frame
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(res.Alerts) > 0; got != s.alert {
+			t.Errorf("poll %d (%s): alert = %v, want %v", i+1, s.why, got, s.alert)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+
+	"github.com/kbinani/screenshot"
+)
+
+// cursorInCapture returns where the mouse cursor is in a capture of display
+// with the given bounds, for IgnoreCursorRegion. It reports false when the
+// platform can't tell (see cursorPosition), for window captures, and when
+// the cursor is elsewhere on the desktop.
+func cursorInCapture(cfg Config, display int, bounds image.Rectangle) (image.Point, bool) {
+	screen, ok := captureScreenRect(cfg, display)
+	if !ok || screen.Empty() {
+		return image.Point{}, false
+	}
+	pos, err := cursorPosition()
+	if err != nil {
+		slog.Debug("cursor position unavailable", "err", err)
+		return image.Point{}, false
+	}
+	if !pos.In(screen) {
+		return image.Point{}, false
+	}
+	// a Retina capture has more pixels than the screen has points
+	return image.Pt(
+		bounds.Min.X+(pos.X-screen.Min.X)*bounds.Dx()/screen.Dx(),
+		bounds.Min.Y+(pos.Y-screen.Min.Y)*bounds.Dy()/screen.Dy(),
+	), true
+}
+
+// captureScreenRect is the part of the virtual desktop captureTarget grabs
+// for display. Windows are looked up afresh on every capture, so they have
+// none.
+func captureScreenRect(cfg Config, display int) (image.Rectangle, bool) {
+	if cfg.TargetWindowTitle != "" {
+		return image.Rectangle{}, false
+	}
+	if !cfg.CaptureRegion.Empty() {
+		rect, err := captureRegionRect(cfg, display)
+		return rect, err == nil
+	}
+	if display < 0 || display >= screenshot.NumActiveDisplays() {
+		return image.Rectangle{}, false
+	}
+	return screenshot.GetDisplayBounds(display), true
+}
+
+// maskCursor returns a copy of img with the square of the given radius
+// around p painted over, so a red cursor or crosshair can't pass for a line
+// and a white one for a bubble. Each row of the square takes the color of
+// the pixel just left of it (right, at the image's edge), which carries a
+// line running under the cursor straight through. img itself is returned
+// when the square misses it.
+func maskCursor(img image.Image, p image.Point, radius int) image.Image {
+	b := img.Bounds()
+	mask := image.Rect(p.X-radius, p.Y-radius, p.X+radius+1, p.Y+radius+1).Intersect(b)
+	if mask.Empty() {
+		return img
+	}
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+	for y := mask.Min.Y; y < mask.Max.Y; y++ {
+		var fill color.Color = color.Black
+		if mask.Min.X > b.Min.X {
+			fill = out.At(mask.Min.X-1, y)
+		} else if mask.Max.X < b.Max.X {
+			fill = out.At(mask.Max.X, y)
+		}
+		draw.Draw(out, image.Rect(mask.Min.X, y, mask.Max.X, y+1), &image.Uniform{fill}, image.Point{}, draw.Src)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"os/exec"
+	"strings"
+)
+
+// cursorScript prints the mouse position as "x,y" in screen points, top-left
+// origin like the display bounds (AppKit counts from the bottom of the main
+// screen).
+const cursorScript = `ObjC.import("AppKit");
+var p = $.NSEvent.mouseLocation;
+var h = $.NSScreen.screens.objectAtIndex(0).frame.size.height;
+Math.round(p.x) + "," + Math.round(h - p.y);`
+
+// cursorPosition returns the mouse cursor's position on the virtual desktop,
+// asking AppKit through osascript.
+func cursorPosition() (image.Point, error) {
+	out, err := exec.Command("osascript", "-l", "JavaScript", "-e", cursorScript).Output()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("cursor lookup failed: %w", err)
+	}
+	var p image.Point
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d,%d", &p.X, &p.Y); err != nil {
+		return image.Point{}, fmt.Errorf("unexpected cursor lookup output %q", out)
+	}
+	return p, nil
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"os/exec"
+)
+
+// cursorPosition returns the mouse cursor's position on the virtual desktop,
+// from xdotool (X11 only; Wayland doesn't expose it).
+func cursorPosition() (image.Point, error) {
+	out, err := exec.Command("xdotool", "getmouselocation").Output()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("cursor lookup failed: %w", err)
+	}
+	var p image.Point
+	if _, err := fmt.Sscanf(string(out), "x:%d y:%d", &p.X, &p.Y); err != nil {
+		return image.Point{}, fmt.Errorf("unexpected cursor lookup output %q", out)
+	}
+	return p, nil
+}
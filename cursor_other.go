@@ -0,0 +1,11 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import "image"
+
+// cursorPosition has no implementation on this platform, which makes
+// IgnoreCursorRegion a no-op.
+func cursorPosition() (image.Point, error) {
+	return image.Point{}, errString("the cursor position is only available on macOS, Linux and Windows")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestIgnoreCursorRegion(t *testing.T) {
+	// a red cursor blob in the middle of an otherwise empty chart
+	img := newFixture(-1, image.Rectangle{})
+	draw.Draw(img, image.Rect(200, 100, 240, 116), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+
+	cfg := testConfig()
+	cfg.MinRedRunLength, cfg.MinRedPixelsPerRow = 30, 30
+	w := newTestWatcher(cfg, img)
+	w.cursor = func(int, image.Rectangle) (image.Point, bool) { return image.Pt(215, 108), true }
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.RedLineFound {
+		t.Fatal("the cursor blob isn't detected as a line without IgnoreCursorRegion; the test proves nothing")
+	}
+
+	w.cfg.IgnoreCursorRegion = true
+	if res, _ := w.checkOnce(context.Background()); res.RedLineFound {
+		t.Errorf("masked cursor still detected as a line at Y=%d", res.RedLineY)
+	}
+	if img.RGBAAt(215, 108) != fixtureRed {
+		t.Error("masking painted over the captured frame itself")
+	}
+
+	// nothing is masked when the platform can't tell where the cursor is
+	w.cursor = func(int, image.Rectangle) (image.Point, bool) { return image.Point{}, false }
+	if res, _ := w.checkOnce(context.Background()); !res.RedLineFound {
+		t.Error("no cursor position, but the blob was masked anyway")
+	}
+}
+
+func TestMaskCursorKeepsLineUnderCursor(t *testing.T) {
+	img := newFixture(150, image.Rectangle{})
+	draw.Draw(img, image.Rect(190, 130, 210, 170), &image.Uniform{fixtureWhite}, image.Point{}, draw.Src) // a white arrow over the line
+
+	masked := maskCursor(img, image.Pt(200, 150), 24)
+	line, ok := findRedLine(masked, centralROI(img.Bounds(), testConfig().roiMargins()), testConfig())
+	if !ok || line.Y != 150 {
+		t.Fatalf("line = %+v, %v; want the line at Y=150 carried through the mask", line, ok)
+	}
+	if c := masked.At(200, 140); c != fixtureBackground {
+		t.Errorf("pixel above the line inside the mask = %v, want the background %v", c, fixtureBackground)
+	}
+	if maskCursor(img, image.Pt(-100, -100), 24) != image.Image(img) {
+		t.Error("a cursor off the image still made a copy")
+	}
+}
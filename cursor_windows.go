@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"os/exec"
+	"strings"
+)
+
+// cursorScript prints the mouse position as "x,y".
+const cursorScript = `Add-Type -AssemblyName System.Windows.Forms; ` +
+	`$p = [System.Windows.Forms.Cursor]::Position; "$($p.X),$($p.Y)"`
+
+// cursorPosition returns the mouse cursor's position on the virtual desktop,
+// through PowerShell.
+func cursorPosition() (image.Point, error) {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", cursorScript).Output()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("cursor lookup failed: %w", err)
+	}
+	var p image.Point
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d,%d", &p.X, &p.Y); err != nil {
+		return image.Point{}, fmt.Errorf("unexpected cursor lookup output %q", out)
+	}
+	return p, nil
+}
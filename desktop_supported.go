@@ -0,0 +1,7 @@
+//go:build linux || freebsd || netbsd || openbsd || windows || darwin || illumos
+
+package main
+
+// desktopSupported reports whether beeep can show notifications and beep on
+// this platform. Its build constraint mirrors beeep's own.
+const desktopSupported = true
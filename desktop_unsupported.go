@@ -0,0 +1,7 @@
+//go:build !linux && !freebsd && !netbsd && !openbsd && !windows && !darwin && !illumos
+
+package main
+
+// desktopSupported reports whether beeep can show notifications and beep on
+// this platform; here it can't, so newNotifiers leaves the beep notifier out.
+const desktopSupported = false
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// ColorProfile classifies a pixel as belonging to a line of a given color,
+// either by an RGB box, with Config.ColorSpace "hsv" by a hue band plus
+// minimum saturation and value, or with "lab" by its distance from a target
+// color.
+type ColorProfile struct {
+	Name       string
+	MinR, MaxR uint8
+	MinG, MaxG uint8
+	MinB, MaxB uint8
+
+	HueMin, HueMax float64 // degrees; HueMin > HueMax wraps through 0 (red)
+	MinSat, MinVal float64 // 0-1
+
+	// set by lineProfiles from Config.ColorSpace
+	hsv, lab     bool
+	target       labColor // lab: LineTargetColor, or the middle of a LineColors box
+	labTolerance float64
+}
+
+// Ready-made profiles for Bookmap's bid levels and green markers; add them to
+// Config.LineColors (together with a red profile) to scan for them too.
+var (
+	blueLineProfile = ColorProfile{Name: "blue", MaxR: 120, MaxG: 160, MinB: 180, MaxB: 255,
+		HueMin: 200, HueMax: 250, MinSat: 0.5, MinVal: 0.4}
+	greenLineProfile = ColorProfile{Name: "green", MaxR: 120, MinG: 180, MaxG: 255, MaxB: 120,
+		HueMin: 90, HueMax: 150, MinSat: 0.5, MinVal: 0.4}
+)
+
+// Line is a horizontal line found in a frame.
+type Line struct {
+	Y         int        // centroid of the line's band of rows; see refineLine
+	Thickness int        // rows in that band
+	Color     string     // name of the ColorProfile that matched
+	Pixels    int        // matching pixels in the band's strongest row
+	RunLength int        // longest contiguous run of matching pixels in that row
+	CenterX   int        // middle of that run (count mode: of the matched span)
+	EndX      int        // rightmost matching pixel in that row, where the line ends
+	RGB       color.RGBA // mean color of the matching pixels in that row
+
+	// Confidence is the row's score over the detection threshold: 1 is a
+	// borderline match, maxLineConfidence an unmistakable one (the cap).
+	Confidence float64
+}
+
+// maxLineConfidence caps Line.Confidence, so one very long line doesn't read
+// as infinitely more certain than a merely clear one.
+const maxLineConfidence = 5.0
+
+// Line detection modes.
+const (
+	lineModeRun   = "run"   // longest contiguous run >= MinRedRunLength
+	lineModeCount = "count" // total matching pixels >= MinRedPixelsPerRow
+	lineModeEdge  = "edge"  // matching pixels redder than a vertical neighbour >= MinRedPixelsPerRow
+)
+
+// countsPixels reports whether cfg.LineDetectMode scores a row by its number
+// of matching pixels rather than by its longest run.
+func (cfg Config) countsPixels() bool {
+	return cfg.LineDetectMode == lineModeCount || cfg.LineDetectMode == lineModeEdge
+}
+
+// rowStat describes the matching pixels of one ROI row.
+type rowStat struct {
+	count       int // matching pixels
+	first, last int // X of the first and last match; -1 when count is 0
+	runLen      int // longest contiguous run
+	runStart    int // X where that run starts
+
+	// the gaps between runs, for DetectDashed
+	gaps             int
+	gapSum, gapSqSum int
+}
+
+// Dashed lines (see Config.dashedLine) need at least dashedMinDashes dashes
+// covering at least dashedMinFill of the span between the first and the last,
+// so a few evenly spaced specks don't make a line.
+const (
+	dashedMinDashes = 5
+	dashedMinFill   = 0.2
+)
+
+// dashedLine reports whether st, which falls short of the line threshold,
+// looks like a dashed or dotted line: with DetectDashed, enough dashes whose
+// gaps vary by at most DashedGapTolerance (stddev over mean) and which span
+// at least the threshold between the first and the last.
+func (cfg Config) dashedLine(st rowStat) bool {
+	if !cfg.DetectDashed || st.gaps+1 < dashedMinDashes {
+		return false
+	}
+	span := st.last - st.first + 1
+	if span < cfg.lineThreshold() || float64(st.count) < dashedMinFill*float64(span) {
+		return false
+	}
+	mean := float64(st.gapSum) / float64(st.gaps)
+	variance := float64(st.gapSqSum)/float64(st.gaps) - mean*mean
+	return math.Sqrt(max(variance, 0)) <= cfg.DashedGapTolerance*mean
+}
+
+// lineScore is the strength of a row under cfg.LineDetectMode, and whether it
+// clears the mode's threshold.
+//
+// Counting every matching pixel lets scattered red UI (buttons, icons) add up
+// to a "line"; requiring one long unbroken run matches what an actual drawn
+// line looks like. Edge mode counts too, but only pixels that stand out from
+// the row above or below, so a reddish background fill doesn't match. A row
+// that falls short but is a dashed line scores the span of its dashes.
+func (cfg Config) lineScore(st rowStat) (int, bool) {
+	score := st.runLen
+	if cfg.countsPixels() {
+		score = st.count
+	}
+	if score < cfg.lineThreshold() && cfg.dashedLine(st) {
+		score = st.last - st.first + 1
+	}
+	return score, score >= cfg.lineThreshold()
+}
+
+// lineThreshold is the minimum lineScore under cfg.LineDetectMode.
+func (cfg Config) lineThreshold() int {
+	if cfg.countsPixels() {
+		return cfg.MinRedPixelsPerRow
+	}
+	return cfg.MinRedRunLength
+}
+
+// lineConfidence turns a qualifying score into Line.Confidence.
+func (cfg Config) lineConfidence(score int) float64 {
+	threshold := cfg.lineThreshold()
+	if threshold <= 0 {
+		return maxLineConfidence
+	}
+	return min(float64(score)/float64(threshold), maxLineConfidence)
+}
+
+// withROIThresholds resolves thresholds given relative to the ROI into
+// absolute pixel counts: MinRedPixelsPerRowFraction, when set, replaces
+// MinRedPixelsPerRow with that fraction of the ROI width.
+func (cfg Config) withROIThresholds(roi image.Rectangle) Config {
+	if cfg.MinRedPixelsPerRowFraction > 0 {
+		cfg.MinRedPixelsPerRow = int(cfg.MinRedPixelsPerRowFraction * float64(roi.Dx()))
+	}
+	return cfg
+}
+
+// newLine builds the Line reported for row y.
+func newLine(y int, p ColorProfile, st rowStat, cfg Config) Line {
+	l := Line{Y: y, Color: p.Name, Pixels: st.count, RunLength: st.runLen, EndX: st.last}
+	if cfg.countsPixels() || st.runLen < cfg.lineThreshold() { // counted, or dashed
+		l.CenterX = (st.first + st.last) / 2
+	} else {
+		l.CenterX = st.runStart + st.runLen/2
+	}
+	score, _ := cfg.lineScore(st)
+	l.Confidence = cfg.lineConfidence(score)
+	return l
+}
+
+// refineLine re-centers l, found at the strongest qualifying row stats[i] of a
+// scan starting at row y0, on its whole band: the contiguous qualifying rows
+// around it. Y becomes the score-weighted centroid of the band, so a thick
+// line is reported at its middle rather than at whichever row happened to
+// score highest.
+func refineLine(l Line, stats []rowStat, i, y0 int, cfg Config) Line {
+	top, bottom := i, i
+	for top > 0 {
+		if _, ok := cfg.lineScore(stats[top-1]); !ok {
+			break
+		}
+		top--
+	}
+	for bottom < len(stats)-1 {
+		if _, ok := cfg.lineScore(stats[bottom+1]); !ok {
+			break
+		}
+		bottom++
+	}
+
+	var sum, weighted int
+	for j := top; j <= bottom; j++ {
+		score, _ := cfg.lineScore(stats[j])
+		sum += score
+		weighted += j * score
+	}
+	if sum > 0 {
+		l.Y = y0 + (weighted+sum/2)/sum
+	}
+	l.Thickness = bottom - top + 1
+	return l
+}
+
+// lineProfiles returns the colors to scan for. With no LineColors configured
+// it falls back to the single red/orange profile built from RedMinR etc. and
+// the RedHue* fields.
+func (cfg Config) lineProfiles() []ColorProfile {
+	profiles := cfg.LineColors
+	if len(profiles) == 0 {
+		profiles = []ColorProfile{{
+			Name: "red",
+			MinR: cfg.RedMinR, MaxR: 255,
+			MinG: 0, MaxG: cfg.RedMaxG,
+			MinB: 0, MaxB: cfg.RedMaxB,
+			HueMin: cfg.RedHueMin, HueMax: cfg.RedHueMax,
+			MinSat: cfg.RedMinSat, MinVal: cfg.RedMinVal,
+		}}
+	}
+
+	out := make([]ColorProfile, len(profiles))
+	for i, p := range profiles {
+		p.hsv = cfg.ColorSpace == colorSpaceHSV
+		if p.lab = cfg.ColorSpace == colorSpaceLab; p.lab {
+			c := cfg.LineTargetColor
+			if len(cfg.LineColors) > 0 {
+				c = color.RGBA{R: mid(p.MinR, p.MaxR), G: mid(p.MinG, p.MaxG), B: mid(p.MinB, p.MaxB)}
+			}
+			p.target, p.labTolerance = rgbToLab(c.R, c.G, c.B), cfg.LabTolerance
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// findRedLine returns the single strongest line in ROI, across all profiles.
+func findRedLine(img image.Image, roi image.Rectangle, cfg Config) (Line, bool) {
+	cfg = cfg.withROIThresholds(roi)
+	roi = cfg.lineScanRows(roi)
+	best, bestScore := Line{Y: -1}, 0
+	var bestRow int
+	var bestProfile ColorProfile
+	for _, p := range cfg.lineProfiles() {
+		stats := lineRowStats(img, roi, p, cfg)
+		for i, st := range stats {
+			if score, ok := cfg.lineScore(st); ok && score > bestScore {
+				best, bestScore = refineLine(newLine(roi.Min.Y+i, p, st, cfg), stats, i, roi.Min.Y, cfg), score
+				bestRow, bestProfile = roi.Min.Y+i, p
+			}
+		}
+	}
+
+	if best.Y >= 0 {
+		best.RGB = meanLineColor(img, bestRow, roi.Min.X, roi.Max.X, bestProfile, cfg.ScanStride)
+		logLine(best)
+		return best, true
+	}
+	return Line{}, false
+}
+
+// findRedLines returns every line in ROI for every profile. Qualifying rows
+// closer than cfg.LineMergeGap are merged and reported once, centered on the
+// band around their strongest row (see refineLine).
+func findRedLines(img image.Image, roi image.Rectangle, cfg Config) []Line {
+	return findRedLinesCached(img, roi, cfg, nil)
+}
+
+// findRedLinesCached is findRedLines with DiffScan: cache, if not nil, holds
+// the display's previous scan and only the rows that changed since are
+// scanned again.
+func findRedLinesCached(img image.Image, roi image.Rectangle, cfg Config, cache *rowCache) []Line {
+	cfg = cfg.withROIThresholds(roi)
+	roi = cfg.lineScanRows(roi)
+	profiles := cfg.lineProfiles()
+	if cache != nil {
+		cache.begin(img, roi, profiles, cfg)
+	}
+	var lines []Line
+	for i, p := range profiles {
+		stats := cache.rowStats(img, roi, i, p, cfg)
+		best, bestScore, bestIdx, lastY := Line{Y: -1}, 0, -1, -1
+		flush := func() {
+			if best.Y >= 0 {
+				best = refineLine(best, stats, bestIdx, roi.Min.Y, cfg)
+				best.RGB = meanLineColor(img, roi.Min.Y+bestIdx, roi.Min.X, roi.Max.X, p, cfg.ScanStride)
+				lines = append(lines, best)
+				logLine(best)
+			}
+			best, bestScore = Line{Y: -1}, 0
+		}
+		for i, st := range stats {
+			score, ok := cfg.lineScore(st)
+			if !ok {
+				continue
+			}
+			y := roi.Min.Y + i
+			if lastY >= 0 && y-lastY > cfg.LineMergeGap {
+				flush()
+			}
+			if score > bestScore {
+				best, bestScore, bestIdx = newLine(y, p, st, cfg), score, i
+			}
+			lastY = y
+		}
+		flush()
+	}
+	return lines
+}
+
+// lineScanRows narrows roi to the LineScanYRange rows lines are looked for
+// in, keeping at least one.
+func (cfg Config) lineScanRows(roi image.Rectangle) image.Rectangle {
+	h := float64(roi.Dy())
+	roi.Min.Y, roi.Max.Y = clampSpan(roi.Min.Y, roi.Max.Y,
+		roi.Min.Y+int(h*cfg.LineScanYRange[0]), roi.Min.Y+int(math.Ceil(h*cfg.LineScanYRange[1])))
+	return roi
+}
+
+// logLine emits the line_found event for l.
+func logLine(l Line) {
+	slog.Info(l.Color+" line found", "event", eventLine, "color", l.Color, "lineY", l.Y,
+		"redPixels", l.Pixels, "runLength", l.RunLength, "centerX", l.CenterX, "thickness", l.Thickness, "confidence", l.Confidence, "rgb", hexColor(l.RGB))
+}
+
+// lineRowStats scans each ROI row for pixels matching p, indexed from
+// roi.Min.Y. cfg.ScanStride samples every stride-th pixel of a row (see
+// scanLineRow); every row is still scanned, since a line may be a single
+// pixel tall.
+//
+// On a big ROI the rows are split into bands scanned in parallel (see
+// Config.scanWorkers). Each band fills its own part of the result, and the
+// callers pick the best row from it in order as before, so the outcome is the
+// same as a serial scan, ties going to the lowest Y.
+func lineRowStats(img image.Image, roi image.Rectangle, p ColorProfile, cfg Config) []rowStat {
+	stats := make([]rowStat, roi.Dy())
+	scanRows := func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			stats[y-roi.Min.Y] = scanRowStat(img, y, roi, p, cfg)
+		}
+	}
+
+	bands := min(cfg.scanWorkers(), roi.Dy()/minRowsPerWorker)
+	if bands <= 1 {
+		scanRows(roi.Min.Y, roi.Max.Y)
+		return stats
+	}
+	var wg sync.WaitGroup
+	size := (roi.Dy() + bands - 1) / bands
+	for y0 := roi.Min.Y; y0 < roi.Max.Y; y0 += size {
+		wg.Go(func() { scanRows(y0, min(y0+size, roi.Max.Y)) })
+	}
+	wg.Wait()
+	return stats
+}
+
+// scanRowStat scans row y of roi for pixels matching p under LineDetectMode.
+func scanRowStat(img image.Image, y int, roi image.Rectangle, p ColorProfile, cfg Config) rowStat {
+	if cfg.LineDetectMode == lineModeEdge {
+		return scanEdgeRow(img, y, roi.Min.X, roi.Max.X, p, cfg.ScanStride, cfg.EdgeContrastDelta)
+	}
+	return scanLineRow(img, y, roi.Min.X, roi.Max.X, p, cfg.ScanStride)
+}
+
+// minRowsPerWorker is the fewest rows worth handing to a goroutine of its
+// own; smaller ROIs are scanned serially.
+const minRowsPerWorker = 64
+
+// scanWorkers is how many goroutines the line scan may use: ScanWorkers, or
+// GOMAXPROCS when that is 0.
+func (cfg Config) scanWorkers() int {
+	if cfg.ScanWorkers > 0 {
+		return cfg.ScanWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// findRedColumn returns the X of the strongest vertical line in ROI (e.g.
+// Bookmap's time cursor), across all profiles.
+func findRedColumn(img image.Image, roi image.Rectangle, cfg Config) (int, bool) {
+	bestX, bestCount := -1, 0
+	for _, p := range cfg.lineProfiles() {
+		for x := roi.Min.X; x < roi.Max.X; x++ {
+			col := image.Rect(x, roi.Min.Y, x+1, roi.Max.Y)
+			count := countLinePixels(img, col, p)
+			if count > bestCount && count >= cfg.MinRedPixelsPerCol {
+				bestX, bestCount = x, count
+			}
+		}
+	}
+
+	if bestX >= 0 {
+		slog.Info("vertical line found", "event", eventLine, "lineX", bestX, "redPixels", bestCount)
+		return bestX, true
+	}
+	return 0, false
+}
+
+// pixelMatches reports whether the pixel at (x, y) falls inside p.
+func pixelMatches(img image.Image, x, y int, p ColorProfile) bool {
+	r, g, b := rgbAt(img, x, y)
+	return isLineColor(r, g, b, p)
+}
+
+// crossesLine reports whether the vertical line at x reaches line's row.
+func crossesLine(img image.Image, x int, line Line, cfg Config) bool {
+	for _, p := range cfg.lineProfiles() {
+		if pixelMatches(img, x, line.Y, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// mid is the middle of the channel range [lo,hi].
+func mid(lo, hi uint8) uint8 {
+	return uint8((int(lo) + int(hi)) / 2)
+}
+
+func isLineColor(r, g, b uint8, p ColorProfile) bool {
+	if p.hsv {
+		return hsvMatch(r, g, b, p)
+	}
+	if p.lab {
+		return labMatch(r, g, b, p)
+	}
+	// for the default red profile: strong R, limited G/B → red/orange heat lines
+	return r >= p.MinR && r <= p.MaxR &&
+		g >= p.MinG && g <= p.MaxG &&
+		b >= p.MinB && b <= p.MaxB
+}
+
+// Bubble is the bright blob found next to a line.
+type Bubble struct {
+	BrightPixels int
+	Bounds       image.Rectangle // bounding box of the bright pixels
+}
+
+// Center returns the middle of the bubble's bounding box.
+func (b Bubble) Center() image.Point {
+	return image.Pt((b.Bounds.Min.X+b.Bounds.Max.X)/2, (b.Bounds.Min.Y+b.Bounds.Max.Y)/2)
+}
+
+// bubbleAtLine looks for a bright “bubble” near the right edge at the line's
+// Y, or with BubbleAtLineEnd around where the line ends (see bubbleRegion).
+// With BubblePolarity "dark" it looks for dark pixels instead, for light
+// themes.
+//
+// Just counting bright pixels lets a big white legend or panel pass for a
+// bubble, so the bright pixels must also form a compact blob: their bounding
+// box has to fit the BubbleMin/Max Width/Height bounds of a price pill.
+func bubbleAtLine(img image.Image, roi image.Rectangle, line Line, cfg Config) (Bubble, bool) {
+	slog.Debug("bubbleAtLine", "lineY", line.Y)
+	region := bubbleRegion(roi, line, cfg)
+	var b Bubble
+	b.BrightPixels, b.Bounds = brightBlob(img, region, cfg.withBubbleThreshold(img, roi, region))
+
+	if b.BrightPixels < cfg.BubbleMinBrightPixels {
+		return b, false
+	}
+	if !cfg.bubbleSizeOK(b.Bounds) {
+		slog.Debug("bright blob is not bubble-shaped", "lineY", line.Y, "bounds", b.Bounds)
+		return b, false
+	}
+	slog.Info("bubble detected near line", "event", eventBubble, "lineY", line.Y,
+		"brightPixels", b.BrightPixels, "center", b.Center())
+	return b, true
+}
+
+// bubbleRegion is the part of roi searched for a bubble on line: the
+// bubbleDistances rows above and below it, across the
+// bubbleSearchColumns band or, with BubbleAtLineEnd, BubbleLineEndWindow
+// pixels either side of line.EndX. Tying the search to the line's own end
+// keeps unrelated bright UI elsewhere on the chart edge out of it.
+func bubbleRegion(roi image.Rectangle, line Line, cfg Config) image.Rectangle {
+	xStart, xEnd := bubbleSearchColumns(roi, cfg)
+	if cfg.BubbleAtLineEnd {
+		xStart = max(line.EndX-cfg.BubbleLineEndWindow, roi.Min.X)
+		xEnd = min(line.EndX+cfg.BubbleLineEndWindow+1, roi.Max.X)
+	}
+
+	above, below := cfg.bubbleDistances()
+	yMin := line.Y - above
+	yMax := line.Y + below
+	if yMin < roi.Min.Y {
+		yMin = roi.Min.Y
+	}
+	if yMax > roi.Max.Y {
+		yMax = roi.Max.Y
+	}
+	return image.Rectangle{Min: image.Pt(xStart, yMin), Max: image.Pt(xEnd, yMax)}
+}
+
+// bubbleDistances returns how many rows above and below a line are searched
+// for its bubble: BubbleDistanceAbove and BubbleDistanceBelow, each falling
+// back to MaxDistanceBubbleToLine when unset.
+func (cfg Config) bubbleDistances() (above, below int) {
+	above, below = cfg.MaxDistanceBubbleToLine, cfg.MaxDistanceBubbleToLine
+	if cfg.BubbleDistanceAbove > 0 {
+		above = cfg.BubbleDistanceAbove
+	}
+	if cfg.BubbleDistanceBelow > 0 {
+		below = cfg.BubbleDistanceBelow
+	}
+	return above, below
+}
+
+// bubbleSizeOK reports whether a blob's bounding box fits the configured
+// bubble size. A zero max means unbounded.
+func (cfg Config) bubbleSizeOK(box image.Rectangle) bool {
+	w, h := box.Dx(), box.Dy()
+	return w >= cfg.BubbleMinWidth && (cfg.BubbleMaxWidth == 0 || w <= cfg.BubbleMaxWidth) &&
+		h >= cfg.BubbleMinHeight && (cfg.BubbleMaxHeight == 0 || h <= cfg.BubbleMaxHeight)
+}
+
+// bubbleSearchColumns returns the [xStart, xEnd) band of ROI where price
+// bubbles are expected: BubbleSearchWidthPercent of the width on
+// BubbleSearchSide.
+func bubbleSearchColumns(roi image.Rectangle, cfg Config) (int, int) {
+	band := int(float64(roi.Dx()) * cfg.BubbleSearchWidthPercent)
+	if cfg.BubbleSearchSide == "left" {
+		return roi.Min.X, roi.Min.X + band
+	}
+	return roi.Max.X - band, roi.Max.X
+}
+
+// withBubbleThreshold resolves the bubble brightness threshold for region.
+// With BubbleRelativeBrightness, BubbleBrightThreshold becomes the mean r+g+b
+// of the ROI rows region spans, plus BubbleBrightnessDelta: a bubble only has
+// to stand out from the chart around it, so a light theme's bright background
+// doesn't pass for one everywhere. A dark bubble's BubbleDarkThreshold is
+// that mean minus the delta.
+func (cfg Config) withBubbleThreshold(img image.Image, roi, region image.Rectangle) Config {
+	if cfg.BubbleRelativeBrightness {
+		band := image.Rect(roi.Min.X, region.Min.Y, roi.Max.X, region.Max.Y)
+		mean := meanBrightness(img, band, cfg.ScanStride)
+		cfg.BubbleBrightThreshold = mean + cfg.BubbleBrightnessDelta
+		cfg.BubbleDarkThreshold = mean - cfg.BubbleBrightnessDelta
+	}
+	return cfg
+}
+
+// BubblePolarity values.
+const (
+	bubblePolarityBright = "bright"
+	bubblePolarityDark   = "dark" // dark text or pill on a light theme
+)
+
+// bubbleTest is the per-pixel test for bubble pixels under BubblePolarity.
+func (cfg Config) bubbleTest() func(r, g, b uint8, cfg Config) bool {
+	if cfg.BubblePolarity == bubblePolarityDark {
+		return isBubbleDark
+	}
+	return isBubbleBright
+}
+
+func isBubbleBright(r, g, b uint8, cfg Config) bool {
+	sum := int(r) + int(g) + int(b)
+	return sum >= cfg.BubbleBrightThreshold
+}
+
+func isBubbleDark(r, g, b uint8, cfg Config) bool {
+	sum := int(r) + int(g) + int(b)
+	return sum <= cfg.BubbleDarkThreshold
+}
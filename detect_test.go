@@ -0,0 +1,590 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindRedLine(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(150, image.Rectangle{})
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+	line, ok := findRedLine(img, roi, cfg)
+	if !ok {
+		t.Fatal("findRedLine found no line")
+	}
+	if line.Y != 150 {
+		t.Errorf("line.Y = %d, want 150", line.Y)
+	}
+	if line.Color != "red" {
+		t.Errorf("line.Color = %q, want red", line.Color)
+	}
+	// a 320px run against MinRedRunLength 200
+	if line.Confidence != 1.6 {
+		t.Errorf("line.Confidence = %v, want 1.6", line.Confidence)
+	}
+
+	cfg.MinRedRunLength = 50
+	if line, _ := findRedLine(img, roi, cfg); line.Confidence != maxLineConfidence {
+		t.Errorf("line.Confidence = %v, want the %v cap", line.Confidence, maxLineConfidence)
+	}
+}
+
+func TestFindRedLineColor(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(150, image.Rectangle{})
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	if line, _ := findRedLine(img, roi, cfg); hexColor(line.RGB) != "#e62828" {
+		t.Errorf("line color = %s, want the fixture's #e62828", hexColor(line.RGB))
+	}
+
+	// the right half of the row an orange that still passes RedMaxG
+	draw.Draw(img, image.Rect(200, 150, 400, 151), &image.Uniform{color.RGBA{250, 110, 40, 255}}, image.Point{}, draw.Src)
+	if line, _ := findRedLine(img, roi, cfg); hexColor(line.RGB) != "#f04b28" {
+		t.Errorf("line color = %s, want the red/orange mean #f04b28", hexColor(line.RGB))
+	}
+	if lines := findRedLines(img, roi, cfg); len(lines) != 1 || hexColor(lines[0].RGB) != "#f04b28" {
+		t.Errorf("findRedLines = %+v, want one line colored #f04b28", lines)
+	}
+}
+
+func TestFindRedLineNone(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(-1, image.Rectangle{})
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+	if line, ok := findRedLine(img, roi, cfg); ok {
+		t.Errorf("findRedLine found a line at Y=%d on a blank chart", line.Y)
+	}
+}
+
+func TestFindRedLinesMergesThickLine(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(100, image.Rectangle{})
+	draw.Draw(img, image.Rect(0, 101, 400, 104), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 200, 400, 201), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+	lines := findRedLines(img, roi, cfg)
+	if len(lines) != 2 {
+		t.Fatalf("findRedLines found %d lines, want 2: %+v", len(lines), lines)
+	}
+	// the 100-103 band is reported at its centroid, 101.5 rounded
+	if lines[0].Y != 102 || lines[1].Y != 200 {
+		t.Errorf("lines at Y=%d,%d, want 102,200", lines[0].Y, lines[1].Y)
+	}
+	if lines[0].Thickness != 4 || lines[1].Thickness != 1 {
+		t.Errorf("thickness %d,%d, want 4,1", lines[0].Thickness, lines[1].Thickness)
+	}
+}
+
+func TestFindRedLineBandCentroid(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(-1, image.Rectangle{})
+	draw.Draw(img, image.Rect(0, 147, 400, 154), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+	line, ok := findRedLine(img, roi, cfg)
+	if !ok || line.Y != 150 || line.Thickness != 7 {
+		t.Errorf("findRedLine = %+v (found %v), want the middle row Y=150 of a 7-row band", line, ok)
+	}
+	lines := findRedLines(img, roi, cfg)
+	if len(lines) != 1 || lines[0].Y != 150 {
+		t.Errorf("findRedLines = %+v, want one line at Y=150", lines)
+	}
+}
+
+func TestFindRedLineRunMode(t *testing.T) {
+	// row 100: 300px of red in 10px dashes spread across the chart, like a
+	// row of red buttons; row 200: one solid 250px line
+	img := newFixture(-1, image.Rectangle{})
+	for x := 40; x < 360; x += 16 {
+		draw.Draw(img, image.Rect(x, 100, x+15, 101), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	}
+	draw.Draw(img, image.Rect(60, 200, 310, 201), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+
+	cfg := testConfig()
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+	line, ok := findRedLine(img, roi, cfg)
+	if !ok || line.Y != 200 {
+		t.Fatalf("run mode: line = %+v (found %v), want Y=200", line, ok)
+	}
+	if line.RunLength != 250 || line.CenterX != 185 {
+		t.Errorf("run = %d px centred at X=%d, want 250 at 185", line.RunLength, line.CenterX)
+	}
+
+	cfg.LineDetectMode = lineModeCount
+	if line, ok := findRedLine(img, roi, cfg); !ok || line.Y != 100 {
+		t.Errorf("count mode: line = %+v (found %v), want the dashed row at Y=100", line, ok)
+	}
+}
+
+func TestLineScanYRange(t *testing.T) {
+	img := newFixture(150, image.Rectangle{})
+	draw.Draw(img, image.Rect(0, 40, 400, 41), &image.Uniform{fixtureRed}, image.Point{}, draw.Src) // a red toolbar
+
+	t.Setenv("WATCHER_LINE_SCAN_Y_RANGE", "0.33,0.67")
+	cfg, err := LoadConfigFromEnv(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	if rows := cfg.lineScanRows(roi); rows != image.Rect(40, 109, 360, 191) {
+		t.Errorf("scanned rows = %v, want the middle third of %v", rows, roi)
+	}
+	if lines := findRedLines(img, roi, cfg); len(lines) != 1 || lines[0].Y != 150 {
+		t.Errorf("lines = %+v, want just the one at Y=150", lines)
+	}
+	if lines := findRedLines(img, roi, testConfig()); len(lines) != 2 {
+		t.Errorf("the full ROI found %d lines, want the toolbar too", len(lines))
+	}
+
+	cfg.LineScanYRange = [2]float64{0.7, 0.3}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "LineScanYRange") {
+		t.Errorf("Validate err = %v, want one about LineScanYRange", err)
+	}
+}
+
+func TestFindRedLineDashed(t *testing.T) {
+	// row 150: a dashed level, 10px dashes every 16px across the ROI; row 100:
+	// as much red again in irregularly spaced blobs
+	img := newFixture(-1, image.Rectangle{})
+	for x := 40; x < 360; x += 16 {
+		draw.Draw(img, image.Rect(x, 150, x+10, 151), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	}
+	for _, x := range []int{40, 55, 120, 135, 150, 250, 262, 330, 345, 350} {
+		draw.Draw(img, image.Rect(x, 100, x+6, 101), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	}
+
+	cfg := testConfig()
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	if line, ok := findRedLine(img, roi, cfg); ok {
+		t.Fatalf("run mode without DetectDashed found %+v", line)
+	}
+
+	cfg.DetectDashed = true
+	lines := findRedLines(img, roi, cfg)
+	if len(lines) != 1 || lines[0].Y != 150 {
+		t.Fatalf("DetectDashed: lines = %+v, want just the dashed one at Y=150", lines)
+	}
+	if lines[0].CenterX != 196 {
+		t.Errorf("CenterX = %d, want 196, the middle of the dashes", lines[0].CenterX)
+	}
+
+	cfg.DashedGapTolerance = 0
+	if lines := findRedLines(img, roi, cfg); len(lines) != 1 {
+		t.Errorf("perfectly even dashes rejected at tolerance 0: %+v", lines)
+	}
+}
+
+func TestParallelLineScan(t *testing.T) {
+	// the ROI's 240 rows split into three 80-row bands starting at 30, 110
+	// and 190: two equally strong lines, a thick one across a band boundary
+	// and a weaker one at the very edge of a band
+	img := newFixture(60, image.Rectangle{})
+	red := &image.Uniform{fixtureRed}
+	draw.Draw(img, image.Rect(0, 108, 400, 112), red, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 200, 400, 201), red, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(80, 189, 400, 190), red, image.Point{}, draw.Src)
+
+	serial := testConfig()
+	serial.ScanWorkers = 1
+	parallel := testConfig()
+	parallel.ScanWorkers = 4
+	roi := centralROI(img.Bounds(), serial.roiMargins())
+	if bands := min(parallel.scanWorkers(), roi.Dy()/minRowsPerWorker); bands != 3 {
+		t.Fatalf("%d bands, want the fixture split into 3", bands)
+	}
+
+	want, got := findRedLines(img, roi, serial), findRedLines(img, roi, parallel)
+	if len(want) != 4 || !slices.Equal(got, want) {
+		t.Errorf("parallel lines = %+v, want the serial %+v", got, want)
+	}
+	line, _ := findRedLine(img, roi, parallel)
+	if serialLine, _ := findRedLine(img, roi, serial); line != serialLine || line.Y != 60 {
+		t.Errorf("parallel best = %+v, want the serial %+v, the lowest of the tied lines", line, serialLine)
+	}
+}
+
+func TestFindRedLinesEdgeMode(t *testing.T) {
+	// a reddish chart background that passes the red color test everywhere,
+	// with a brighter red line drawn across it at Y=150
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{190, 90, 90, 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 150, 400, 151), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+
+	cfg := testConfig()
+	cfg.LineDetectMode = lineModeCount
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	// count mode sees every row as red and merges them into one "line"
+	if lines := findRedLines(img, roi, cfg); len(lines) != 1 || lines[0].Thickness == 1 {
+		t.Fatalf("count mode: lines = %+v; the fixture should fool it", lines)
+	}
+
+	cfg.LineDetectMode = lineModeEdge
+	lines := findRedLines(img, roi, cfg)
+	if len(lines) != 1 || lines[0].Y != 150 {
+		t.Fatalf("edge mode: lines = %+v, want just the one at Y=150", lines)
+	}
+	if lines[0].Pixels != roi.Dx() {
+		t.Errorf("edge mode: %d edge pixels, want the full %d-px ROI width", lines[0].Pixels, roi.Dx())
+	}
+}
+
+func TestBubbleAtLine(t *testing.T) {
+	cfg := testConfig()
+	roi := centralROI(image.Rect(0, 0, 400, 300), cfg.roiMargins())
+
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+	b, ok := bubbleAtLine(img, roi, Line{Y: 150}, cfg)
+	if !ok {
+		t.Errorf("bubbleAtLine = false (%d bright pixels), want true", b.BrightPixels)
+	}
+	if c := b.Center(); c != image.Pt(340, 150) {
+		t.Errorf("bubble center = %v, want (340,150)", c)
+	}
+
+	far := newFixture(150, image.Rect(330, 60, 350, 70))
+	if b, ok := bubbleAtLine(far, roi, Line{Y: 150}, cfg); ok {
+		t.Errorf("bubbleAtLine = true (%d bright pixels) for a bubble 80px away", b.BrightPixels)
+	}
+
+	// a white panel covering the whole search band has plenty of bright
+	// pixels but is far too wide for a price pill
+	cfg.BubbleMaxWidth = 40
+	panel := newFixture(150, image.Rect(280, 140, 360, 160))
+	if b, ok := bubbleAtLine(panel, roi, Line{Y: 150}, cfg); ok {
+		t.Errorf("bubbleAtLine = true for a %v panel", b.Bounds)
+	}
+	if _, ok := bubbleAtLine(img, roi, Line{Y: 150}, cfg); !ok {
+		t.Error("bubbleAtLine = false for the 20px bubble with BubbleMaxWidth 40")
+	}
+}
+
+func TestBubbleDistanceAboveBelow(t *testing.T) {
+	cfg := testConfig()
+	roi := centralROI(image.Rect(0, 0, 400, 300), cfg.roiMargins())
+	above := newFixture(150, image.Rect(330, 125, 350, 135))
+	below := newFixture(150, image.Rect(330, 165, 350, 175))
+
+	if _, ok := bubbleAtLine(above, roi, Line{Y: 150}, cfg); ok {
+		t.Error("a bubble 15-25px above the line was found with the symmetric 10px band")
+	}
+
+	cfg.BubbleDistanceAbove = 30
+	if _, ok := bubbleAtLine(above, roi, Line{Y: 150}, cfg); !ok {
+		t.Error("BubbleDistanceAbove 30: the bubble above the line wasn't found")
+	}
+	if _, ok := bubbleAtLine(below, roi, Line{Y: 150}, cfg); ok {
+		t.Error("BubbleDistanceAbove 30: the bubble below the line was found with Below unset")
+	}
+
+	cfg.BubbleDistanceAbove, cfg.BubbleDistanceBelow = 0, 30
+	if _, ok := bubbleAtLine(below, roi, Line{Y: 150}, cfg); !ok {
+		t.Error("BubbleDistanceBelow 30: the bubble below the line wasn't found")
+	}
+	if _, ok := bubbleAtLine(above, roi, Line{Y: 150}, cfg); ok {
+		t.Error("BubbleDistanceBelow 30: the bubble above the line was found with Above unset")
+	}
+}
+
+func TestBubbleAtLineEnd(t *testing.T) {
+	// a line ending at X=249 with its price bubble right there, and an
+	// unrelated white widget at the chart's right edge on the same row
+	chart := func(withBubble bool) *image.RGBA {
+		img := newFixture(-1, image.Rect(340, 145, 358, 155))
+		draw.Draw(img, image.Rect(40, 150, 250, 151), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+		if withBubble {
+			draw.Draw(img, image.Rect(250, 145, 270, 155), &image.Uniform{fixtureWhite}, image.Point{}, draw.Src)
+		}
+		return img
+	}
+
+	cfg := testConfig()
+	roi := centralROI(image.Rect(0, 0, 400, 300), cfg.roiMargins())
+	line, ok := findRedLine(chart(true), roi, cfg)
+	if !ok || line.EndX != 249 {
+		t.Fatalf("findRedLine = %+v (found %v), want a line ending at X=249", line, ok)
+	}
+
+	if b, ok := bubbleAtLine(chart(false), roi, line, cfg); !ok {
+		t.Errorf("right-edge band: the widget should pass for a bubble, got %d bright pixels", b.BrightPixels)
+	}
+
+	cfg.BubbleAtLineEnd = true
+	b, ok := bubbleAtLine(chart(true), roi, line, cfg)
+	if !ok || b.Center() != image.Pt(260, 150) {
+		t.Errorf("at line end: bubble %v (found %v), want the one centred at (260,150)", b.Bounds, ok)
+	}
+	if b, ok := bubbleAtLine(chart(false), roi, line, cfg); ok {
+		t.Errorf("at line end: the widget at %v was taken for the bubble", b.Bounds)
+	}
+}
+
+func TestBubbleRelativeBrightness(t *testing.T) {
+	roi := centralROI(image.Rect(0, 0, 400, 300), testConfig().roiMargins())
+	bubble := image.Rect(330, 145, 350, 155)
+	light := func(bubble image.Rectangle) *image.RGBA {
+		img := newFixture(150, bubble)
+		chart := color.RGBA{210, 210, 210, 255} // r+g+b 630, over the absolute 600
+		for y := 0; y < 300; y++ {
+			for x := 0; x < 400; x++ {
+				if img.RGBAAt(x, y) == fixtureBackground {
+					img.SetRGBA(x, y, chart)
+				}
+			}
+		}
+		return img
+	}
+
+	cfg := testConfig()
+	if _, ok := bubbleAtLine(light(image.Rectangle{}), roi, Line{Y: 150}, cfg); !ok {
+		t.Fatal("absolute brightness: the light chart itself should pass for a bubble")
+	}
+
+	cfg.BubbleRelativeBrightness = true
+	tests := []struct {
+		name string
+		img  *image.RGBA
+		want bool
+	}{
+		{"dark with bubble", newFixture(150, bubble), true},
+		{"dark without bubble", newFixture(150, image.Rectangle{}), false},
+		{"light with bubble", light(bubble), true},
+		{"light without bubble", light(image.Rectangle{}), false},
+	}
+	for _, tt := range tests {
+		if b, ok := bubbleAtLine(tt.img, roi, Line{Y: 150}, cfg); ok != tt.want {
+			t.Errorf("%s: bubbleAtLine = %v (%d bright pixels in %v), want %v", tt.name, ok, b.BrightPixels, b.Bounds, tt.want)
+		}
+	}
+}
+
+func TestBubblePolarity(t *testing.T) {
+	roi := centralROI(image.Rect(0, 0, 400, 300), testConfig().roiMargins())
+	bubble := image.Rect(330, 145, 350, 155)
+	// a light theme: pale chart, dark price pill
+	light := func(bubble image.Rectangle) *image.RGBA {
+		img := newFixture(150, image.Rectangle{})
+		for y := 0; y < 300; y++ {
+			for x := 0; x < 400; x++ {
+				if img.RGBAAt(x, y) == fixtureBackground {
+					img.SetRGBA(x, y, color.RGBA{235, 235, 240, 255})
+				}
+			}
+		}
+		draw.Draw(img, bubble, &image.Uniform{color.RGBA{25, 25, 35, 255}}, image.Point{}, draw.Src)
+		return img
+	}
+
+	tests := []struct {
+		name     string
+		polarity string
+		img      *image.RGBA
+		want     bool
+	}{
+		{"bright on dark", bubblePolarityBright, newFixture(150, bubble), true},
+		{"bright, dark chart without bubble", bubblePolarityBright, newFixture(150, image.Rectangle{}), false},
+		{"dark on light", bubblePolarityDark, light(bubble), true},
+		{"dark, light chart without bubble", bubblePolarityDark, light(image.Rectangle{}), false},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.BubblePolarity = tt.polarity
+		if b, ok := bubbleAtLine(tt.img, roi, Line{Y: 150}, cfg); ok != tt.want {
+			t.Errorf("%s: bubbleAtLine = %v (%d pixels in %v), want %v", tt.name, ok, b.BrightPixels, b.Bounds, tt.want)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.BubblePolarity = bubblePolarityDark
+	cfg.BubbleRelativeBrightness = true
+	if _, ok := bubbleAtLine(light(bubble), roi, Line{Y: 150}, cfg); !ok {
+		t.Error("dark bubble not found with BubbleRelativeBrightness")
+	}
+	cfg.BubblePolarity = "inverted"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "BubblePolarity") {
+		t.Errorf("Validate err = %v, want one about BubblePolarity", err)
+	}
+}
+
+func TestScanStride(t *testing.T) {
+	img := newFixture(150, image.Rect(330, 145, 350, 155)) // 200 bright px
+	for _, stride := range []int{2, 3} {
+		cfg := testConfig()
+		cfg.ScanStride = stride
+		roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+		line, ok := findRedLine(img, roi, cfg)
+		if !ok || line.Y != 150 {
+			t.Errorf("stride %d: findRedLine = %+v, %v; want the line at Y=150", stride, line, ok)
+			continue
+		}
+		b, ok := bubbleAtLine(img, roi, line, cfg)
+		if !ok {
+			t.Errorf("stride %d: bubbleAtLine = false (%d bright pixels, %v)", stride, b.BrightPixels, b.Bounds)
+		}
+		if b.BrightPixels < 150 || b.BrightPixels > 250 {
+			t.Errorf("stride %d: %d bright pixels, want about 200", stride, b.BrightPixels)
+		}
+	}
+}
+
+func TestDetectionThresholds(t *testing.T) {
+	img := newFixture(150, image.Rect(330, 145, 350, 155)) // 300 red px in ROI, 200 bright px
+
+	tests := []struct {
+		name       string
+		minRed     int
+		minBright  int
+		wantLine   bool
+		wantBubble bool
+	}{
+		{"both met", 200, 150, true, true},
+		{"exactly at thresholds", 300, 200, true, true},
+		{"line too weak", 400, 150, false, false},
+		{"bubble too small", 200, 250, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.LineDetectMode = lineModeCount
+			cfg.MinRedPixelsPerRow = tt.minRed
+			cfg.BubbleMinBrightPixels = tt.minBright
+			roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+			line, ok := findRedLine(img, roi, cfg)
+			if ok != tt.wantLine {
+				t.Fatalf("findRedLine ok = %v, want %v", ok, tt.wantLine)
+			}
+			if !ok {
+				return
+			}
+			if _, got := bubbleAtLine(img, roi, line, cfg); got != tt.wantBubble {
+				t.Errorf("bubbleAtLine = %v, want %v", got, tt.wantBubble)
+			}
+		})
+	}
+}
+
+func TestMinRedPixelsPerRowFraction(t *testing.T) {
+	img := newFixture(150, image.Rectangle{}) // line spans the whole 320px ROI
+
+	tests := []struct {
+		fraction float64
+		want     bool
+	}{
+		{0.5, true},
+		{1.0, true},
+		{0, false}, // falls back to the absolute MinRedPixelsPerRow
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.LineDetectMode = lineModeCount
+		cfg.MinRedPixelsPerRow = 1000 // wider than the ROI
+		cfg.MinRedPixelsPerRowFraction = tt.fraction
+		roi := centralROI(img.Bounds(), cfg.roiMargins())
+
+		if _, ok := findRedLine(img, roi, cfg); ok != tt.want {
+			t.Errorf("fraction %v: found = %v, want %v", tt.fraction, ok, tt.want)
+		}
+	}
+}
+
+// benchResolutions are the screen sizes the detection benchmarks run at.
+var benchResolutions = []struct {
+	name string
+	w, h int
+}{
+	{"1080p", 1920, 1080},
+	{"1440p", 2560, 1440},
+	{"4K", 3840, 2160},
+}
+
+// newBenchFrame is a w x h chart with a red line across the middle and a
+// 60x20 bubble on it near the ROI's right edge, as defaultConfig sees it.
+func newBenchFrame(w, h int) (*image.RGBA, image.Rectangle) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{fixtureBackground}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, h/2, w, h/2+1), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	roi := centralROI(img.Bounds(), defaultConfig().roiMargins())
+	draw.Draw(img, image.Rect(roi.Max.X-80, h/2-10, roi.Max.X-20, h/2+10), &image.Uniform{fixtureWhite}, image.Point{}, draw.Src)
+	return img, roi
+}
+
+// quietBenchLogs drops the per-call detection logs for the rest of b.
+func quietBenchLogs(b *testing.B) {
+	cfg := defaultConfig()
+	cfg.LogLevel = "error"
+	if err := setupLogging(cfg); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { setupLogging(defaultConfig()) })
+}
+
+func BenchmarkFindRedLine(b *testing.B) {
+	quietBenchLogs(b)
+	for _, res := range benchResolutions {
+		img, roi := newBenchFrame(res.w, res.h)
+		for _, stride := range []int{1, 2} {
+			cfg := defaultConfig()
+			cfg.ScanStride = stride
+			b.Run(fmt.Sprintf("%s/stride%d", res.name, stride), func(b *testing.B) {
+				if line, ok := findRedLine(img, roi, cfg); !ok || line.Y != res.h/2 {
+					b.Fatalf("line = %+v, %v; want one at Y=%d", line, ok, res.h/2)
+				}
+				b.ReportAllocs()
+				for b.Loop() {
+					findRedLine(img, roi, cfg)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFindRedLineWorkers(b *testing.B) {
+	quietBenchLogs(b)
+	res := benchResolutions[len(benchResolutions)-1]
+	img, roi := newBenchFrame(res.w, res.h)
+	workers := []int{1, 2, 4, runtime.GOMAXPROCS(0)}
+	slices.Sort(workers)
+	for _, workers := range slices.Compact(workers) {
+		cfg := defaultConfig()
+		cfg.ScanWorkers = workers
+		b.Run(fmt.Sprintf("%s/workers%d", res.name, workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				findRedLine(img, roi, cfg)
+			}
+		})
+	}
+}
+
+func BenchmarkBubbleAtLine(b *testing.B) {
+	quietBenchLogs(b)
+	for _, res := range benchResolutions {
+		img, roi := newBenchFrame(res.w, res.h)
+		line := Line{Y: res.h / 2, EndX: roi.Max.X - 1}
+		for _, stride := range []int{1, 2} {
+			cfg := defaultConfig()
+			cfg.ScanStride = stride
+			b.Run(fmt.Sprintf("%s/stride%d", res.name, stride), func(b *testing.B) {
+				if _, ok := bubbleAtLine(img, roi, line, cfg); !ok {
+					b.Fatal("no bubble found at the line")
+				}
+				b.ReportAllocs()
+				for b.Loop() {
+					bubbleAtLine(img, roi, line, cfg)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"hash/maphash"
+	"image"
+	"log/slog"
+	"slices"
+)
+
+// rowCache is one display's last line scan, for DiffScan. Most of a chart is
+// static between polls, so rather than scanning every ROI row for every
+// profile, it checksums the rows and rescans only those that changed, keeping
+// last poll's rowStats for the rest. That gives exactly the stats a full scan
+// would: a row's stats depend only on its own pixels and, in edge mode, on
+// the rows either side.
+type rowCache struct {
+	seed     maphash.Seed
+	roi      image.Rectangle
+	profiles []ColorProfile
+	scan     rowScanSettings
+	sums     []uint64    // per row from roi.Min.Y-1 to roi.Max.Y, a checksum of its ROI columns
+	stats    [][]rowStat // per profile, as lineRowStats returns them; nil scans without caching
+	dirty    []bool      // this frame's rows to rescan, indexed from roi.Min.Y; nil = all of them
+}
+
+// rowScanSettings are the settings besides the profiles that a row's stats
+// depend on; changing any starts the cache over.
+type rowScanSettings struct {
+	mode      string
+	stride    int
+	edgeDelta int
+}
+
+func newRowCache() *rowCache {
+	return &rowCache{seed: maphash.MakeSeed()}
+}
+
+// begin checksums img's rows of roi for this frame and works out which of
+// them need rescanning. A new ROI, profile or scan setting means a full scan.
+// Only *image.RGBA frames are cached; anything else is scanned in full.
+func (c *rowCache) begin(img image.Image, roi image.Rectangle, profiles []ColorProfile, cfg Config) {
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		*c = rowCache{seed: c.seed}
+		return
+	}
+	cols := roi.Intersect(rgba.Rect)
+	sums := make([]uint64, roi.Dy()+2)
+	for i := range sums {
+		if y := roi.Min.Y - 1 + i; !cols.Empty() && y >= rgba.Rect.Min.Y && y < rgba.Rect.Max.Y {
+			sums[i] = maphash.Bytes(c.seed, pixRow(rgba, cols, y))
+		}
+	}
+
+	scan := rowScanSettings{mode: cfg.LineDetectMode, stride: cfg.ScanStride, edgeDelta: cfg.EdgeContrastDelta}
+	c.dirty = nil
+	if c.stats != nil && c.roi == roi && c.scan == scan && slices.Equal(c.profiles, profiles) {
+		edge := cfg.LineDetectMode == lineModeEdge
+		c.dirty = make([]bool, roi.Dy())
+		changed := 0
+		for i := range c.dirty {
+			j := i + 1 // sums index of row roi.Min.Y+i
+			c.dirty[i] = sums[j] != c.sums[j] || edge && (sums[j-1] != c.sums[j-1] || sums[j+1] != c.sums[j+1])
+			if c.dirty[i] {
+				changed++
+			}
+		}
+		slog.Debug("diff scan", "rows", roi.Dy(), "changed", changed)
+	} else {
+		c.stats = make([][]rowStat, len(profiles))
+	}
+	c.roi, c.profiles, c.scan, c.sums = roi, profiles, scan, sums
+}
+
+// rowStats returns lineRowStats for the i-th profile, p, rescanning only the
+// rows begin marked. A nil cache scans every row.
+func (c *rowCache) rowStats(img image.Image, roi image.Rectangle, i int, p ColorProfile, cfg Config) []rowStat {
+	if c == nil || c.stats == nil {
+		return lineRowStats(img, roi, p, cfg)
+	}
+	if c.dirty == nil || c.stats[i] == nil {
+		c.stats[i] = lineRowStats(img, roi, p, cfg)
+		return c.stats[i]
+	}
+	stats := c.stats[i]
+	for j, dirty := range c.dirty {
+		if dirty {
+			stats[j] = scanRowStat(img, roi.Min.Y+j, roi, p, cfg)
+		}
+	}
+	return stats
+}
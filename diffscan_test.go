@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestDiffScanMatchesFullScan(t *testing.T) {
+	frames := []*image.RGBA{
+		newFixture(150, image.Rect(330, 145, 350, 155)),
+		newFixture(150, image.Rect(330, 145, 350, 155)), // unchanged
+		newFixture(151, image.Rect(330, 146, 350, 156)), // the line moved a row
+		newFixture(-1, image.Rectangle{}),               // gone
+		newFixture(80, image.Rectangle{}),
+	}
+	// a second line appearing below the first
+	two := newFixture(80, image.Rectangle{})
+	draw.Draw(two, image.Rect(0, 200, 400, 201), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	frames = append(frames, two)
+
+	for _, mode := range []string{lineModeRun, lineModeCount, lineModeEdge} {
+		cfg := testConfig()
+		cfg.LineDetectMode = mode
+		roi := centralROI(frames[0].Bounds(), cfg.roiMargins())
+		cache := newRowCache()
+		for i, img := range frames {
+			want := findRedLines(img, roi, cfg)
+			if got := findRedLinesCached(img, roi, cfg, cache); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, frame %d: diff scan found %+v, full scan %+v", mode, i, got, want)
+			}
+			if i == 1 && !slices.Equal(cache.dirty, make([]bool, len(cache.dirty))) {
+				t.Errorf("%s: rows rescanned on an unchanged frame", mode)
+			}
+		}
+	}
+}
+
+func TestDiffScanRestartsOnChange(t *testing.T) {
+	cfg := testConfig()
+	img := newFixture(150, image.Rectangle{})
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	cache := newRowCache()
+	findRedLinesCached(img, roi, cfg, cache)
+
+	// a narrower ROI or other colours can't reuse the stats
+	small := roi.Inset(10)
+	if got, want := findRedLinesCached(img, small, cfg, cache), findRedLines(img, small, cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("new ROI: diff scan found %+v, full scan %+v", got, want)
+	}
+	cfg.LineColors = []ColorProfile{greenLineProfile}
+	if got := findRedLinesCached(img, small, cfg, cache); len(got) != 0 {
+		t.Errorf("green profile: diff scan found %+v in a red-line frame", got)
+	}
+}
+
+func BenchmarkDiffScan(b *testing.B) {
+	quietBenchLogs(b)
+	res := benchResolutions[len(benchResolutions)-1]
+	img, roi := newBenchFrame(res.w, res.h)
+	cfg := defaultConfig()
+	for _, diff := range []bool{false, true} {
+		var cache *rowCache
+		name := res.name + "/full"
+		if diff {
+			cache, name = newRowCache(), res.name+"/diff"
+		}
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				findRedLinesCached(img, roi, cfg, cache) // a static frame
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/kbinani/screenshot"
+)
+
+// writeDisplays prints the index and bounds of each of the n active displays,
+// as reported by bounds, followed by the virtual desktop that spans them all,
+// for -list-displays. The bounds are in virtual-desktop coordinates, the ones
+// CaptureRegion uses unless RegionRelativeToDisplay is set. It returns the
+// process exit code.
+func writeDisplays(out io.Writer, n int, bounds func(display int) image.Rectangle) int {
+	if n == 0 {
+		fmt.Fprintln(out, "no active displays found")
+		return 2
+	}
+	var desktop image.Rectangle
+	for i := range n {
+		b := bounds(i)
+		fmt.Fprintf(out, "display %d: %v (%dx%d)\n", i, b, b.Dx(), b.Dy())
+		desktop = desktop.Union(b)
+	}
+	fmt.Fprintf(out, "virtual desktop: %v (%dx%d)\n", desktop, desktop.Dx(), desktop.Dy())
+	return 0
+}
+
+// activeDisplays returns the bounds of every active display, indexed like
+// DisplayIndex.
+func activeDisplays() []image.Rectangle {
+	n := screenshot.NumActiveDisplays()
+	out := make([]image.Rectangle, n)
+	for i := range out {
+		out[i] = screenshot.GetDisplayBounds(i)
+	}
+	return out
+}
+
+// checkLayout warns when a display has been plugged in, unplugged or resized
+// since the last poll, and re-checks the absolute settings (CaptureRegion and
+// the display indices) against the new layout. The ROI itself is re-derived
+// from each frame's bounds, so it needs no reset here.
+func (w *Watcher) checkLayout(cfg Config) {
+	cur := w.screens()
+	if w.layout == nil {
+		w.layout = cur
+		return
+	}
+	if slices.Equal(cur, w.layout) {
+		return
+	}
+	slog.Warn("display layout changed", "displays", len(cur), "was", len(w.layout), "bounds", fmt.Sprint(cur))
+	w.layout = cur
+	for _, err := range cfg.layoutProblems(cur) {
+		slog.Warn("config no longer fits the displays", "err", err)
+	}
+}
+
+// layoutProblems lists the settings that don't fit the given display layout:
+// a display index that is gone, or a CaptureRegion that is no longer on
+// screen.
+func (cfg Config) layoutProblems(layout []image.Rectangle) []error {
+	var errs []error
+	for _, display := range cfg.displays() {
+		if display >= len(layout) && cfg.TargetWindowTitle == "" {
+			errs = append(errs, fmt.Errorf("display %d not found (%d active)", display, len(layout)))
+		}
+	}
+	if cfg.CaptureRegion.Empty() || cfg.TargetWindowTitle != "" {
+		return errs
+	}
+	if cfg.RegionRelativeToDisplay {
+		for _, display := range cfg.displays() {
+			if display < len(layout) {
+				if _, err := regionOnDisplay(cfg.CaptureRegion, layout[display]); err != nil {
+					errs = append(errs, fmt.Errorf("display %d: %w", display, err))
+				}
+			}
+		}
+		return errs
+	}
+	var desktop image.Rectangle
+	for _, b := range layout {
+		desktop = desktop.Union(b)
+	}
+	if !cfg.CaptureRegion.In(desktop) {
+		errs = append(errs, fmt.Errorf("CaptureRegion %v isn't within the %v desktop", cfg.CaptureRegion, desktop))
+	}
+	return errs
+}
+
+// checkFrameSize warns when display's capture comes back a different size
+// than last poll (a resolution change, or a window resized under
+// TargetWindowTitle) and ROIRect no longer fits it.
+func (w *Watcher) checkFrameSize(cfg Config, display int, bounds image.Rectangle) {
+	prev, seen := w.frameSizes[display]
+	w.frameSizes[display] = bounds
+	if !seen || prev == bounds {
+		return
+	}
+	slog.Warn("capture size changed", "display", display, "was", prev.String(), "now", bounds.String())
+	if !cfg.ROIRect.Empty() && !cfg.ROIRect.In(bounds) {
+		slog.Warn("ROIRect no longer fits the capture; scanning only the part that does", "display", display, "roi", cfg.ROIRect.String(), "bounds", bounds.String())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+)
+
+func TestWriteDisplays(t *testing.T) {
+	// a laptop screen with a monitor to its left
+	screens := []image.Rectangle{image.Rect(0, 0, 1440, 900), image.Rect(-1920, -180, 0, 900)}
+	var out bytes.Buffer
+	if code := writeDisplays(&out, len(screens), func(i int) image.Rectangle { return screens[i] }); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+	want := "display 0: (0,0)-(1440,900) (1440x900)\n" +
+		"display 1: (-1920,-180)-(0,900) (1920x1080)\n" +
+		"virtual desktop: (-1920,-180)-(1440,900) (3360x1080)\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if code := writeDisplays(&out, 0, nil); code != 2 {
+		t.Errorf("exit code with no displays = %d, want 2", code)
+	}
+}
+
+func TestCaptureSizeChange(t *testing.T) {
+	cfg := testConfig()
+	cfg.ROIRect = image.Rect(40, 30, 360, 270)
+	// after a resolution change the display comes back 300x200, cutting
+	// ROIRect down to the part still on screen
+	small := newFixture(100, image.Rect(270, 95, 290, 105)).SubImage(image.Rect(0, 0, 300, 200))
+	frames := []image.Image{newFixture(150, image.Rect(330, 145, 350, 155)), small}
+	w := newTestWatcher(cfg, nil)
+	w.capture = func(int) (image.Image, error) {
+		img := frames[0]
+		frames = frames[1:]
+		return img, nil
+	}
+
+	for _, wantY := range []int{150, 100} {
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.RedLineFound || res.RedLineY != wantY || !res.BubbleDetected {
+			t.Errorf("line = %v at Y=%d, bubble = %v; want a bubble on the line at %d", res.RedLineFound, res.RedLineY, res.BubbleDetected, wantY)
+		}
+	}
+	if b := w.frameSizes[0]; b != small.Bounds() {
+		t.Errorf("frame size = %v, want the resized %v", b, small.Bounds())
+	}
+
+	w.capture = func(int) (image.Image, error) { return image.NewRGBA(image.Rect(0, 0, 30, 20)), nil }
+	if _, err := w.checkOnce(context.Background()); err == nil {
+		t.Error("no error once ROIRect lies wholly off the capture")
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	laptop, monitor := image.Rect(0, 0, 1440, 900), image.Rect(1440, 0, 3360, 1080)
+	cfg := testConfig()
+	cfg.CaptureRegion = image.Rect(1500, 100, 2500, 800) // on the monitor
+
+	layout := []image.Rectangle{laptop, monitor}
+	w := newTestWatcher(cfg, nil)
+	w.screens = func() []image.Rectangle { return layout }
+	w.checkLayout(cfg)
+	if len(w.layout) != 2 {
+		t.Fatalf("layout = %v after the first poll, want both displays", w.layout)
+	}
+	if errs := cfg.layoutProblems(layout); len(errs) != 0 {
+		t.Errorf("problems with the monitor plugged in: %v", errs)
+	}
+
+	layout = []image.Rectangle{laptop} // unplugged
+	w.checkLayout(cfg)
+	if len(w.layout) != 1 {
+		t.Errorf("layout = %v after unplugging, want just the laptop", w.layout)
+	}
+	if errs := cfg.layoutProblems(layout); len(errs) != 1 {
+		t.Errorf("problems with the monitor unplugged = %v, want the CaptureRegion to be off screen", errs)
+	}
+
+	cfg = testConfig()
+	cfg.DisplayIndices = []int{0, 1}
+	if errs := cfg.layoutProblems(layout); len(errs) != 1 {
+		t.Errorf("problems with display 1 gone = %v, want one", errs)
+	}
+	cfg.CaptureRegion, cfg.RegionRelativeToDisplay = image.Rect(0, 0, 1600, 900), true
+	if errs := cfg.layoutProblems(layout); len(errs) != 2 {
+		t.Errorf("problems with a relative region wider than display 0 = %v, want it and the missing display", errs)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envVar binds one WATCHER_* setting, from the environment or a config file,
+// to a Config field.
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+// LoadConfig builds the config to run with.
+//
+// Precedence, lowest first: built-in defaults, the config file at path (if
+// path is set), environment, command-line flags.
+//
+// A Theme and Sensitivity fit between the defaults and the file, so the
+// settings are read twice: once to find them, then again on top of them.
+func LoadConfig(path string) (Config, error) {
+	cfg, err := loadConfigOver(defaultConfig(), path)
+	if err != nil || cfg.Theme == "" && cfg.Sensitivity == defaultSensitivity {
+		return cfg, err
+	}
+	base := defaultConfig()
+	if err := base.applyTheme(cfg.Theme); err != nil {
+		return cfg, err
+	}
+	base.applySensitivity(cfg.Sensitivity)
+	return loadConfigOver(base, path)
+}
+
+// loadConfigOver overlays the config file at path, if any, and then the
+// environment onto base.
+func loadConfigOver(base Config, path string) (Config, error) {
+	cfg := base
+	if path != "" {
+		var err error
+		if cfg, err = LoadConfigFile(cfg, path); err != nil {
+			return cfg, err
+		}
+	}
+	return LoadConfigFromEnv(cfg)
+}
+
+// LoadConfigFromEnv overlays WATCHER_* environment variables onto base. Every
+// bad value is reported, not just the first; fields whose variable is unset
+// keep their base value.
+func LoadConfigFromEnv(base Config) (Config, error) {
+	cfg := base
+	var errs []error
+	for _, v := range configVars(&cfg) {
+		s, ok := os.LookupEnv(v.name)
+		if !ok {
+			continue
+		}
+		if err := v.set(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %w", v.name, s, err))
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// LoadConfigFile overlays a config file onto base. The file takes the same
+// settings as the environment, one WATCHER_*=value per line; blank lines and
+// lines starting with # are skipped, and a value may be double-quoted. As
+// with LoadConfigFromEnv every problem is reported, including unknown names.
+func LoadConfigFile(base Config, path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := base
+	vars := map[string]envVar{}
+	for _, v := range configVars(&cfg) {
+		vars[v.name] = v
+	}
+
+	var errs []error
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, s, ok := strings.Cut(line, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s:%d: want NAME=value, got %q", path, i+1, line))
+			continue
+		}
+		name, s = strings.TrimSpace(name), strings.TrimSpace(s)
+		if strings.HasPrefix(s, `"`) {
+			if u, err := strconv.Unquote(s); err == nil {
+				s = u
+			}
+		}
+		v, ok := vars[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown setting %s", path, i+1, name))
+			continue
+		}
+		if err := v.set(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s=%q: %w", path, i+1, name, s, err))
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// configVars binds every recognised WATCHER_* setting to its field of cfg.
+// Durations use Go syntax ("10s", "1m30s"), booleans anything
+// strconv.ParseBool accepts ("1", "true", "false").
+func configVars(cfg *Config) []envVar {
+	return []envVar{
+		{"WATCHER_THEME", stringVar(&cfg.Theme)},
+		{"WATCHER_SENSITIVITY", floatVar(&cfg.Sensitivity)},
+		{"WATCHER_POLL_INTERVAL", durationVar(&cfg.PollInterval)},
+		{"WATCHER_IDLE_AFTER_MISSES", intVar(&cfg.IdleAfterMisses)},
+		{"WATCHER_IDLE_POLL_INTERVAL", durationVar(&cfg.IdlePollInterval)},
+		{"WATCHER_IDLE_UNIFORMITY", floatVar(&cfg.IdleUniformity)},
+		{"WATCHER_MAX_RUNTIME", durationVar(&cfg.MaxRuntime)},
+		{"WATCHER_RED_MIN_R", uint8Var(&cfg.RedMinR)},
+		{"WATCHER_RED_MAX_G", uint8Var(&cfg.RedMaxG)},
+		{"WATCHER_RED_MAX_B", uint8Var(&cfg.RedMaxB)},
+		{"WATCHER_LINE_COLORS", lineColorsVar(&cfg.LineColors)}, // e.g. "red:200-255,0-110,0-110;blue"
+		{"WATCHER_COLOR_SPACE", stringVar(&cfg.ColorSpace)},
+		{"WATCHER_LINE_TARGET_COLOR", colorVar(&cfg.LineTargetColor)},
+		{"WATCHER_LAB_TOLERANCE", floatVar(&cfg.LabTolerance)},
+		{"WATCHER_RED_HUE_MIN", floatVar(&cfg.RedHueMin)},
+		{"WATCHER_RED_HUE_MAX", floatVar(&cfg.RedHueMax)},
+		{"WATCHER_RED_MIN_SAT", floatVar(&cfg.RedMinSat)},
+		{"WATCHER_RED_MIN_VAL", floatVar(&cfg.RedMinVal)},
+		{"WATCHER_LINE_DETECT_MODE", stringVar(&cfg.LineDetectMode)},
+		{"WATCHER_EDGE_CONTRAST_DELTA", intVar(&cfg.EdgeContrastDelta)},
+		{"WATCHER_DETECT_DASHED", boolVar(&cfg.DetectDashed)},
+		{"WATCHER_DASHED_GAP_TOLERANCE", floatVar(&cfg.DashedGapTolerance)},
+		{"WATCHER_MIN_RED_RUN_LENGTH", intVar(&cfg.MinRedRunLength)},
+		{"WATCHER_MIN_RED_PIXELS", intVar(&cfg.MinRedPixelsPerRow)},
+		{"WATCHER_MIN_RED_PIXELS_FRACTION", floatVar(&cfg.MinRedPixelsPerRowFraction)},
+		{"WATCHER_MIN_RED_PIXELS_PER_COL", intVar(&cfg.MinRedPixelsPerCol)},
+		{"WATCHER_DETECT_VERTICAL", boolVar(&cfg.DetectVertical)},
+		{"WATCHER_LINE_MOVE_THRESHOLD", intVar(&cfg.LineMoveThreshold)},
+		{"WATCHER_LINE_SMOOTHING", intVar(&cfg.LineSmoothing)},
+		{"WATCHER_LINE_MERGE_GAP", intVar(&cfg.LineMergeGap)},
+		{"WATCHER_MAX_DISTANCE_BUBBLE_TO_LINE", intVar(&cfg.MaxDistanceBubbleToLine)},
+		{"WATCHER_BUBBLE_DISTANCE_ABOVE", intVar(&cfg.BubbleDistanceAbove)},
+		{"WATCHER_BUBBLE_DISTANCE_BELOW", intVar(&cfg.BubbleDistanceBelow)},
+		{"WATCHER_BUBBLE_SEARCH_SIDE", stringVar(&cfg.BubbleSearchSide)},
+		{"WATCHER_BUBBLE_SEARCH_WIDTH_PERCENT", floatVar(&cfg.BubbleSearchWidthPercent)},
+		{"WATCHER_BUBBLE_AT_LINE_END", boolVar(&cfg.BubbleAtLineEnd)},
+		{"WATCHER_BUBBLE_LINE_END_WINDOW", intVar(&cfg.BubbleLineEndWindow)},
+		{"WATCHER_DETECT_BLINKING_BUBBLE", boolVar(&cfg.DetectBlinkingBubble)},
+		{"WATCHER_BUBBLE_BRIGHT_THRESHOLD", intVar(&cfg.BubbleBrightThreshold)},
+		{"WATCHER_BUBBLE_POLARITY", stringVar(&cfg.BubblePolarity)},
+		{"WATCHER_BUBBLE_DARK_THRESHOLD", intVar(&cfg.BubbleDarkThreshold)},
+		{"WATCHER_BUBBLE_RELATIVE_BRIGHTNESS", boolVar(&cfg.BubbleRelativeBrightness)},
+		{"WATCHER_BUBBLE_BRIGHTNESS_DELTA", intVar(&cfg.BubbleBrightnessDelta)},
+		{"WATCHER_BUBBLE_MIN_BRIGHT_PIXELS", intVar(&cfg.BubbleMinBrightPixels)},
+		{"WATCHER_BUBBLE_MIN_WIDTH", intVar(&cfg.BubbleMinWidth)},
+		{"WATCHER_BUBBLE_MAX_WIDTH", intVar(&cfg.BubbleMaxWidth)},
+		{"WATCHER_BUBBLE_MIN_HEIGHT", intVar(&cfg.BubbleMinHeight)},
+		{"WATCHER_BUBBLE_MAX_HEIGHT", intVar(&cfg.BubbleMaxHeight)},
+		{"WATCHER_CONFIRM_FRAMES", intVar(&cfg.ConfirmFrames)},
+		{"WATCHER_WARMUP_POLLS", intVar(&cfg.WarmupPolls)},
+		{"WATCHER_ALERT_COOLDOWN", durationVar(&cfg.AlertCooldown)},
+		{"WATCHER_REARM_AFTER_CLEAR_POLLS", intVar(&cfg.RearmAfterClearPolls)},
+		{"WATCHER_DISPLAY_INDEX", intVar(&cfg.DisplayIndex)},
+		{"WATCHER_CAPTURE_REGION", rectVar(&cfg.CaptureRegion)}, // "x0,y0,x1,y1"
+		{"WATCHER_REGION_RELATIVE_TO_DISPLAY", boolVar(&cfg.RegionRelativeToDisplay)},
+		{"WATCHER_DISPLAY_INDICES", intListVar(&cfg.DisplayIndices)}, // comma-separated, e.g. "0,1"
+		{"WATCHER_ROI_MARGIN_PERCENT", floatVar(&cfg.ROIMarginPercent)},
+		{"WATCHER_ROI_MARGIN_TOP", floatVar(&cfg.ROIMarginTop)},
+		{"WATCHER_ROI_MARGIN_BOTTOM", floatVar(&cfg.ROIMarginBottom)},
+		{"WATCHER_ROI_MARGIN_LEFT", floatVar(&cfg.ROIMarginLeft)},
+		{"WATCHER_ROI_MARGIN_RIGHT", floatVar(&cfg.ROIMarginRight)},
+		{"WATCHER_ROI_RECT", rectVar(&cfg.ROIRect)},                  // "x0,y0,x1,y1"
+		{"WATCHER_LINE_SCAN_Y_RANGE", rangeVar(&cfg.LineScanYRange)}, // "from,to"
+		{"WATCHER_SCALE_DIVISOR", intVar(&cfg.ScaleDivisor)},
+		{"WATCHER_SCAN_STRIDE", intVar(&cfg.ScanStride)},
+		{"WATCHER_SCAN_WORKERS", intVar(&cfg.ScanWorkers)},
+		{"WATCHER_DIFF_SCAN", boolVar(&cfg.DiffScan)},
+		{"WATCHER_IGNORE_CURSOR_REGION", boolVar(&cfg.IgnoreCursorRegion)},
+		{"WATCHER_CURSOR_RADIUS", intVar(&cfg.CursorRadius)},
+		{"WATCHER_MIN_CAPTURE_BRIGHTNESS", floatVar(&cfg.MinCaptureBrightness)},
+		{"WATCHER_TARGET_WINDOW_TITLE", stringVar(&cfg.TargetWindowTitle)},
+		{"WATCHER_AI_ENDPOINT", stringVar(&cfg.AIEndpoint)}, // set to "" to disable the AI step
+		{"WATCHER_AI_ALWAYS_RUN", boolVar(&cfg.AIAlwaysRun)},
+		{"WATCHER_AI_MIN_INTERVAL", durationVar(&cfg.AIMinInterval)},
+		{"WATCHER_AI_TIMEOUT", durationVar(&cfg.AITimeout)},
+		{"WATCHER_AI_MAX_RETRIES", intVar(&cfg.AIMaxRetries)},
+		{"WATCHER_AI_CONCURRENCY", intVar(&cfg.AIConcurrency)},
+		{"WATCHER_AI_PRICE_MIN", floatVar(&cfg.AIPriceMin)},
+		{"WATCHER_AI_PRICE_MAX", floatVar(&cfg.AIPriceMax)},
+		{"WATCHER_AI_IDLE_CONN_TIMEOUT", durationVar(&cfg.AIIdleConnTimeout)},
+		{"WATCHER_AI_BREAKER_FAILURES", intVar(&cfg.AIBreakerFailures)},
+		{"WATCHER_AI_BREAKER_COOLDOWN", durationVar(&cfg.AIBreakerCooldown)},
+		{"WATCHER_AI_REQUEST_MODE", stringVar(&cfg.AIRequestMode)},
+		{"WATCHER_AI_FORM_FIELD", stringVar(&cfg.AIFormField)},
+		{"WATCHER_AI_PRICE_FIELD", stringVar(&cfg.AIPriceField)},
+		{"WATCHER_AI_CONFIDENCE_FIELD", stringVar(&cfg.AIConfidenceField)},
+		{"WATCHER_SEND_DETECTION_HINTS", boolVar(&cfg.SendDetectionHints)},
+		{"WATCHER_ENABLE_OCR_FALLBACK", boolVar(&cfg.EnableOCRFallback)},
+		{"WATCHER_AI_AUTH_HEADER", stringVar(&cfg.AIAuthHeader)},
+		{"WATCHER_AI_AUTH_TOKEN", stringVar((*string)(&cfg.AIAuthToken))},
+		{"WATCHER_SAVE_FRAMES", boolVar(&cfg.SaveFrames)},
+		{"WATCHER_SAVE_FAILURE_FATAL", boolVar(&cfg.SaveFailureFatal)},
+		{"WATCHER_FRAME_DIR", stringVar(&cfg.FrameDir)},
+		{"WATCHER_MAX_FRAMES", intVar(&cfg.MaxFrames)},
+		{"WATCHER_IMAGE_FORMAT", stringVar(&cfg.ImageFormat)},
+		{"WATCHER_JPEG_QUALITY", intVar(&cfg.JPEGQuality)},
+		{"WATCHER_RESULTS_LOG", stringVar(&cfg.ResultsLogPath)},
+		{"WATCHER_ALERT_LOG", stringVar(&cfg.AlertLogPath)},
+		{"WATCHER_METRICS_ADDR", stringVar(&cfg.MetricsAddr)},
+		{"WATCHER_PROFILE_ADDR", stringVar(&cfg.ProfileAddr)},
+		{"WATCHER_STREAM_FRAMES", boolVar(&cfg.StreamFrames)},
+		{"WATCHER_STREAM_ANNOTATED", boolVar(&cfg.StreamAnnotated)},
+		{"WATCHER_OVERLAY_PATH", stringVar(&cfg.OverlayPath)},
+		{"WATCHER_ALERT_HISTORY_SIZE", intVar(&cfg.AlertHistorySize)},
+		{"WATCHER_STATE_PATH", stringVar(&cfg.StatePath)},
+		{"WATCHER_STATE_SAVE_INTERVAL", durationVar(&cfg.StateSaveInterval)},
+		{"WATCHER_DRY_RUN", boolVar(&cfg.DryRun)},
+		{"WATCHER_ALERT_PRICE_ABOVE", floatVar(&cfg.AlertPriceAbove)},
+		{"WATCHER_ALERT_PRICE_BELOW", floatVar(&cfg.AlertPriceBelow)},
+		{"WATCHER_ALERT_ON_MISSING_PRICE", boolVar(&cfg.AlertOnMissingPrice)},
+		{"WATCHER_REQUIRE_PRICE_CHANGE", boolVar(&cfg.RequirePriceChange)},
+		{"WATCHER_MIN_PRICE_DELTA", floatVar(&cfg.MinPriceDelta)},
+		{"WATCHER_ALERT_BATCH_WINDOW", durationVar(&cfg.AlertBatchWindow)},
+		{"WATCHER_NOTIFY_FAILURE_LIMIT", intVar(&cfg.NotifyFailureLimit)},
+		{"WATCHER_MAX_CONCURRENT_ALERTS", intVar(&cfg.MaxConcurrentAlerts)},
+		{"WATCHER_NOTIFIERS", stringListVar(&cfg.Notifiers)}, // comma-separated, e.g. "webhook,log"
+		{"WATCHER_ALERT_WEBHOOK_URL", stringVar(&cfg.AlertWebhookURL)},
+		{"WATCHER_QUIET_HOURS_START", stringVar(&cfg.QuietHoursStart)},
+		{"WATCHER_QUIET_HOURS_END", stringVar(&cfg.QuietHoursEnd)},
+		{"WATCHER_QUIET_HOURS_NOTIFIERS", stringListVar(&cfg.QuietHoursNotifiers)},
+		{"WATCHER_ALERT_RULES", alertRulesVar(&cfg.AlertRules)}, // e.g. "faint:log,bubble:beep+log,line_moved:webhook"
+		{"WATCHER_FAINT_LINE_CONFIDENCE", floatVar(&cfg.FaintLineConfidence)},
+		{"WATCHER_BEEP_ENABLED", boolVar(&cfg.BeepEnabled)},
+		{"WATCHER_BEEP_FREQ_HZ", floatVar(&cfg.BeepFreqHz)},
+		{"WATCHER_BEEP_DURATION_MS", intVar(&cfg.BeepDurationMs)},
+		{"WATCHER_ALERT_ESCALATION", escalationVar(&cfg.AlertEscalation)},
+		{"WATCHER_SOUND_FILE", stringVar(&cfg.SoundFilePath)},
+		{"WATCHER_NOTIFY_TITLE_TEMPLATE", stringVar(&cfg.NotifyTitleTemplate)},
+		{"WATCHER_NOTIFY_BODY_TEMPLATE", stringVar(&cfg.NotifyBodyTemplate)},
+		{"WATCHER_LOG_FORMAT", stringVar(&cfg.LogFormat)},
+		{"WATCHER_LOG_LEVEL", stringVar(&cfg.LogLevel)},
+		{"WATCHER_LOG_FILE", stringVar(&cfg.LogFilePath)},
+		{"WATCHER_LOG_MAX_SIZE_MB", intVar(&cfg.LogMaxSizeMB)},
+	}
+}
+
+func stringVar(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+// stringListVar splits a comma-separated list, dropping blanks.
+func stringListVar(p *[]string) func(string) error {
+	return func(s string) error {
+		var out []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		*p = out
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return errString("not an integer")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func intListVar(p *[]int) func(string) error {
+	return func(s string) error {
+		var out []int
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return errString("not a comma-separated list of integers")
+			}
+			out = append(out, n)
+		}
+		*p = out
+		return nil
+	}
+}
+
+func uint8Var(p *uint8) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return errString("not an integer in 0-255")
+		}
+		*p = uint8(v)
+		return nil
+	}
+}
+
+func colorVar(p *color.RGBA) func(string) error {
+	return func(s string) error {
+		c := color.RGBA{A: 0xff}
+		if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(s) != 7 {
+			return errString(`not a color (e.g. "#e62828")`)
+		}
+		*p = c
+		return nil
+	}
+}
+
+func floatVar(p *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errString("not a number")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return errString("not a boolean")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func rectVar(p *image.Rectangle) func(string) error {
+	return func(s string) error {
+		var r image.Rectangle
+		if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y); err != nil {
+			return errString(`not a rectangle (e.g. "0,80,1600,900")`)
+		}
+		*p = r
+		return nil
+	}
+}
+
+func rangeVar(p *[2]float64) func(string) error {
+	return func(s string) error {
+		var r [2]float64
+		if _, err := fmt.Sscanf(s, "%g,%g", &r[0], &r[1]); err != nil {
+			return errString(`not a range (e.g. "0.33,0.67")`)
+		}
+		*p = r
+		return nil
+	}
+}
+
+// lineColorsVar parses LineColors as ";"-separated profiles, each either
+// "name:minR-maxR,minG-maxG,minB-maxB" or one of the ready-made "blue" and
+// "green". A profile given as channel ranges has no hue range, so with
+// ColorSpace "hsv" only the ready-made ones match anything.
+func lineColorsVar(p *[]ColorProfile) func(string) error {
+	return func(s string) error {
+		var out []ColorProfile
+		for _, v := range strings.Split(s, ";") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			prof, err := parseLineColor(v)
+			if err != nil {
+				return errString(`not a list of "name:minR-maxR,minG-maxG,minB-maxB" profiles (e.g. "red:200-255,0-110,0-110;blue")`)
+			}
+			out = append(out, prof)
+		}
+		*p = out
+		return nil
+	}
+}
+
+func parseLineColor(s string) (ColorProfile, error) {
+	name, box, ok := strings.Cut(s, ":")
+	if !ok {
+		switch s {
+		case blueLineProfile.Name:
+			return blueLineProfile, nil
+		case greenLineProfile.Name:
+			return greenLineProfile, nil
+		}
+		return ColorProfile{}, fmt.Errorf("%q is not a ready-made profile", s)
+	}
+	chans := strings.Split(box, ",")
+	if len(chans) != 3 {
+		return ColorProfile{}, fmt.Errorf("%q has %d channel ranges, want 3", s, len(chans))
+	}
+	prof := ColorProfile{Name: strings.TrimSpace(name)}
+	bounds := []*uint8{&prof.MinR, &prof.MaxR, &prof.MinG, &prof.MaxG, &prof.MinB, &prof.MaxB}
+	for i, c := range chans {
+		lo, hi, ok := strings.Cut(strings.TrimSpace(c), "-")
+		if !ok {
+			return ColorProfile{}, fmt.Errorf("%q is not a range", c)
+		}
+		for j, b := range []string{lo, hi} {
+			v, err := strconv.ParseUint(b, 10, 8)
+			if err != nil {
+				return ColorProfile{}, err
+			}
+			*bounds[2*i+j] = uint8(v)
+		}
+	}
+	return prof, nil
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return errString(`not a duration (e.g. "10s")`)
+		}
+		*p = v
+		return nil
+	}
+}
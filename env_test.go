@@ -0,0 +1,193 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("WATCHER_POLL_INTERVAL", "2s")
+	t.Setenv("WATCHER_MIN_RED_PIXELS", "750")
+	t.Setenv("WATCHER_AI_ENDPOINT", "http://inference:9000/price")
+	t.Setenv("WATCHER_DRY_RUN", "true")
+
+	base := defaultConfig()
+	cfg, err := LoadConfigFromEnv(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PollInterval != 2*time.Second {
+		t.Errorf("PollInterval = %s, want 2s", cfg.PollInterval)
+	}
+	if cfg.MinRedPixelsPerRow != 750 {
+		t.Errorf("MinRedPixelsPerRow = %d, want 750", cfg.MinRedPixelsPerRow)
+	}
+	if cfg.AIEndpoint != "http://inference:9000/price" {
+		t.Errorf("AIEndpoint = %q", cfg.AIEndpoint)
+	}
+	if !cfg.DryRun {
+		t.Error("DryRun not set")
+	}
+	if cfg.BubbleMinBrightPixels != base.BubbleMinBrightPixels {
+		t.Errorf("unset BubbleMinBrightPixels changed to %d", cfg.BubbleMinBrightPixels)
+	}
+}
+
+func TestLoadConfigFromEnvBadValues(t *testing.T) {
+	t.Setenv("WATCHER_POLL_INTERVAL", "ten")
+	t.Setenv("WATCHER_RED_MIN_R", "300")
+
+	_, err := LoadConfigFromEnv(defaultConfig())
+	if err == nil {
+		t.Fatal("bad values were accepted")
+	}
+	for _, name := range []string{"WATCHER_POLL_INTERVAL", "WATCHER_RED_MIN_R"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error doesn't mention %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.conf")
+	conf := `# tuning for the 4K display
+WATCHER_POLL_INTERVAL=3s
+WATCHER_MIN_RED_PIXELS = 600
+WATCHER_AI_ENDPOINT="http://inference:9000/price"
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WATCHER_MIN_RED_PIXELS", "750") // the environment wins
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PollInterval != 3*time.Second || cfg.AIEndpoint != "http://inference:9000/price" {
+		t.Errorf("PollInterval = %s, AIEndpoint = %q; want the file's values", cfg.PollInterval, cfg.AIEndpoint)
+	}
+	if cfg.MinRedPixelsPerRow != 750 {
+		t.Errorf("MinRedPixelsPerRow = %d, want the environment's 750", cfg.MinRedPixelsPerRow)
+	}
+
+	bad := "WATCHER_POLL_INTERVAL=ten\nWATCHER_NO_SUCH=1\njunk\n"
+	if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(path)
+	for _, want := range []string{":1: WATCHER_POLL_INTERVAL", ":2: unknown setting WATCHER_NO_SUCH", ":3: want NAME=value"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadConfigTheme(t *testing.T) {
+	t.Setenv("WATCHER_THEME", "light")
+	t.Setenv("WATCHER_RED_MIN_R", "170") // individual settings still win
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedMinR != 170 || cfg.RedMaxG != 90 || cfg.BubbleBrightThreshold != 735 {
+		t.Errorf("RedMinR %d, RedMaxG %d, BubbleBrightThreshold %d; want 170, 90, 735",
+			cfg.RedMinR, cfg.RedMaxG, cfg.BubbleBrightThreshold)
+	}
+
+	for name := range themes {
+		cfg := defaultConfig()
+		cfg.Theme = name
+		if err := cfg.applyTheme(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("theme %s is invalid: %v", name, err)
+		}
+	}
+
+	t.Setenv("WATCHER_THEME", "solarized")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "unknown theme") {
+		t.Errorf("err = %v, want an unknown theme error", err)
+	}
+}
+
+func TestColorVar(t *testing.T) {
+	var c color.RGBA
+	if err := colorVar(&c)("#e62828"); err != nil || c != (color.RGBA{230, 40, 40, 255}) {
+		t.Errorf("#e62828 = %v, %v; want {230 40 40 255}", c, err)
+	}
+	for _, bad := range []string{"e62828", "#e6282", "#e62828ff", "#zz2828"} {
+		if err := colorVar(&c)(bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+func TestLoadConfigSensitivity(t *testing.T) {
+	load := func(s string) Config {
+		t.Helper()
+		t.Setenv("WATCHER_SENSITIVITY", s)
+		cfg, err := LoadConfig("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	def := defaultConfig()
+	if cfg := load("0.5"); cfg.MinRedRunLength != def.MinRedRunLength || cfg.BubbleMinBrightPixels != def.BubbleMinBrightPixels {
+		t.Errorf("Sensitivity 0.5 changed the defaults: MinRedRunLength %d, BubbleMinBrightPixels %d", cfg.MinRedRunLength, cfg.BubbleMinBrightPixels)
+	}
+	strict, lenient := load("0"), load("1")
+	if strict.MinRedRunLength != 2*def.MinRedRunLength || lenient.MinRedRunLength != def.MinRedRunLength/2 {
+		t.Errorf("MinRedRunLength strict %d, lenient %d; want %d and %d",
+			strict.MinRedRunLength, lenient.MinRedRunLength, 2*def.MinRedRunLength, def.MinRedRunLength/2)
+	}
+
+	prev := strict
+	for _, s := range []string{"0.25", "0.5", "0.75", "1"} {
+		cfg := load(s)
+		if cfg.MinRedRunLength >= prev.MinRedRunLength || cfg.MinRedPixelsPerRow >= prev.MinRedPixelsPerRow ||
+			cfg.MinRedPixelsPerCol >= prev.MinRedPixelsPerCol || cfg.BubbleMinBrightPixels >= prev.BubbleMinBrightPixels {
+			t.Errorf("Sensitivity %s didn't lower every threshold: %+v", s, cfg)
+		}
+		prev = cfg
+	}
+
+	t.Setenv("WATCHER_BUBBLE_MIN_BRIGHT_PIXELS", "150") // individual settings still win
+	if cfg := load("1"); cfg.BubbleMinBrightPixels != 150 || cfg.MinRedRunLength != def.MinRedRunLength/2 {
+		t.Errorf("BubbleMinBrightPixels %d, MinRedRunLength %d; want the explicit 150 and the scaled %d",
+			cfg.BubbleMinBrightPixels, cfg.MinRedRunLength, def.MinRedRunLength/2)
+	}
+
+	cfg := defaultConfig()
+	cfg.Sensitivity = 1.5
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "Sensitivity") {
+		t.Errorf("Validate err = %v, want Sensitivity out of range", err)
+	}
+}
+
+func TestLineColorsVar(t *testing.T) {
+	t.Setenv("WATCHER_LINE_COLORS", "red:200-255,0-110,0-110; blue")
+	cfg, err := LoadConfigFromEnv(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := ColorProfile{Name: "red", MinR: 200, MaxR: 255, MaxG: 110, MaxB: 110}
+	if len(cfg.LineColors) != 2 || cfg.LineColors[0] != red || cfg.LineColors[1] != blueLineProfile {
+		t.Fatalf("LineColors = %+v, want %+v and the blue profile", cfg.LineColors, red)
+	}
+
+	for _, bad := range []string{"purple", "red:200-255,0-110", "red:200-256,0-110,0-110", "red:200,0-110,0-110"} {
+		t.Setenv("WATCHER_LINE_COLORS", bad)
+		if _, err := LoadConfigFromEnv(testConfig()); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
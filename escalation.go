@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// escalationStep is one level of AlertEscalation: once a bubble has sat at
+// its line for After, its alerts beep at FreqHz for DurationMs instead of
+// BeepFreqHz and BeepDurationMs.
+type escalationStep struct {
+	After      time.Duration
+	FreqHz     float64
+	DurationMs int
+}
+
+// escalationLevel is the 1-based index of the last AlertEscalation step
+// sustained has reached, or 0 if it hasn't reached any.
+func (cfg Config) escalationLevel(sustained time.Duration) int {
+	level := 0
+	for i, step := range cfg.AlertEscalation {
+		if sustained >= step.After {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// escalationVar parses AlertEscalation as comma-separated "after:freqHz:ms"
+// steps, e.g. "1m:1320:800,5m:1760:1500".
+func escalationVar(p *[]escalationStep) func(string) error {
+	return func(s string) error {
+		var out []escalationStep
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			step, err := parseEscalationStep(v)
+			if err != nil {
+				return errString(`not a list of "after:freqHz:ms" steps (e.g. "1m:1320:800,5m:1760:1500")`)
+			}
+			out = append(out, step)
+		}
+		*p = out
+		return nil
+	}
+}
+
+func parseEscalationStep(s string) (escalationStep, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return escalationStep{}, fmt.Errorf("%q has %d fields, want 3", s, len(parts))
+	}
+	after, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return escalationStep{}, err
+	}
+	freq, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return escalationStep{}, err
+	}
+	ms, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return escalationStep{}, err
+	}
+	return escalationStep{After: after, FreqHz: freq, DurationMs: ms}, nil
+}
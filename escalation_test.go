@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertEscalation(t *testing.T) {
+	t.Setenv("WATCHER_ALERT_ESCALATION", "1m:1320:800, 5m:1760:1500")
+	cfg, err := LoadConfigFromEnv(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []escalationStep{{time.Minute, 1320, 800}, {5 * time.Minute, 1760, 1500}}
+	if len(cfg.AlertEscalation) != 2 || cfg.AlertEscalation[0] != want[0] || cfg.AlertEscalation[1] != want[1] {
+		t.Fatalf("AlertEscalation = %+v, want %+v", cfg.AlertEscalation, want)
+	}
+
+	n := &recordingNotifier{}
+	for _, sustained := range []time.Duration{0, 59 * time.Second, time.Minute, 10 * time.Minute} {
+		triggerAlert(context.Background(), AlertEvent{Kind: alertBubble, Sustained: sustained, Time: time.Now()}, []Notifier{n}, cfg)
+	}
+	for i, level := range []int{0, 0, 1, 2} {
+		if got := n.events[i].Escalation; got != level {
+			t.Errorf("alert sustained for %s: escalation %d, want %d", n.events[i].Sustained, got, level)
+		}
+	}
+
+	cfg.AlertEscalation = []escalationStep{{5 * time.Minute, 1760, 1500}, {time.Minute, 1320, 800}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "AlertEscalation step 2") {
+		t.Errorf("Validate err = %v, want one about out-of-order steps", err)
+	}
+
+	t.Setenv("WATCHER_ALERT_ESCALATION", "1m:loud")
+	if _, err := LoadConfigFromEnv(testConfig()); err == nil {
+		t.Error("a malformed step was accepted")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	framePrefix     = "frame-"
+	annotatedPrefix = "annotated-" // see saveDebugFrames
+)
+
+// frameExts are the extensions pruneFrames treats as frames: every
+// ImageFormat's, so switching formats doesn't strand old files.
+var frameExts = []string{".png", ".jpg"}
+
+// saveFrame writes img into cfg.FrameDir under a timestamped name and prunes
+// the directory down to cfg.MaxFrames files (0 keeps everything). tag, if
+// any, goes after the timestamp, e.g. "-display1".
+func saveFrame(img image.Image, tag string, cfg Config) (string, error) {
+	return saveFrameAs(img, framePrefix, tag, cfg)
+}
+
+// saveFrameAs writes img into cfg.FrameDir as <prefix><timestamp><tag><ext>,
+// with the extension of cfg.ImageFormat, and prunes the files with that
+// prefix down to cfg.MaxFrames.
+func saveFrameAs(img image.Image, prefix, tag string, cfg Config) (string, error) {
+	if err := os.MkdirAll(cfg.FrameDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create frame dir: %w", err)
+	}
+
+	name := prefix + time.Now().Format("20060102-150405.000") + tag + cfg.imageExt()
+	path := filepath.Join(cfg.FrameDir, name)
+	if err := saveImageToFile(img, path, cfg); err != nil {
+		return "", err
+	}
+
+	if cfg.MaxFrames > 0 {
+		if err := pruneFrames(cfg.FrameDir, prefix, cfg.MaxFrames); err != nil {
+			log.Println("error pruning frames:", err)
+		}
+	}
+	return path, nil
+}
+
+// pruneFrames deletes the oldest frames named <prefix>* in dir (by
+// modification time) until at most max remain. Other files are left alone.
+func pruneFrames(dir, prefix string, max int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list frame dir: %w", err)
+	}
+
+	type frameFile struct {
+		path    string
+		modTime time.Time
+	}
+	var frames []frameFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) || !slices.Contains(frameExts, filepath.Ext(e.Name())) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		frames = append(frames, frameFile{filepath.Join(dir, e.Name()), info.ModTime()})
+	}
+	if len(frames) <= max {
+		return nil
+	}
+
+	sort.Slice(frames, func(i, j int) bool { return frames[i].modTime.Before(frames[j].modTime) })
+	for _, f := range frames[:len(frames)-max] {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeOverlay writes img as PNG to path (with tag, if any, before the
+// extension, e.g. overlay-display1.png) for OverlayPath. It writes a temp file
+// beside path and renames it into place, so a viewer polling the file never
+// reads half a frame.
+func writeOverlay(img image.Image, path, tag string) error {
+	if tag != "" {
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + tag + ext
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return nil
+}
+
+// loadRetryDelay is how long loadImage waits before reading a truncated file
+// again: a frame the watcher is still writing looks truncated until it's done.
+const loadRetryDelay = 100 * time.Millisecond
+
+// loadImage reads a saved PNG or JPEG frame, with an error that says what is
+// wrong with the file rather than just the decoder's: missing, empty, not an
+// image, truncated or corrupt, or without pixels. A truncated file is read
+// once more after loadRetryDelay in case it was still being written.
+func loadImage(path string) (image.Image, error) {
+	img, err := decodeImageFile(path)
+	if errors.Is(err, errImageTruncated) {
+		time.Sleep(loadRetryDelay)
+		img, err = decodeImageFile(path)
+	}
+	return img, err
+}
+
+// errImageTruncated is wrapped by loadImage's error for a file cut short.
+var errImageTruncated = errString("is truncated")
+
+// imageTruncated reports whether data starts like a PNG or JPEG but lacks the
+// format's end marker (the IEND chunk, the EOI marker), as a file cut off
+// mid-write does. The decoders' own errors for that vary with where the cut
+// falls.
+func imageTruncated(data []byte) bool {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return !bytes.HasSuffix(data, []byte("IEND\xaeB`\x82"))
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return !bytes.HasSuffix(data, []byte{0xff, 0xd9})
+	}
+	return false
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	name := filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	switch {
+	case errors.Is(err, image.ErrFormat):
+		return nil, fmt.Errorf("%s is not a PNG or JPEG image", name)
+	case err != nil && imageTruncated(data):
+		return nil, fmt.Errorf("%s %w (%d bytes): %v", name, errImageTruncated, len(data), err)
+	case err != nil:
+		return nil, fmt.Errorf("%s is corrupt: %w", name, err)
+	}
+	if b := img.Bounds(); b.Empty() {
+		return nil, fmt.Errorf("%s has no pixels (%dx%d)", name, b.Dx(), b.Dy())
+	}
+	return img, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// alertHistory is a fixed-size ring of the most recent alerts. Alerts are
+// recorded from the alert goroutines and read by /alerts, hence the mutex.
+type alertHistory struct {
+	mu   sync.Mutex
+	buf  []AlertEvent
+	next int  // slot the next alert goes into
+	full bool // buf has wrapped at least once
+}
+
+// recentAlerts backs /alerts. main sizes it from cfg.AlertHistorySize.
+var recentAlerts alertHistory
+
+// setSize clears the history and makes it keep the last n alerts (0 keeps
+// none).
+func (h *alertHistory) setSize(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf, h.next, h.full = make([]AlertEvent, n), 0, false
+}
+
+func (h *alertHistory) add(ev AlertEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.buf) == 0 {
+		return
+	}
+	h.buf[h.next] = ev
+	h.next = (h.next + 1) % len(h.buf)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the stored alerts, oldest first.
+func (h *alertHistory) snapshot() []AlertEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]AlertEvent(nil), h.buf[:h.next]...)
+	}
+	return append(append([]AlertEvent(nil), h.buf[h.next:]...), h.buf[:h.next]...)
+}
+
+// alertHistoryEntry is one alert as served by /alerts.
+type alertHistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Display int       `json:"display"`
+	LineY   int       `json:"lineY"`
+	Price   *float64  `json:"price"` // null when the AI step produced no price
+	Color   string    `json:"color"`
+}
+
+// handleAlerts serves the recent alerts, oldest first, as a JSON array.
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	events := recentAlerts.snapshot()
+	entries := make([]alertHistoryEntry, len(events))
+	for i, ev := range events {
+		entries[i] = alertHistoryEntry{Time: ev.Time, Kind: ev.Kind, Display: ev.Display, LineY: ev.LineY, Color: ev.Color}
+		if !math.IsNaN(ev.Price) {
+			entries[i].Price = &events[i].Price
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		log.Println("alerts encode error:", err)
+	}
+}
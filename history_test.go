@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlertHistoryWraps(t *testing.T) {
+	var h alertHistory
+	h.setSize(3)
+	for y := 1; y <= 5; y++ {
+		h.add(AlertEvent{LineY: y})
+	}
+
+	got := h.snapshot()
+	if len(got) != 3 || got[0].LineY != 3 || got[2].LineY != 5 {
+		t.Errorf("snapshot = %+v, want LineY 3, 4, 5", got)
+	}
+
+	h.setSize(0)
+	h.add(AlertEvent{LineY: 6})
+	if got := h.snapshot(); len(got) != 0 {
+		t.Errorf("size 0 history kept %d alerts", len(got))
+	}
+}
+
+func TestHandleAlerts(t *testing.T) {
+	recentAlerts.setSize(10)
+	defer recentAlerts.setSize(0)
+	recentAlerts.add(AlertEvent{Kind: alertBubble, LineY: 120, Color: "red", Price: 4521.25, Time: time.Now()})
+	recentAlerts.add(AlertEvent{Kind: alertBubble, LineY: 80, Color: "blue", Price: math.NaN(), Time: time.Now()})
+
+	rec := httptest.NewRecorder()
+	handleAlerts(rec, httptest.NewRequest("GET", "/alerts", nil))
+
+	var got []alertHistoryEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].LineY != 120 || *got[0].Price != 4521.25 || got[1].Price != nil {
+		t.Errorf("/alerts = %s", rec.Body)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// idleTracker decides when the chart is probably not on screen: no line for
+// cfg.IdleAfterMisses polls in a row while the ROI is mostly one flat color
+// (a desktop, a blank window). The watcher then polls every IdlePollInterval
+// until a line shows up again.
+type idleTracker struct {
+	misses int
+	idle   bool
+}
+
+// update takes the latest poll's result and returns the poll interval to use
+// from now on.
+func (t *idleTracker) update(res FrameResult, cfg Config) time.Duration {
+	if cfg.IdleAfterMisses <= 0 {
+		return cfg.PollInterval
+	}
+
+	switch {
+	case res.RedLineFound:
+		t.misses = 0
+		if t.idle {
+			t.idle = false
+			slog.Info("line is back, resuming normal polling", "pollInterval", cfg.PollInterval)
+		}
+	case res.Uniformity >= cfg.IdleUniformity:
+		t.misses++
+		if !t.idle && t.misses >= cfg.IdleAfterMisses {
+			t.idle = true
+			slog.Info("chart doesn't look visible, backing off", "misses", t.misses,
+				"uniformity", res.Uniformity, "idlePollInterval", cfg.IdlePollInterval)
+		}
+	default:
+		// no line, but the screen has content: keep polling normally
+		t.misses = 0
+		if t.idle {
+			t.idle = false
+			slog.Info("screen has content again, resuming normal polling", "pollInterval", cfg.PollInterval)
+		}
+	}
+
+	if t.idle {
+		return cfg.IdlePollInterval
+	}
+	return cfg.PollInterval
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestDominantColorShare(t *testing.T) {
+	blank := newFixture(-1, image.Rectangle{})
+	if got := dominantColorShare(blank, blank.Bounds()); got != 1 {
+		t.Errorf("blank frame share = %v, want 1", got)
+	}
+
+	// left half dark, right half white
+	split := newFixture(-1, image.Rect(200, 0, 400, 300))
+	if got := dominantColorShare(split, split.Bounds()); got > 0.6 {
+		t.Errorf("half-white frame share = %v, want about 0.5", got)
+	}
+	if got := dominantColorShare(split, image.Rectangle{}); got != 0 {
+		t.Errorf("empty rect share = %v, want 0", got)
+	}
+}
+
+func TestIdleTracker(t *testing.T) {
+	cfg := testConfig()
+	cfg.IdleAfterMisses = 3
+	cfg.IdlePollInterval = time.Minute
+	cfg.IdleUniformity = 0.9
+
+	var tr idleTracker
+	flat := FrameResult{Uniformity: 1}
+	busy := FrameResult{Uniformity: 0.4}
+	line := FrameResult{RedLineFound: true}
+
+	for i := 1; i <= 2; i++ {
+		if got := tr.update(flat, cfg); got != cfg.PollInterval {
+			t.Fatalf("miss %d: interval = %s, want %s", i, got, cfg.PollInterval)
+		}
+	}
+	if got := tr.update(busy, cfg); got != cfg.PollInterval {
+		t.Fatalf("busy screen: interval = %s, want %s", got, cfg.PollInterval)
+	}
+	// the busy frame reset the count
+	for i := 1; i <= 2; i++ {
+		tr.update(flat, cfg)
+	}
+	if got := tr.update(flat, cfg); got != cfg.IdlePollInterval {
+		t.Fatalf("after %d flat misses: interval = %s, want %s", cfg.IdleAfterMisses, got, cfg.IdlePollInterval)
+	}
+	if got := tr.update(line, cfg); got != cfg.PollInterval {
+		t.Errorf("line back: interval = %s, want %s", got, cfg.PollInterval)
+	}
+
+	cfg.IdleAfterMisses = 0
+	tr = idleTracker{}
+	for range 10 {
+		if got := tr.update(flat, cfg); got != cfg.PollInterval {
+			t.Fatalf("IdleAfterMisses 0: interval = %s, want %s", got, cfg.PollInterval)
+		}
+	}
+}
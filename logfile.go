@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// logBackups is how many rotated log files are kept: LogFilePath.1 (the
+// newest) to LogFilePath.3.
+const logBackups = 3
+
+// rotatingWriter appends to a file and, once a write would take it past
+// maxSize bytes, shifts it to <path>.1 (and older backups up by one, the
+// oldest falling off) and starts a fresh file. maxSize 0 never rotates.
+type rotatingWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	f       *os.File
+	size    int64
+}
+
+func openRotatingWriter(path string, maxSize int64) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	w.f, w.size = f, info.Size()
+	return nil
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			// keep logging to the old file rather than losing the line
+			fmt.Fprintln(os.Stderr, "log rotation failed:", err)
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups along and reopens path empty. w.mu must be held.
+func (w *rotatingWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	for i := logBackups - 1; i >= 1; i-- {
+		if err := os.Rename(w.backup(i), w.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return w.reopen(err)
+		}
+	}
+	if err := os.Rename(w.path, w.backup(1)); err != nil {
+		return w.reopen(err)
+	}
+	return w.open()
+}
+
+// reopen reopens the current file after a failed rotation and returns the
+// rotation error.
+func (w *rotatingWriter) reopen(rotateErr error) error {
+	if err := w.open(); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+func (w *rotatingWriter) backup(i int) string {
+	return w.path + "." + strconv.Itoa(i)
+}
+
+// setMaxSize changes the rotation size, e.g. on reload.
+func (w *rotatingWriter) setMaxSize(maxSize int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxSize = maxSize
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
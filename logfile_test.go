@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	w, err := openRotatingWriter(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := strings.Repeat("x", 39) + "\n" // 40 bytes: two fit in 100, a third doesn't
+	for range 12 {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(name), err)
+		}
+		if len(data) != 80 {
+			t.Errorf("%s holds %d bytes, want 80", filepath.Base(name), len(data))
+		}
+	}
+	if _, err := os.Stat(path + ".4"); !os.IsNotExist(err) {
+		t.Errorf("found a 4th backup; only %d should be kept", logBackups)
+	}
+}
+
+func TestSetupLoggingFile(t *testing.T) {
+	t.Cleanup(func() { setupLogging(defaultConfig()) })
+
+	cfg := defaultConfig()
+	cfg.LogFilePath = filepath.Join(t.TempDir(), "watcher.log")
+	for _, format := range []string{"text", "json"} {
+		cfg.LogFormat = format
+		if err := setupLogging(cfg); err != nil {
+			t.Fatal(err)
+		}
+		log.Println("hello from", format)
+	}
+	open := logFile
+
+	if err := setupLogging(defaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if logFile != nil {
+		t.Error("the log file stays open after LogFilePath is cleared")
+	}
+	if _, err := open.Write([]byte("late\n")); err == nil {
+		t.Error("the previous log file wasn't closed")
+	}
+
+	slog.Info("back on stderr")
+	data, err := os.ReadFile(cfg.LogFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"hello from text", `"msg":"hello from json"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file %q doesn't contain %q", data, want)
+		}
+	}
+	if strings.Contains(string(data), "back on stderr") {
+		t.Error("slog still writes to the log file after switching back to stderr")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"os"
+)
+
+// setupLogging installs the slog handler selected by cfg.LogFormat:
+//
+//	"text" keeps the classic log-package output (timestamp + message, with
+//	       structured fields appended as key=value)
+//	"json" emits one JSON record per event for log aggregators
+//
+// Plain log.Print calls are routed through the same handler. Either format
+// goes to stderr, or to cfg.LogFilePath, rotated by size (see rotatingWriter).
+func setupLogging(cfg Config) error {
+	level := slog.LevelInfo
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", cfg.LogLevel, err)
+		}
+	}
+	if cfg.LogFormat != "" && cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("unknown log format %q (want \"text\" or \"json\")", cfg.LogFormat)
+	}
+
+	prev := logFile
+	out, err := logOutput(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.LogFormat == "json" {
+		h := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level})
+		slog.SetDefault(slog.New(h))
+	} else {
+		slog.SetDefault(textLogger) // undoes a previous "json"
+		log.SetOutput(out)
+		log.SetFlags(log.LstdFlags)
+		slog.SetLogLoggerLevel(level)
+	}
+	if prev != nil && prev != logFile {
+		prev.Close() // nothing logs to it any more
+	}
+	return nil
+}
+
+// textLogger is slog's built-in default, which writes through the log package.
+var textLogger = slog.Default()
+
+// logFile is the open LogFilePath, if any; setupLogging keeps it across
+// reloads that leave the path alone.
+var logFile *rotatingWriter
+
+// logOutput returns where logs go under cfg and points logFile at it,
+// opening LogFilePath unless it is already open. Closing a previous file is up
+// to the caller, once nothing writes to it.
+func logOutput(cfg Config) (io.Writer, error) {
+	maxSize := int64(cfg.LogMaxSizeMB) << 20
+	switch {
+	case cfg.LogFilePath == "":
+		logFile = nil
+		return os.Stderr, nil
+	case logFile != nil && logFile.path == cfg.LogFilePath:
+		logFile.setMaxSize(maxSize)
+		return logFile, nil
+	}
+	w, err := openRotatingWriter(cfg.LogFilePath, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	logFile = w
+	return w, nil
+}
+
+// Event names used as the "event" field on structured records.
+const (
+	eventFrame   = "frame_processed"
+	eventLine    = "line_found"
+	eventBubble  = "bubble_detected"
+	eventAlert   = "alert_fired"
+	eventAIPrice = "ai_price"
+)
+
+// priceAttr is the stockPrice field for a possibly-missing (NaN) price. JSON
+// has no NaN, so a missing price is logged as null.
+func priceAttr(price float64) slog.Attr {
+	if math.IsNaN(price) {
+		return slog.Any("stockPrice", nil)
+	}
+	return slog.Float64("stockPrice", price)
+}
@@ -2,310 +2,1212 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
+	"image/jpeg"
 	"image/png"
 	"io"
 	"log"
+	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/gen2brain/beeep"
 	"github.com/kbinani/screenshot"
 )
 
-// Config lets you tune detection.
-type Config struct {
-	PollInterval            time.Duration
-	RedMinR                 uint8
-	RedMaxG                 uint8
-	RedMaxB                 uint8
-	MinRedPixelsPerRow      int
-	MaxDistanceBubbleToLine int
-	BubbleBrightThreshold   int
-	BubbleMinBrightPixels   int
-	ROIMarginPercent        float64
+func main() {
+	once := flag.Bool("once", false, "run a single detection pass, print the result as JSON and exit (0 = alert, 1 = no alert, 2 = error)")
+	calibrateMode := flag.Bool("calibrate", false, "capture one frame, print what detection sees and suggested thresholds, and exit")
+	jsonOutput := flag.Bool("json", false, "with -calibrate, print the calibration as JSON, suggestions keyed by environment variable")
+	selectROI := flag.Bool("select-roi", false, "capture one frame to "+roiSelectFile+", ask for the rectangle to scan, print it as WATCHER_ROI_RECT (saved to -config if given) and exit")
+	roiFlag := flag.String("roi", "", `with -select-roi, the rectangle as "x0,y0,x1,y1" instead of asking`)
+	listDisplays := flag.Bool("list-displays", false, "print each display's index and bounds and the virtual desktop's, for DisplayIndex and CaptureRegion, and exit")
+	showVersion := flag.Bool("version", false, "print version, commit and Go version and exit")
+	replayDir := flag.String("replay", "", "run detection over the frames saved in this directory, print one JSON line per file and exit; nothing is captured or alerted")
+	profile := flag.Bool("profile", false, "serve the net/http/pprof handlers on ProfileAddr (localhost only by default)")
+	configPath := flag.String("config", "", "read settings from this file of WATCHER_*=value lines (the environment still wins); reloaded on SIGHUP")
+	flag.Parse()
+
+	build := readBuildVersion()
+	if *showVersion {
+		fmt.Println(build)
+		return
+	}
+	if *listDisplays {
+		os.Exit(writeDisplays(os.Stdout, screenshot.NumActiveDisplays(), screenshot.GetDisplayBounds))
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("invalid settings:\n%v", err)
+	}
+
+	if err := setupLogging(cfg); err != nil {
+		log.Fatalln("logging:", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+	slog.Info("starting", "version", build.Version, "commit", build.Commit, "go", build.Go)
+	slog.Info("effective config", "config", cfg)
+
+	recentAlerts.setSize(cfg.AlertHistorySize)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *replayDir != "" {
+		code := runReplay(ctx, *replayDir, cfg, os.Stdout)
+		stop()
+		os.Exit(code)
+	}
+
+	w, err := newWatcher(cfg)
+	if err != nil {
+		log.Fatalf("failed to set up watcher: %v", err)
+	}
+
+	if *calibrateMode {
+		os.Exit(w.runCalibrate(os.Stdout, *jsonOutput))
+	}
+	if *selectROI {
+		os.Exit(w.runSelectROI(os.Stdin, os.Stdout, *roiFlag, *configPath))
+	}
+	if cfg.AlertLogPath != "" {
+		if alertLog, err = openAlertLog(cfg.AlertLogPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *once {
+		code := w.runOnce(ctx)
+		if err := w.Close(); err != nil {
+			log.Println("close error:", err)
+		}
+		if err := alertLog.Close(); err != nil {
+			log.Println("alert log close error:", err)
+		}
+		stop()
+		os.Exit(code)
+	}
+
+	if cfg.StatePath != "" {
+		loadMetricsState(cfg.StatePath)
+	}
+	atStart := metrics.snapshot()
+
+	if err := w.selfCheck(ctx); err != nil {
+		if ctx.Err() != nil {
+			os.Exit(0) // interrupted while retrying
+		}
+		log.Fatalln("startup self-check failed:", err)
+	}
+
+	log.Println("Bookmap watcher started...")
+	started := time.Now()
+	if cfg.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxRuntime)
+		defer cancel()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			w.reload(*configPath)
+		}
+	}()
+	usr1 := make(chan os.Signal, 1)
+	notifyPauseToggle(usr1)
+	go func() {
+		for range usr1 {
+			togglePaused()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	if cfg.MetricsAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveMetrics(ctx, cfg.MetricsAddr, cfg.StreamFrames)
+		}()
+	}
+	if *profile {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveProfile(ctx, cfg.ProfileAddr)
+		}()
+	}
+	if cfg.StatePath != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			saveStatePeriodically(ctx, cfg.StatePath, cfg.StateSaveInterval)
+		}()
+	}
+
+	w.run(ctx)
+	alertsInFlight.Wait()
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		log.Println("close error:", err)
+	}
+	if err := alertLog.Close(); err != nil {
+		log.Println("alert log close error:", err)
+	}
+	if cfg.StatePath != "" {
+		if err := saveMetricsState(cfg.StatePath); err != nil {
+			log.Println("state save error:", err)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Info("MaxRuntime reached", "maxRuntime", cfg.MaxRuntime)
+	}
+	slog.Info("run summary", "uptime", time.Since(started).Round(time.Second),
+		"framesProcessed", metrics.framesProcessed.Load()-atStart.FramesProcessed,
+		"alertsFired", metrics.alertsFired.Load()-atStart.AlertsFired)
 }
 
-func main() {
-	cfg := Config{
-		PollInterval:            10 * time.Second,
-		RedMinR:                 180,
-		RedMaxG:                 120, // allow orange/yellow, not just pure red
-		RedMaxB:                 120,
-		MinRedPixelsPerRow:      500,  // tune by screen size
-		MaxDistanceBubbleToLine: 10,   // pixels above/below line
-		BubbleBrightThreshold:   600,  // r+g+b >= this
-		BubbleMinBrightPixels:   150,  // how many “bright” pixels = bubble
-		ROIMarginPercent:        0.10, // ignore outer 10% around screen
+// Watcher runs the detection loop. Its dependencies are fields so tests can
+// swap them out.
+type Watcher struct {
+	cfg        Config // only touched by the goroutine calling run; see reload
+	pending    atomic.Pointer[Config]
+	capture    func(display int) (image.Image, error)                        // grabs the frame to scan
+	clock      Clock                                                         // what the alerting logic thinks the time is
+	cursor     func(display int, bounds image.Rectangle) (image.Point, bool) // for IgnoreCursorRegion; see cursorInCapture
+	screens    func() []image.Rectangle                                      // the active displays' bounds; see checkLayout
+	confirm    *confirmTracker
+	sustain    *sustainTracker
+	cooldown   *alertCooldown
+	rearm      *rearmTracker
+	ai         *aiQueue
+	scanMu     sync.Mutex   // held by checkDisplay except while it waits on ai; see checkOnce
+	aiClient   *http.Client // shared by every AI call so connections are reused; see newAIClient
+	breaker    *aiBreaker
+	lastAI     map[int]aiPrice         // per display, for AIMinInterval; only touched by checkOnce
+	readings   map[int]float64         // per display, the last price the AI returned; for RequirePriceChange
+	lineYs     map[int]int             // per display, the strongest line's Y last poll; for LineMoveThreshold
+	smoother   *lineSmoother           // for LineSmoothing
+	blinks     *blinkFrames            // for DetectBlinkingBubble
+	rowCaches  map[int]*rowCache       // per display, for DiffScan
+	layout     []image.Rectangle       // the display bounds as of the last poll; nil before the first
+	frameSizes map[int]image.Rectangle // per display, the last capture's bounds
+	notifiers  []Notifier              // where alerts go
+	results    *resultsLog             // nil unless cfg.ResultsLogPath is set
+	polls      int                     // polls run so far, up to WarmupPolls
+}
+
+// newWatcher returns a Watcher that captures cfg's displays and alerts
+// through the notifiers named in cfg.Notifiers.
+func newWatcher(cfg Config) (*Watcher, error) {
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		cfg:        cfg,
+		clock:      realClock{},
+		confirm:    newConfirmTracker(),
+		sustain:    newSustainTracker(),
+		cooldown:   newAlertCooldown(cfg.AlertCooldown),
+		rearm:      newRearmTracker(),
+		ai:         newAIQueue(cfg.AIConcurrency),
+		aiClient:   newAIClient(cfg),
+		breaker:    newAIBreaker(cfg.AIBreakerFailures, cfg.AIBreakerCooldown),
+		lastAI:     map[int]aiPrice{},
+		readings:   map[int]float64{},
+		lineYs:     map[int]int{},
+		smoother:   newLineSmoother(),
+		blinks:     newBlinkFrames(),
+		rowCaches:  map[int]*rowCache{},
+		frameSizes: map[int]image.Rectangle{},
+		screens:    activeDisplays,
+		notifiers:  notifiers,
+	}
+	w.capture = func(display int) (image.Image, error) { return captureTarget(w.cfg, display) }
+	w.cursor = func(display int, bounds image.Rectangle) (image.Point, bool) {
+		return cursorInCapture(w.cfg, display, bounds)
+	}
+	if cfg.ResultsLogPath != "" {
+		if w.results, err = openResultsLog(cfg.ResultsLogPath); err != nil {
+			return nil, err
+		}
 	}
+	return w, nil
+}
+
+// Close releases what newWatcher opened.
+func (w *Watcher) Close() error {
+	w.aiClient.CloseIdleConnections()
+	return w.results.Close()
+}
 
-	log.Println("Bookmap watcher (macOS) started...")
+// run polls until ctx is cancelled. Polls start on a fixed PollInterval
+// cadence however long each one takes; a poll that overruns makes the ticks
+// it covered be skipped rather than queued. A poll that is already underway
+// is allowed to finish; cancellation is only checked between polls.
+//
+// While the chart looks closed (see idleTracker) polls slow down to
+// IdlePollInterval. A config queued by reload takes over before the next
+// poll.
+func (w *Watcher) run(ctx context.Context) {
+	cfg := w.cfg
+	interval := cfg.PollInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	idle := idleTracker{}
 
 	for {
-		if err := checkOnce(cfg); err != nil {
-			log.Println("error:", err)
+		if next := w.pending.Swap(nil); next != nil {
+			w.applyConfig(*next)
+			cfg, interval, idle = w.cfg, w.cfg.PollInterval, idleTracker{}
+			ticker.Reset(interval)
+		}
+
+		res, err := w.checkOnce(ctx)
+		w.results.write(res, err)
+		if err != nil {
+			slog.Error("poll failed", "err", err)
+		} else {
+			metrics.lastPollUnixNs.Store(time.Now().UnixNano())
+		}
+		if w.warmedUp(cfg, res.Alerts) {
+			dispatchAlerts(ctx, res.Alerts, w.notifiers, cfg)
+		}
+
+		if skipped := int(res.Timings.Total / interval); skipped > 0 {
+			// the slow-frame warning with the per-phase breakdown has
+			// already been logged by checkOnce
+			slog.Info("poll overran the interval, skipping ticks",
+				"took", res.Timings.Total, "pollInterval", interval, "skipped", skipped)
+		}
+		if err == nil {
+			if next := idle.update(res, cfg); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down")
+			return
+		case <-ticker.C:
 		}
-		time.Sleep(cfg.PollInterval)
 	}
 }
 
-func checkOnce(cfg Config) error {
-	img, err := captureMainDisplay()
+// warmedUp counts a poll towards WarmupPolls and reports whether warmup is
+// over, so this poll's alerts may go out. The alerts held back during warmup
+// started cooldowns; those are cleared when it ends, so a condition that is
+// still there alerts straight away.
+func (w *Watcher) warmedUp(cfg Config, alerts []AlertEvent) bool {
+	if w.polls >= cfg.WarmupPolls {
+		return true
+	}
+	w.polls++
+	if len(alerts) > 0 {
+		slog.Info("warming up, alerts held back", "poll", w.polls, "warmupPolls", cfg.WarmupPolls, "alerts", len(alerts))
+	}
+	if w.polls == cfg.WarmupPolls {
+		w.cooldown, w.rearm = newAlertCooldown(cfg.AlertCooldown), newRearmTracker()
+		slog.Info("warmup complete, alerting from the next poll", "warmupPolls", cfg.WarmupPolls)
+	}
+	return false
+}
 
+// runOnce does a single detection pass for -once and prints the result to
+// stdout as JSON. It returns the process exit code.
+func (w *Watcher) runOnce(ctx context.Context) int {
+	res, err := w.checkOnce(ctx)
+	w.results.write(res, err)
+	dispatchAlerts(ctx, res.Alerts, w.notifiers, w.cfg)
+	alertsInFlight.Wait()
 	if err != nil {
-		return err
+		slog.Error("poll failed", "err", err)
+		return 2
 	}
 
-	roi := centralROI(img.Bounds(), cfg.ROIMarginPercent)
+	out := struct {
+		Alert   bool     `json:"alert"`
+		LineY   *int     `json:"lineY"`
+		Display *int     `json:"display"`
+		Price   *float64 `json:"price"`
+	}{Alert: res.BubbleDetected}
+	if res.RedLineFound {
+		out.LineY, out.Display = &res.RedLineY, &res.Display
+	}
+	if !math.IsNaN(res.StockPrice) {
+		out.Price = &res.StockPrice
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+		slog.Error("failed to write result", "err", err)
+		return 2
+	}
 
-	// TODO: if you want a real ML step to check “is Bookmap open?”,
-	// put it here. For now we assume Bookmap is visible in ROI.
+	if res.BubbleDetected {
+		return 0
+	}
+	return 1
+}
 
-	lineY, ok := findRedLine(img, roi, cfg)
+// aiPrice is the outcome of a display's last AI call.
+type aiPrice struct {
+	at    time.Time
+	price float64 // NaN if the call failed
+}
 
-	log.Println("img ", img)
+// FrameResult summarizes one poll. checkOnce only decides which alerts are
+// due; firing them is up to the caller (see dispatchAlerts).
+type FrameResult struct {
+	RedLineY       int          // the line a bubble was found at, else the strongest line
+	RedLineFound   bool         // at least one line was detected
+	LineConfidence float64      // Line.Confidence of RedLineY
+	LineColor      string       // Line.RGB of RedLineY as #rrggbb
+	Display        int          // display RedLineY is on
+	BubbleDetected bool         // a bubble sat on one of the lines
+	StockPrice     float64      // NaN when the AI step was skipped
+	PriceStale     bool         // StockPrice was reused from an earlier frame; see AIMinInterval
+	Alerts         []AlertEvent // alerts due this frame
+	Timings        pollTimings  // summed over the displays
+	Uniformity     float64      // share of the ROI that is one color, on displays with no line; see idleTracker
+}
 
-	// Save image to file
-	imgFilePath := "current_screenshot.png"
-	if err := saveImageToFile(img, imgFilePath); err != nil {
-		log.Println("error saving image:", err)
+// checkOnce scans every display in cfg.displays(). A display that fails
+// doesn't stop the others being scanned; the errors are joined.
+//
+// With several displays each is scanned on its own goroutine, so their AI
+// requests can be in flight together, up to AIConcurrency (see aiQueue).
+// Everything else checkDisplay does holds scanMu, as the watcher's state
+// isn't safe for concurrent use. Each display fills its own FrameResult and
+// they are merged in display order, so the result is as if the displays had
+// been scanned one after another.
+func (w *Watcher) checkOnce(ctx context.Context) (res FrameResult, err error) {
+	cfg := w.cfg
+	res = FrameResult{StockPrice: math.NaN()}
+
+	start := time.Now()
+	defer func() {
+		res.Timings.Total = time.Since(start)
+		res.Timings.record(cfg)
+	}()
+	defer w.confirm.endFrame()
+	defer w.sustain.endFrame()
+	defer w.rearm.endFrame(cfg.RearmAfterClearPolls)
+	defer w.ai.endPoll()
+
+	w.checkLayout(cfg)
+	displays := cfg.displays()
+	if len(displays) == 1 {
+		err := w.checkDisplay(ctx, displays[0], false, &res)
+		return res, err
+	}
+
+	results := make([]FrameResult, len(displays))
+	errs := make([]error, len(displays))
+	var wg sync.WaitGroup
+	for i, display := range displays {
+		results[i] = FrameResult{StockPrice: math.NaN()}
+		wg.Go(func() {
+			if err := w.checkDisplay(ctx, display, true, &results[i]); err != nil {
+				errs[i] = fmt.Errorf("display %d: %w", display, err)
+			}
+		})
+	}
+	wg.Wait()
+	for _, r := range results {
+		res.merge(r)
+	}
+	return res, errors.Join(errs...)
+}
+
+// merge folds r, the result of the next display in scan order, into res:
+// a bubble's line wins over a line without one, and otherwise the first
+// display's line and price stand.
+func (res *FrameResult) merge(r FrameResult) {
+	switch {
+	case r.BubbleDetected && !res.BubbleDetected:
+		res.RedLineY, res.RedLineFound, res.BubbleDetected, res.Display = r.RedLineY, true, true, r.Display
+		res.LineConfidence, res.LineColor = r.LineConfidence, r.LineColor
+		res.StockPrice, res.PriceStale = r.StockPrice, r.PriceStale
+	case r.RedLineFound && !res.RedLineFound:
+		res.RedLineY, res.RedLineFound, res.Display = r.RedLineY, true, r.Display
+		res.LineConfidence, res.LineColor = r.LineConfidence, r.LineColor
+	}
+	if math.IsNaN(res.StockPrice) {
+		res.StockPrice, res.PriceStale = r.StockPrice, r.PriceStale
+	}
+	res.Alerts = append(res.Alerts, r.Alerts...)
+	res.Timings.add(r.Timings)
+	res.Uniformity = max(res.Uniformity, r.Uniformity)
+}
+
+// checkDisplay captures and scans one display, merging what it finds into res.
+// tagged is set when several displays are scanned, so saved frames get the
+// display in their name.
+func (w *Watcher) checkDisplay(ctx context.Context, display int, tagged bool, res *FrameResult) (err error) {
+	w.scanMu.Lock()
+	defer w.scanMu.Unlock()
+	cfg := w.cfg
+	last := time.Now()
+	lap := func() time.Duration {
+		now := time.Now()
+		d := now.Sub(last)
+		last = now
+		return d
+	}
+
+	img, err := w.capture(display)
+	res.Timings.Capture += lap()
+	if err != nil {
 		return err
 	}
+	w.checkFrameSize(cfg, display, img.Bounds())
 
-	// Pass image to AI model to find maximum order red line
-	stockPrice, err := getStockPriceFromAI(imgFilePath)
+	roi, err := cfg.detectionROI(img.Bounds())
 	if err != nil {
-		log.Println("error getting stock price from AI:", err)
 		return err
 	}
 
-	log.Printf("Stock price detected: $%.2f\n", stockPrice)
+	// Detection can run on a downscaled copy (ScaleDivisor); scan, scanCfg
+	// and roi are in its coordinates and toFull/toFullX map results back. The
+	// saved frame and the AI always get the full-resolution img.
+	fullROI := roi
+	scan, scanCfg := image.Image(img), cfg
+	toFull, toFullX := func(l Line) Line { return l }, func(x int) int { return x }
+	toFullRect := func(r image.Rectangle) image.Rectangle { return r }
+	if d := cfg.ScaleDivisor; d > 1 {
+		origin := img.Bounds().Min
+		scan, scanCfg = downscale(img, d), cfg.scaledBy(d)
+		roi = image.Rectangle{Min: roi.Min.Sub(origin).Div(d), Max: roi.Max.Sub(origin).Div(d)}
+		toFull = func(l Line) Line { return scaleLineUp(l, d, origin) }
+		toFullX = func(x int) int { return origin.X + x*d }
+		toFullRect = func(r image.Rectangle) image.Rectangle {
+			return image.Rectangle{Min: r.Min.Mul(d).Add(origin), Max: r.Max.Mul(d).Add(origin)}
+		}
+	}
 
-	if !ok {
-		return nil // no red line this frame
+	if cfg.IgnoreCursorRegion {
+		if p, ok := w.cursor(display, img.Bounds()); ok {
+			if d := cfg.ScaleDivisor; d > 1 {
+				p = p.Sub(img.Bounds().Min).Div(d)
+			}
+			scan = maskCursor(scan, p, scanCfg.CursorRadius)
+			slog.Debug("cursor masked", "display", display, "x", p.X, "y", p.Y, "radius", scanCfg.CursorRadius)
+		}
 	}
 
-	if bubbleAtLine(img, roi, lineY, cfg) {
-		go triggerAlert(lineY)
+	var cache *rowCache
+	if cfg.DiffScan {
+		if cache = w.rowCaches[display]; cache == nil {
+			cache = newRowCache()
+			w.rowCaches[display] = cache
+		}
+	} else {
+		delete(w.rowCaches, display)
 	}
-	return nil
-}
+	lines := findRedLinesCached(scan, roi, scanCfg, cache)
+	// what the bubble search looks at; merged every poll, line or not, so
+	// the previous frame is always the one just before
+	bubbleScan := scan
+	if cfg.DetectBlinkingBubble {
+		bubbleScan = w.blinks.merge(display, scan, roi, scanCfg)
+	}
+	if len(lines) == 0 {
+		// a cheap "is Bookmap open?" signal for the idle backoff in run
+		res.Uniformity = max(res.Uniformity, dominantColorShare(scan, roi))
+	}
+	// the strongest line, in scan and full-res coordinates; Y -1 if none
+	scanBest, best, bestIdx := Line{Y: -1}, Line{Y: -1}, -1
+	for i, line := range lines {
+		if line.Pixels > scanBest.Pixels {
+			scanBest, best, bestIdx = line, toFull(line), i
+		}
+	}
+	if bestIdx >= 0 {
+		// the stabilized Y stands in for the raw one from here on: in the
+		// bubble search, the AI hints and the move check
+		scanBest.Y = w.smoother.add(display, scanBest.Y, cfg.LineSmoothing)
+		lines[bestIdx], best = scanBest, toFull(scanBest)
+	} else {
+		w.smoother.reset(display)
+	}
+	lineY := best.Y
+	if lineY >= 0 && !res.RedLineFound {
+		res.RedLineY, res.RedLineFound, res.Display = lineY, true, display
+		res.LineConfidence, res.LineColor = best.Confidence, hexColor(best.RGB)
+	}
+	res.Timings.LineScan += lap()
+	metrics.framesProcessed.Add(1)
+	metrics.linesFound.Add(int64(len(lines)))
 
-// captureMainDisplay grabs display 0 on macOS.
-func captureMainDisplay() (image.Image, error) {
-	if screenshot.NumActiveDisplays() == 0 {
-		return nil, errString("no active displays found")
+	slog.Info("frame processed", "event", eventFrame, "display", display,
+		"width", img.Bounds().Dx(), "height", img.Bounds().Dy(), "lines", len(lines))
+
+	// Save image to file for debugging, plus a copy annotated with what was
+	// detected, and write the annotated copy to OverlayPath, once detection
+	// and alerting are done: saving is the least important step, so a failed
+	// write (a full disk, say) is logged and the poll goes on unless
+	// SaveFailureFatal makes a failed save fail the poll. Don't start a new
+	// write once shutdown has begun.
+	tag := ""
+	if tagged {
+		tag = "-display" + strconv.Itoa(display)
+	}
+	if cfg.SaveFrames || cfg.OverlayPath != "" {
+		defer func() {
+			if ctx.Err() != nil {
+				return
+			}
+			annotated := annotateFrame(img, fullROI, best, cfg)
+			var saveErr error
+			if cfg.SaveFrames {
+				saveErr = saveDebugFrames(img, annotated, tag, cfg)
+			}
+			if cfg.OverlayPath != "" {
+				if err := writeOverlay(annotated, cfg.OverlayPath, tag); err != nil {
+					log.Println("error writing overlay:", err) // like a failed save, not worth failing the poll over
+				}
+			}
+			res.Timings.Save += lap()
+			if saveErr != nil && cfg.SaveFailureFatal {
+				err = errors.Join(err, saveErr)
+			}
+		}()
 	}
-	return screenshot.CaptureDisplay(0)
-}
 
-// centralROI cuts off a margin around the screen (menu bar / dock / junk).
-func centralROI(bounds image.Rectangle, marginPct float64) image.Rectangle {
-	w := bounds.Dx()
-	h := bounds.Dy()
+	if cfg.StreamFrames {
+		frame := image.Image(img)
+		if cfg.StreamAnnotated {
+			frame = annotateFrame(img, fullROI, best, cfg)
+		}
+		liveFrames.publish(frame, cfg.JPEGQuality)
+	}
 
-	marginX := int(float64(w) * marginPct)
-	marginY := int(float64(h) * marginPct)
+	res.Timings.Save += lap()
 
-	return image.Rect(
-		bounds.Min.X+marginX,
-		bounds.Min.Y+marginY,
-		bounds.Max.X-marginX,
-		bounds.Max.Y-marginY,
-	)
-}
+	// Pass image to AI model to find maximum order red line. NaN means no
+	// price this frame. With no line there is nothing to price, so skip the
+	// request unless AIAlwaysRun asks for it anyway. A failed request is
+	// reported but doesn't stop the bubble check; alerts then go out without
+	// a price, subject to the price gate.
+	//
+	// With AIMinInterval, a frame too soon after the display's last call
+	// reuses that call's price instead, marked stale. priceMoved is whether a
+	// fresh price differs from the display's previous one by MinPriceDelta.
+	stockPrice, stale, priceMoved := math.NaN(), false, false
+	var aiErr error
+	callAI := cfg.AIEndpoint != "" && (len(lines) > 0 || cfg.AIAlwaysRun)
+	if last, ok := w.lastAI[display]; callAI && ok && w.clock.Now().Sub(last.at) < cfg.AIMinInterval {
+		callAI, stockPrice, stale = false, last.price, true
+		slog.Info("AI call skipped, reusing the previous price", "display", display, priceAttr(stockPrice),
+			"age", w.clock.Now().Sub(last.at).Round(time.Millisecond), "stale", true)
+	}
+	if callAI {
+		calledAt := w.clock.Now()
+		buf, err := encodeImage(img, cfg)
+		if err != nil {
+			return err
+		}
+		// the bright blob next to the strongest line, in full-res pixels
+		var blob image.Rectangle
+		if scanBest.Y >= 0 && (cfg.SendDetectionHints || cfg.EnableOCRFallback) {
+			region := bubbleRegion(roi, scanBest, scanCfg)
+			_, box := brightBlob(scan, region, scanCfg.withBubbleThreshold(scan, roi, region))
+			blob = toFullRect(box)
+		}
+		var hints url.Values
+		if cfg.SendDetectionHints {
+			hints = detectionHints(lineY, fullROI, blob)
+		}
+		aiErr = errAICircuitOpen
+		if w.breaker.allow(w.clock.Now()) {
+			key := aiRequestKey(img, hints)
+			w.scanMu.Unlock() // let the other displays scan, and query, meanwhile
+			stockPrice, aiErr = w.ai.do(ctx, key, func() (float64, error) {
+				return getStockPriceFromAIBytes(ctx, w.aiClient, buf, hints, cfg)
+			})
+			w.scanMu.Lock()
+			if ctx.Err() == nil { // shutting down isn't the endpoint's fault
+				w.breaker.record(aiErr, w.clock.Now())
+			}
+		}
+		source := priceSourceAI
+		if aiErr == nil && !cfg.priceInRange(stockPrice) {
+			metrics.aiPricesRejected.Add(1)
+			aiErr = fmt.Errorf("price %v is outside AIPriceMin/AIPriceMax %v/%v", stockPrice, cfg.AIPriceMin, cfg.AIPriceMax)
+		}
+		if aiErr != nil {
+			log.Println("error getting stock price from AI:", aiErr)
+			stockPrice = math.NaN()
+			if cfg.EnableOCRFallback && !blob.Empty() {
+				if p, err := readPriceOCR(ctx, img, blob); err != nil {
+					log.Println("OCR fallback failed:", err)
+				} else if !cfg.priceInRange(p) {
+					metrics.aiPricesRejected.Add(1)
+					log.Printf("OCR fallback failed: price %v is outside AIPriceMin/AIPriceMax %v/%v\n", p, cfg.AIPriceMin, cfg.AIPriceMax)
+				} else {
+					stockPrice, aiErr, source = p, nil, priceSourceOCR
+				}
+			}
+		}
+		if aiErr == nil {
+			slog.Info("stock price detected", "event", eventAIPrice, "display", display, "stockPrice", stockPrice, "source", source)
+			prev, ok := w.readings[display]
+			priceMoved = ok && math.Abs(stockPrice-prev) >= cfg.MinPriceDelta
+			w.readings[display] = stockPrice
+			// a failed read isn't kept, so the next poll tries again rather
+			// than serving NaN for the rest of AIMinInterval
+			w.lastAI[display] = aiPrice{at: calledAt, price: stockPrice}
+		}
+	}
+	if math.IsNaN(res.StockPrice) {
+		res.StockPrice, res.PriceStale = stockPrice, stale
+	}
+	res.Timings.AI += lap()
 
-// findRedLine searches each row in ROI for one with a lot of red/orange pixels.
-func findRedLine(img image.Image, roi image.Rectangle, cfg Config) (int, bool) {
-	maxCount := 0
-	bestY := -1
+	defer func() { res.Timings.BubbleScan += lap() }()
+	if len(lines) == 0 {
+		return aiErr // no red line this frame
+	}
 
-	for y := roi.Min.Y; y < roi.Max.Y; y++ {
-		count := 0
-		for x := roi.Min.X; x < roi.Max.X; x++ {
-			r16, g16, b16, _ := img.At(x, y).RGBA()
-			r := uint8(r16 >> 8)
-			g := uint8(g16 >> 8)
-			b := uint8(b16 >> 8)
+	priceOK := cfg.priceGateOK(stockPrice)
+	if !priceOK {
+		slog.Info("price gate not met, alerts held back", "display", display, priceAttr(stockPrice),
+			"above", cfg.AlertPriceAbove, "below", cfg.AlertPriceBelow)
+	} else if cfg.RequirePriceChange && !priceMoved {
+		// a line and bubble on a static chart aren't news
+		priceOK = false
+		slog.Info("AI price hasn't moved, alerts held back", "display", display, priceAttr(stockPrice),
+			"minPriceDelta", cfg.MinPriceDelta, "stale", stale)
+	}
+	// while alerts are paused nothing may fire, so the alerts are dropped
+	// before they can start a cooldown or disarm a line: once resumed, a
+	// bubble still at its line alerts on the next poll
+	paused := alertsPaused.Load()
+	heldByPause := func(kind string, line Line) bool {
+		if paused {
+			slog.Info("alerts paused, not raising", "kind", kind, "display", display, "color", line.Color, "lineY", line.Y)
+		}
+		return paused
+	}
 
-			if isLineRed(r, g, b, cfg) {
-				count++
+	for _, scanLine := range lines {
+		if bubble, ok := bubbleAtLine(bubbleScan, roi, scanLine, scanCfg); ok {
+			line := toFull(scanLine)
+			metrics.bubblesDetected.Add(1)
+			sustained := w.sustain.hit(keyForLine(display, line), w.clock.Now())
+			w.rearm.hit(keyForLine(display, line))
+			if !res.BubbleDetected {
+				res.RedLineY, res.BubbleDetected, res.Display = line.Y, true, display
+				res.LineConfidence, res.LineColor = line.Confidence, hexColor(line.RGB)
+				res.StockPrice, res.PriceStale = stockPrice, stale
+			}
+			if n := w.confirm.hit(keyForLine(display, line), line.Confidence); n < float64(cfg.ConfirmFrames) {
+				slog.Info("bubble not yet confirmed", "display", display, "lineY", line.Y, "frames", n, "need", cfg.ConfirmFrames)
+				continue
+			}
+			if !priceOK || heldByPause(alertBubble, line) {
+				continue
+			}
+			if cfg.RearmAfterClearPolls > 0 && !w.rearm.armed(keyForLine(display, line)) {
+				slog.Debug("bubble alert not re-armed, waiting for the bubble to clear", "display", display,
+					"color", line.Color, "lineY", line.Y, "clearPolls", cfg.RearmAfterClearPolls)
+				continue
+			}
+			if !w.cooldown.allow(alertBubble, keyForLine(display, line), w.clock.Now()) {
+				slog.Debug("bubble alert in cooldown", "display", display, "color", line.Color, "lineY", line.Y)
+				continue
 			}
+			if cfg.RearmAfterClearPolls > 0 {
+				w.rearm.fired(keyForLine(display, line))
+			}
+			res.Alerts = append(res.Alerts, AlertEvent{
+				Kind: alertBubble, Display: display, LineY: line.Y, Color: line.Color,
+				Price: stockPrice, BrightPixels: bubble.BrightPixels, Sustained: sustained, Confidence: line.Confidence, Time: w.clock.Now(),
+			})
 		}
-		if count > maxCount && count >= cfg.MinRedPixelsPerRow {
-			maxCount = count
-			bestY = y
+	}
+
+	if cfg.DetectVertical && priceOK {
+		if x, ok := findRedColumn(scan, roi, scanCfg); ok {
+			for _, scanLine := range lines {
+				if crossesLine(scan, x, scanLine, scanCfg) {
+					line := toFull(scanLine)
+					if heldByPause(alertCrossing, line) {
+						continue
+					}
+					if !w.cooldown.allow(alertCrossing, keyForLine(display, line), w.clock.Now()) {
+						slog.Debug("crossing alert in cooldown", "display", display, "color", line.Color, "lineY", line.Y)
+						continue
+					}
+					res.Alerts = append(res.Alerts, AlertEvent{
+						Kind: alertCrossing, Display: display, LineY: line.Y, LineX: toFullX(x), Color: line.Color,
+						Price: stockPrice, Confidence: line.Confidence, Time: w.clock.Now(),
+					})
+				}
+			}
 		}
 	}
 
-	if bestY >= 0 {
-		log.Printf("Red line near Y=%d (%d red pixels)\n", bestY, maxCount)
-		return bestY, true
+	if cfg.LineMoveThreshold > 0 {
+		prev, ok := w.lineYs[display]
+		w.lineYs[display] = best.Y
+		if moved := best.Y - prev; ok && priceOK && (moved > cfg.LineMoveThreshold || -moved > cfg.LineMoveThreshold) &&
+			!heldByPause(alertLineMoved, best) {
+			if w.cooldown.allow(alertLineMoved, keyForLine(display, best), w.clock.Now()) {
+				res.Alerts = append(res.Alerts, AlertEvent{
+					Kind: alertLineMoved, Display: display, LineY: best.Y, PrevLineY: prev, Color: best.Color,
+					Price: stockPrice, Confidence: best.Confidence, Time: w.clock.Now(),
+				})
+			} else {
+				slog.Debug("line-moved alert in cooldown", "display", display, "color", best.Color, "lineY", best.Y)
+			}
+		}
 	}
-	return 0, false
+	return aiErr
 }
 
-func isLineRed(r, g, b uint8, cfg Config) bool {
-	// strong R, limited G/B → red/orange horizontal heat lines
-	return r >= cfg.RedMinR && g <= cfg.RedMaxG && b <= cfg.RedMaxB
-}
+// captureTarget captures cfg.TargetWindowTitle if set, else cfg.CaptureRegion
+// if set, else the given display. A window that can't be found falls back to
+// the display.
+func captureTarget(cfg Config, display int) (image.Image, error) {
+	if cfg.TargetWindowTitle == "" {
+		if cfg.CaptureRegion.Empty() {
+			return captureDisplay(cfg, display)
+		}
+		rect, err := captureRegionRect(cfg, display)
+		if err != nil {
+			return nil, err
+		}
+		return captureRect(cfg, rect)
+	}
 
-// bubbleAtLine looks for a bright “bubble” near the right edge at the same Y.
-func bubbleAtLine(img image.Image, roi image.Rectangle, lineY int, cfg Config) bool {
-	log.Println("bubbleAtLine.")
-	width := roi.Dx()
-	// search in right 20% of ROI
-	xStart := roi.Min.X + int(float64(width)*0.8)
-	xEnd := roi.Max.X
+	rect, err := findWindowBounds(cfg.TargetWindowTitle)
+	if err != nil {
+		slog.Warn("target window not found, capturing full display", "title", cfg.TargetWindowTitle, "display", display, "err", err)
+		return captureDisplay(cfg, display)
+	}
+	return captureRect(cfg, rect)
+}
 
-	yMin := lineY - cfg.MaxDistanceBubbleToLine
-	yMax := lineY + cfg.MaxDistanceBubbleToLine
-	if yMin < roi.Min.Y {
-		yMin = roi.Min.Y
+// captureRegionRect returns cfg.CaptureRegion in the absolute virtual-desktop
+// coordinates screenshot.CaptureRect wants.
+func captureRegionRect(cfg Config, display int) (image.Rectangle, error) {
+	if !cfg.RegionRelativeToDisplay {
+		return cfg.CaptureRegion, nil
 	}
-	if yMax > roi.Max.Y {
-		yMax = roi.Max.Y
+	if n := screenshot.NumActiveDisplays(); display < 0 || display >= n {
+		return image.Rectangle{}, fmt.Errorf("display %d not found (%d active)", display, n)
 	}
+	return regionOnDisplay(cfg.CaptureRegion, screenshot.GetDisplayBounds(display))
+}
 
-	brightCount := 0
-	for y := yMin; y < yMax; y++ {
-		for x := xStart; x < xEnd; x++ {
-			r16, g16, b16, _ := img.At(x, y).RGBA()
-			r := uint8(r16 >> 8)
-			g := uint8(g16 >> 8)
-			b := uint8(b16 >> 8)
+// regionOnDisplay offsets region, given relative to a display's top-left
+// corner, by that display's bounds, and checks it stays on the display.
+// Secondary displays sit at an offset (possibly negative) in the virtual
+// desktop, so a region on one can't be passed to CaptureRect as-is.
+func regionOnDisplay(region, display image.Rectangle) (image.Rectangle, error) {
+	abs := region.Add(display.Min)
+	if !abs.In(display) {
+		return image.Rectangle{}, fmt.Errorf("CaptureRegion %v doesn't fit on the %dx%d display", region, display.Dx(), display.Dy())
+	}
+	return abs, nil
+}
 
-			if isBubbleBright(r, g, b, cfg) {
-				brightCount++
-			}
-		}
+func captureRect(cfg Config, rect image.Rectangle) (image.Image, error) {
+	img, err := screenshot.CaptureRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCapture(img, cfg.MinCaptureBrightness); err != nil {
+		return nil, err
 	}
+	return img, nil
+}
 
-	if brightCount >= cfg.BubbleMinBrightPixels {
-		log.Printf("Bubble detected near line at Y=%d (%d bright pixels)\n", lineY, brightCount)
-		return true
+// captureDisplay grabs the display with the given index.
+func captureDisplay(cfg Config, display int) (image.Image, error) {
+	n := screenshot.NumActiveDisplays()
+	if n == 0 {
+		return nil, errString("no active displays found")
 	}
-	return false
+	if display < 0 || display >= n {
+		return nil, fmt.Errorf("display %d not found (%d active)", display, n)
+	}
+	img, err := screenshot.CaptureDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCapture(img, cfg.MinCaptureBrightness); err != nil {
+		return nil, err
+	}
+	return img, nil
 }
 
-func isBubbleBright(r, g, b uint8, cfg Config) bool {
-	sum := int(r) + int(g) + int(b)
-	return sum >= cfg.BubbleBrightThreshold
+// validateCapture catches captures that "succeed" but are useless: a locked or
+// headless session can hand back an empty or all-black frame instead of an
+// error.
+func validateCapture(img image.Image, minBrightness float64) error {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return fmt.Errorf("capture returned an empty %dx%d image (is the session locked or headless?)", b.Dx(), b.Dy())
+	}
+	if avg := averageBrightness(img); avg < minBrightness {
+		return fmt.Errorf("capture looks blank: average brightness %.2f < %.2f (is the screen locked or asleep?)", avg, minBrightness)
+	}
+	return nil
 }
 
-// triggerAlert fires a macOS notification + sound.
-func triggerAlert(lineY int) {
-	title := "Bookmap alert"
-	msg := "Price bubble reached red line (Y=" + itoa(lineY) + ")"
+// detectionROI is the part of a capture with the given bounds to scan:
+// cfg.ROIRect clamped to the bounds if set, otherwise centralROI.
+func (cfg Config) detectionROI(bounds image.Rectangle) (image.Rectangle, error) {
+	if cfg.ROIRect.Empty() {
+		return centralROI(bounds, cfg.roiMargins()), nil
+	}
+	roi := cfg.ROIRect.Intersect(bounds)
+	if roi.Empty() {
+		return roi, fmt.Errorf("ROIRect %v lies outside the %v capture", cfg.ROIRect, bounds)
+	}
+	return roi, nil
+}
+
+// centralROI cuts off a margin around the screen (menu bar / dock / junk),
+// each edge's given as a fraction of the width or height. Margins that would
+// leave nothing (they're validated to, but tiny captures round badly) are
+// clamped to at least one pixel in the middle of what they'd cut.
+func centralROI(bounds image.Rectangle, m roiMargins) image.Rectangle {
+	w := float64(bounds.Dx())
+	h := float64(bounds.Dy())
+
+	x0, x1 := clampSpan(bounds.Min.X, bounds.Max.X, bounds.Min.X+int(w*m.Left), bounds.Max.X-int(w*m.Right))
+	y0, y1 := clampSpan(bounds.Min.Y, bounds.Max.Y, bounds.Min.Y+int(h*m.Top), bounds.Max.Y-int(h*m.Bottom))
+	return image.Rect(x0, y0, x1, y1)
+}
 
-	if err := beeep.Notify(title, msg, ""); err != nil {
-		log.Println("notify error:", err)
+// clampSpan keeps [lo,hi) inside [from,to) and at least one wide, collapsing
+// an inverted or empty span to the pixel at its midpoint. An empty [from,to)
+// is returned as is.
+func clampSpan(from, to, lo, hi int) (int, int) {
+	if to <= from {
+		return from, to
 	}
-	if err := beeep.Beep(880, 500); err != nil {
-		log.Println("beep error:", err)
+	lo, hi = min(max(lo, from), to), min(max(hi, from), to)
+	if hi > lo {
+		return lo, hi
 	}
-	log.Println("ALERT:", msg)
+	mid := min(max((lo+hi)/2, from), to-1)
+	return mid, mid + 1
 }
 
-// tiny helpers to avoid extra imports
+// errString is a constant error message.
 type errString string
 
 func (e errString) Error() string { return string(e) }
 
-func itoa(v int) string {
-	if v == 0 {
-		return "0"
+// Image formats for Config.ImageFormat.
+const (
+	imageFormatPNG  = "png"
+	imageFormatJPEG = "jpeg" // smaller and faster to encode; lossy
+)
+
+// encodeImage encodes an image.Image in cfg.ImageFormat to memory.
+func encodeImage(img image.Image, cfg Config) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeImage(&buf, img, cfg); err != nil {
+		return nil, err
 	}
-	neg := false
-	if v < 0 {
-		neg = true
-		v = -v
+	return buf.Bytes(), nil
+}
+
+// writeImage encodes img to w in cfg.ImageFormat.
+func writeImage(w io.Writer, img image.Image, cfg Config) error {
+	var err error
+	if cfg.ImageFormat == imageFormatJPEG {
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: cfg.JPEGQuality})
+	} else {
+		err = png.Encode(w, img)
 	}
-	var buf [20]byte
-	i := len(buf)
-	for v > 0 {
-		i--
-		buf[i] = '0' + byte(v%10)
-		v /= 10
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
 	}
-	if neg {
-		i--
-		buf[i] = '-'
+	return nil
+}
+
+// imageExt is the file extension for cfg.ImageFormat.
+func (cfg Config) imageExt() string {
+	if cfg.ImageFormat == imageFormatJPEG {
+		return ".jpg"
 	}
-	return string(buf[i:])
+	return ".png"
 }
 
-// saveImageToFile saves an image.Image to a PNG file.
-func saveImageToFile(img image.Image, filePath string) error {
+// imageContentType is the MIME type for cfg.ImageFormat.
+func (cfg Config) imageContentType() string {
+	if cfg.ImageFormat == imageFormatJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// saveDebugFrames writes img and annotated, its copy from annotateFrame, into
+// cfg.FrameDir. Errors are logged here and the first one returned.
+func saveDebugFrames(img, annotated image.Image, tag string, cfg Config) error {
+	if _, err := saveFrame(img, tag, cfg); err != nil {
+		log.Println("error saving image:", err)
+		return err
+	}
+	if _, err := saveFrameAs(annotated, annotatedPrefix, tag, cfg); err != nil {
+		log.Println("error saving annotated image:", err)
+		return err
+	}
+	return nil
+}
+
+// saveImageToFile saves an image.Image to a file in cfg.ImageFormat.
+func saveImageToFile(img image.Image, filePath string, cfg Config) error {
 	file, err := os.Create(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	defer file.Close()
 
-	if err := png.Encode(file, img); err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+	if err := writeImage(file, img, cfg); err != nil {
+		return err
 	}
 
 	log.Printf("Image saved to %s\n", filePath)
 	return nil
 }
 
-// AIResponse represents the expected response from the AI modal.
-type AIResponse struct {
-	StockPrice float64 `json:"stockPrice"`
+// parseAIResponse pulls the price out of an AI response body. The price is
+// looked up at cfg.AIPriceField, a dot-separated path such as "stockPrice" or
+// "result.price", and may be a JSON number or a numeric string. If
+// cfg.AIConfidenceField is set and present the confidence is returned too
+// (NaN otherwise). Any other fields are ignored.
+func parseAIResponse(body []byte, cfg Config) (price, confidence float64, err error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode AI response: %w", err)
+	}
+
+	v, ok := jsonPath(doc, cfg.AIPriceField)
+	if !ok {
+		return 0, 0, fmt.Errorf("AI response has no %q field", cfg.AIPriceField)
+	}
+	price, err = jsonFloat(v)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad %q in AI response: %w", cfg.AIPriceField, err)
+	}
+
+	confidence = math.NaN()
+	if cfg.AIConfidenceField != "" {
+		if v, ok := jsonPath(doc, cfg.AIConfidenceField); ok {
+			if c, err := jsonFloat(v); err == nil {
+				confidence = c
+			} else {
+				log.Println("ignoring AI confidence:", err)
+			}
+		}
+	}
+	return price, confidence, nil
 }
 
-// getStockPriceFromAI sends the image file to an AI model and expects a response with stockPrice.
-// You'll need to replace "YOUR_AI_API_ENDPOINT" with your actual AI service endpoint.
-func getStockPriceFromAI(imgFilePath string) (float64, error) {
-	// Open the image file
-	file, err := os.Open(imgFilePath)
+// jsonPath walks a decoded JSON document along a dot-separated object path.
+func jsonPath(doc any, path string) (any, bool) {
+	v := doc
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonFloat accepts a JSON number or a string holding one, e.g. "4521.25".
+func jsonFloat(v any) (float64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("want a number or numeric string, got %T", v)
+	}
+}
+
+// getStockPriceFromAIBytes sends an encoded frame to the AI model at
+// cfg.AIEndpoint through client and reads the price from cfg.AIPriceField.
+// Connection errors and 5xx responses are retried up to cfg.AIMaxRetries times
+// with exponential backoff. hints, if any, are added to the endpoint's query
+// string.
+func getStockPriceFromAIBytes(ctx context.Context, client *http.Client, buf []byte, hints url.Values, cfg Config) (float64, error) {
+	body, contentType, err := aiRequestBody(buf, cfg)
 	if err != nil {
-		return 0, fmt.Errorf("failed to open image file: %w", err)
+		return 0, err
 	}
-	defer file.Close()
+	endpoint, err := withQuery(cfg.AIEndpoint, hints)
+	if err != nil {
+		return 0, err
+	}
+
+	backoff := aiRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		price, retry, err := postImageToAI(ctx, client, endpoint, body, contentType, cfg)
+		if err == nil || !retry || attempt >= cfg.AIMaxRetries {
+			return price, err
+		}
+
+		log.Printf("AI request failed (attempt %d/%d), retrying in %s: %v\n",
+			attempt+1, cfg.AIMaxRetries+1, backoff, err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
 
-	// Read the file content
-	fileContent, err := io.ReadAll(file)
+// detectionHints are the query parameters SendDetectionHints adds to the AI
+// request, in full-resolution capture pixels: the strongest line's "lineY",
+// the scanned "roi" and the bright "bubble" blob next to the line, rectangles
+// as "x0,y0,x1,y1". Whatever wasn't found is left out. Servers that don't
+// know them just ignore them.
+func detectionHints(lineY int, roi, bubble image.Rectangle) url.Values {
+	rect := func(r image.Rectangle) string {
+		return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+	}
+	v := url.Values{"roi": {rect(roi)}}
+	if lineY >= 0 {
+		v.Set("lineY", strconv.Itoa(lineY))
+	}
+	if !bubble.Empty() {
+		v.Set("bubble", rect(bubble))
+	}
+	return v
+}
+
+// withQuery adds params to endpoint's query string.
+func withQuery(endpoint string, params url.Values) (string, error) {
+	if len(params) == 0 {
+		return endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read image file: %w", err)
+		return "", fmt.Errorf("bad AI endpoint: %w", err)
 	}
+	q := u.Query()
+	for k, vs := range params {
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
 
-	// Create a multipart form request to send the image to the AI API
-	// Replace "YOUR_AI_API_ENDPOINT" with your actual AI service endpoint
-	apiEndpoint := "http://localhost:8000/api/detect-stock-price" // TODO: Configure your AI API endpoint
+// aiRetryBaseDelay is the wait before the first AI retry; it doubles each time.
+const aiRetryBaseDelay = 200 * time.Millisecond
 
-	// body := &bytes.Buffer{}
-	// For now, sending as raw binary. Adjust based on your API requirements.
-	// If your API expects form data, you may need to use multipart/form-data
+// aiRequestBody wraps the encoded frame according to cfg.AIRequestMode: "raw"
+// sends the bytes as-is, "multipart" uploads them as a form file under
+// cfg.AIFormField.
+func aiRequestBody(buf []byte, cfg Config) ([]byte, string, error) {
+	switch cfg.AIRequestMode {
+	case "", "raw":
+		return buf, cfg.imageContentType(), nil
+	case "multipart":
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
 
-	req, err := http.NewRequest("POST", apiEndpoint, bytes.NewReader(fileContent))
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="frame%s"`, cfg.AIFormField, cfg.imageExt()))
+		h.Set("Content-Type", cfg.imageContentType())
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create multipart part: %w", err)
+		}
+		if _, err := part.Write(buf); err != nil {
+			return nil, "", fmt.Errorf("failed to write multipart part: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+		}
+		return body.Bytes(), w.FormDataContentType(), nil
+	default:
+		return nil, "", fmt.Errorf("unknown AI request mode %q", cfg.AIRequestMode)
+	}
+}
+
+// setAIAuth adds the configured auth header, if any, to an AI request. The
+// standard Authorization header gets a bearer token; any other header name
+// (e.g. "X-API-Key") gets the token as-is.
+func setAIAuth(req *http.Request, cfg Config) {
+	if cfg.AIAuthToken == "" {
+		return
+	}
+	token := string(cfg.AIAuthToken)
+	if strings.EqualFold(cfg.AIAuthHeader, "Authorization") {
+		token = "Bearer " + token
+	}
+	req.Header.Set(cfg.AIAuthHeader, token)
+}
+
+// postImageToAI makes a single AI request. retry reports whether the failure
+// looks transient (connection error or 5xx) and is worth another attempt.
+func postImageToAI(ctx context.Context, client *http.Client, endpoint string, body []byte, contentType string, cfg Config) (price float64, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return 0, false, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Content-Type", contentType)
+	setAIAuth(req, cfg)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to send request to AI service: %w", err)
+		// a cancelled context is shutdown, not a flaky server
+		return 0, ctx.Err() == nil, fmt.Errorf("failed to send request to AI service: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("AI service returned status %d", resp.StatusCode)
+		return 0, resp.StatusCode >= 500, fmt.Errorf("AI service returned status %d", resp.StatusCode)
 	}
 
-	// Parse the response
-	var aiResponse AIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&aiResponse); err != nil {
-		return 0, fmt.Errorf("failed to decode AI response: %w", err)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, ctx.Err() == nil, fmt.Errorf("failed to read AI response: %w", err)
 	}
-
-	return aiResponse.StockPrice, nil
+	price, confidence, err := parseAIResponse(data, cfg)
+	if err != nil {
+		return 0, false, err
+	}
+	if !math.IsNaN(confidence) {
+		slog.Info("AI confidence", "event", eventAIPrice, "confidence", confidence)
+	}
+	return price, false, nil
 }
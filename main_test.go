@@ -0,0 +1,751 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	fixtureBackground = color.RGBA{20, 20, 30, 255}
+	fixtureRed        = color.RGBA{230, 40, 40, 255}
+	fixtureWhite      = color.RGBA{255, 255, 255, 255}
+)
+
+// newFixture builds a 400x300 dark chart. If lineY >= 0 a 1px red line is drawn
+// across the full width at lineY; if bubble is non-empty it is filled white.
+func newFixture(lineY int, bubble image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{fixtureBackground}, image.Point{}, draw.Src)
+	if lineY >= 0 {
+		draw.Draw(img, image.Rect(0, lineY, 400, lineY+1), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+	}
+	if !bubble.Empty() {
+		draw.Draw(img, bubble, &image.Uniform{fixtureWhite}, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// testConfig is defaultConfig scaled down to the 400x300 fixtures, whose ROI
+// is 320px wide.
+func testConfig() Config {
+	cfg := defaultConfig()
+	cfg.MinRedRunLength = 200
+	cfg.MinRedPixelsPerRow = 200
+	cfg.AIEndpoint = ""
+	return cfg
+}
+
+func TestValidateCapture(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     image.Image
+		wantErr bool
+	}{
+		{"chart", newFixture(150, image.Rectangle{}), false},
+		{"all black", image.NewRGBA(image.Rect(0, 0, 400, 300)), true},
+		{"zero size", image.NewRGBA(image.Rectangle{}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCapture(tt.img, 1.0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCapture error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestWatcher returns a Watcher that "captures" img.
+func newTestWatcher(cfg Config, img image.Image) *Watcher {
+	w, err := newWatcher(cfg)
+	if err != nil {
+		panic(err)
+	}
+	w.capture = func(int) (image.Image, error) { return img, nil }
+	w.screens = func() []image.Rectangle { return nil }
+	return w
+}
+
+func TestCheckOnceFixture(t *testing.T) {
+	w := newTestWatcher(testConfig(), newFixture(150, image.Rect(330, 145, 350, 155)))
+
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.RedLineFound || res.RedLineY != 150 {
+		t.Errorf("line = %v at Y=%d, want found at 150", res.RedLineFound, res.RedLineY)
+	}
+	if res.LineColor != "#e62828" {
+		t.Errorf("LineColor = %q, want the fixture's #e62828", res.LineColor)
+	}
+	if !res.BubbleDetected || len(res.Alerts) != 1 {
+		t.Fatalf("BubbleDetected = %v with %d alerts, want one alert", res.BubbleDetected, len(res.Alerts))
+	}
+	if ev := res.Alerts[0]; ev.Kind != alertBubble || ev.LineY != 150 {
+		t.Errorf("alert = %+v, want bubble alert at Y=150", ev)
+	}
+}
+
+func TestCheckOnceCaptureError(t *testing.T) {
+	w, err := newWatcher(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.capture = func(int) (image.Image, error) { return nil, errString("no display") }
+
+	if _, err := w.checkOnce(context.Background()); err == nil {
+		t.Error("checkOnce swallowed the capture error")
+	}
+}
+
+func TestParseAIResponse(t *testing.T) {
+	tests := []struct {
+		name, field, body string
+		want, wantConf    float64 // wantConf -1 means no confidence
+		wantErr           bool
+	}{
+		{"default schema", "stockPrice", `{"stockPrice": 4521.25}`, 4521.25, -1, false},
+		{"string price with confidence", "price", `{"price": "4521.25", "confidence": 0.93, "model": "v2"}`, 4521.25, 0.93, false},
+		{"nested path", "result.price", `{"result": {"price": 17.5}}`, 17.5, -1, false},
+		{"missing field", "price", `{"stockPrice": 1}`, 0, -1, true},
+		{"not numeric", "price", `{"price": "n/a"}`, 0, -1, true},
+		{"wrong type", "price", `{"price": true}`, 0, -1, true},
+		{"not json", "price", `<html>`, 0, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AIPriceField = tt.field
+			price, conf, err := parseAIResponse([]byte(tt.body), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if price != tt.want {
+				t.Errorf("price = %v, want %v", price, tt.want)
+			}
+			if tt.wantConf < 0 && !math.IsNaN(conf) || tt.wantConf >= 0 && conf != tt.wantConf {
+				t.Errorf("confidence = %v, want %v", conf, tt.wantConf)
+			}
+		})
+	}
+}
+
+func TestGetStockPriceFromAIBytes(t *testing.T) {
+	release := make(chan struct{}) // lets the hung handler return before srv.Close
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    float64
+		wantErr string
+	}{
+		{"ok", func(w http.ResponseWriter, r *http.Request) {
+			if ct := r.Header.Get("Content-Type"); ct != "image/png" {
+				http.Error(w, "bad content type "+ct, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"stockPrice": 123.45}`)
+		}, 123.45, ""},
+		{"non-200", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", http.StatusBadRequest)
+		}, 0, "status 400"},
+		{"malformed json", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"stockPrice": `)
+		}, 0, "decode"},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}, 0, "failed to send request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			defer func() {
+				if tt.name == "timeout" {
+					close(release)
+				}
+			}()
+
+			cfg := testConfig()
+			cfg.AIEndpoint = srv.URL
+			cfg.AITimeout = 50 * time.Millisecond
+			cfg.AIMaxRetries = 0
+
+			price, err := getStockPriceFromAIBytes(context.Background(), newAIClient(cfg), []byte("png"), nil, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if price != tt.want {
+				t.Errorf("price = %v, want %v", price, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAIAuth(t *testing.T) {
+	tests := []struct {
+		header, token  string
+		wantKey, wantV string
+	}{
+		{"Authorization", "abc", "Authorization", "Bearer abc"},
+		{"X-API-Key", "abc", "X-API-Key", "abc"},
+		{"Authorization", "", "Authorization", ""},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.AIAuthHeader, cfg.AIAuthToken = tt.header, secret(tt.token)
+		req := httptest.NewRequest("POST", "/", nil)
+		setAIAuth(req, cfg)
+		if got := req.Header.Get(tt.wantKey); got != tt.wantV {
+			t.Errorf("%s with token %q: header = %q, want %q", tt.header, tt.token, got, tt.wantV)
+		}
+	}
+}
+
+func TestGetStockPriceFromAIBytesRetries5xx(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"stockPrice": 99}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AIMaxRetries = 1
+
+	price, err := getStockPriceFromAIBytes(context.Background(), newAIClient(cfg), []byte("png"), nil, cfg)
+	if err != nil || price != 99 || calls.Load() != 2 {
+		t.Errorf("price %v, err %v after %d calls; want 99 on the retry", price, err, calls.Load())
+	}
+}
+
+func TestSendDetectionHints(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"stockPrice": 1}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL + "/detect?model=v2"
+	cfg.SendDetectionHints = true
+	img := newFixture(150, image.Rect(330, 144, 350, 156)) // even edges survive downscaling exactly
+
+	if _, err := newTestWatcher(cfg, img).checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"model": {"v2"}, "lineY": {"150"}, "roi": {"40,30,360,270"}, "bubble": {"330,144,350,156"}}
+	if query.Encode() != want.Encode() {
+		t.Errorf("AI query = %v, want %v", query, want)
+	}
+
+	cfg.ScaleDivisor = 2 // hints stay in full-resolution pixels
+	if _, err := newTestWatcher(cfg, img).checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if query.Encode() != want.Encode() {
+		t.Errorf("downscaled: AI query = %v, want %v", query, want)
+	}
+}
+
+func TestAIMinInterval(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"stockPrice": %d}`, 100+calls.Add(1))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AIMinInterval = time.Hour
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	clock := newFakeClock()
+	w.clock = clock
+
+	for i, wantStale := range []bool{false, true, true} {
+		clock.Advance(time.Hour / 3)
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StockPrice != 101 || res.PriceStale != wantStale {
+			t.Errorf("poll %d: price %v (stale %v), want 101 (stale %v)", i, res.StockPrice, res.PriceStale, wantStale)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("AI called %d times, want once within AIMinInterval", n)
+	}
+
+	clock.Advance(time.Hour / 3)
+	if res, _ := w.checkOnce(context.Background()); res.StockPrice != 102 || res.PriceStale {
+		t.Errorf("after AIMinInterval: price %v (stale %v), want a fresh 102", res.StockPrice, res.PriceStale)
+	}
+}
+
+// TestAIMinIntervalAfterFailure: a failed read doesn't hold the AI off for
+// AIMinInterval; the next poll asks again.
+func TestAIMinIntervalAfterFailure(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "overloaded", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"stockPrice": 101}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AIMinInterval = time.Hour
+	cfg.AIMaxRetries = 0
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	clock := newFakeClock()
+	w.clock = clock
+
+	if res, _ := w.checkOnce(context.Background()); !math.IsNaN(res.StockPrice) {
+		t.Fatalf("failed read: price %v, want NaN", res.StockPrice)
+	}
+	clock.Advance(time.Minute)
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StockPrice != 101 || res.PriceStale {
+		t.Errorf("poll after a failure: price %v (stale %v), want a fresh 101", res.StockPrice, res.PriceStale)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("AI called %d times, want 2", n)
+	}
+}
+
+func TestRequirePriceChange(t *testing.T) {
+	prices := []string{"100", "100.1", "105", "105"}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"stockPrice": %s}`, prices[calls.Add(1)-1])
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.RequirePriceChange = true
+	cfg.MinPriceDelta = 1
+	cfg.AlertCooldown = 0
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+
+	// no previous reading, too small a move, a real move, a static chart
+	for i, want := range []int{0, 0, 1, 0} {
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.BubbleDetected || len(res.Alerts) != want {
+			t.Errorf("poll %d at %s: bubble %v, %d alerts; want a bubble and %d alerts",
+				i, prices[i], res.BubbleDetected, len(res.Alerts), want)
+		}
+	}
+}
+
+func TestAIPriceRange(t *testing.T) {
+	prices := []string{"0", "1e9", "4521.25"}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"stockPrice": %s}`, prices[calls.Add(1)-1])
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AIPriceMin, cfg.AIPriceMax = 1, 100000
+	cfg.AlertPriceAbove = 4000 // a glitched 1e9 would pass this
+	cfg.AlertCooldown = 0
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+
+	rejected := metrics.aiPricesRejected.Load()
+	for _, price := range prices[:2] {
+		res, err := w.checkOnce(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "AIPriceMin") {
+			t.Errorf("price %s: err = %v, want it rejected as out of range", price, err)
+		}
+		if !math.IsNaN(res.StockPrice) || len(res.Alerts) != 0 {
+			t.Errorf("price %s: StockPrice %v with %d alerts, want no price and no alert", price, res.StockPrice, len(res.Alerts))
+		}
+	}
+	if n := metrics.aiPricesRejected.Load() - rejected; n != 2 {
+		t.Errorf("%d prices counted as rejected, want 2", n)
+	}
+
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StockPrice != 4521.25 || len(res.Alerts) != 1 {
+		t.Errorf("StockPrice %v with %d alerts, want 4521.25 and an alert", res.StockPrice, len(res.Alerts))
+	}
+}
+
+func TestWarmupPolls(t *testing.T) {
+	cfg := testConfig()
+	cfg.WarmupPolls = 2
+	cfg.AlertCooldown = time.Hour
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+
+	// the bubble is there from the start; the held-back alerts' cooldown
+	// mustn't swallow the first one after warmup
+	for i, want := range []bool{false, false, true} {
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.warmedUp(cfg, res.Alerts); got != want {
+			t.Errorf("poll %d: warmed up = %v, want %v", i, got, want)
+		}
+		if want && len(res.Alerts) != 1 {
+			t.Errorf("poll %d: %d alerts after warmup, want the bubble alert", i, len(res.Alerts))
+		}
+	}
+}
+
+func TestLineMoveThreshold(t *testing.T) {
+	cfg := testConfig()
+	cfg.LineMoveThreshold = 20
+	w := newTestWatcher(cfg, nil)
+
+	// the first poll has nothing to compare with; 5px is within the threshold
+	for i, step := range []struct{ lineY, prevY int }{{150, -1}, {155, -1}, {200, 155}, {200, -1}, {120, 200}} {
+		w.capture = func(int) (image.Image, error) { return newFixture(step.lineY, image.Rectangle{}), nil }
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.prevY < 0 {
+			if len(res.Alerts) != 0 {
+				t.Errorf("poll %d: alerts %+v, want none", i, res.Alerts)
+			}
+			continue
+		}
+		if len(res.Alerts) != 1 || res.Alerts[0].Kind != alertLineMoved || res.Alerts[0].LineY != step.lineY || res.Alerts[0].PrevLineY != step.prevY {
+			t.Fatalf("poll %d: alerts %+v, want the line moving from %d to %d", i, res.Alerts, step.prevY, step.lineY)
+		}
+		if _, msg := alertText(res.Alerts[0]); msg != fmt.Sprintf("red line moved from Y=%d to Y=%d", step.prevY, step.lineY) {
+			t.Errorf("poll %d: message %q", i, msg)
+		}
+	}
+}
+
+func TestCheckOnceSkipsAIWithoutLine(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"stockPrice": 100.5}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	blank := newFixture(-1, image.Rectangle{})
+
+	res, err := newTestWatcher(cfg, blank).checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 0 || !math.IsNaN(res.StockPrice) {
+		t.Errorf("AI called %d times, price %v; want no call on a frame without a line", calls.Load(), res.StockPrice)
+	}
+
+	cfg.AIAlwaysRun = true
+	res, err = newTestWatcher(cfg, blank).checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 || res.StockPrice != 100.5 {
+		t.Errorf("AI called %d times, price %v; want one call with AIAlwaysRun", calls.Load(), res.StockPrice)
+	}
+}
+
+func TestCheckOnceDownscaled(t *testing.T) {
+	cfg := testConfig()
+	cfg.ScaleDivisor = 2
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+	// thicken the line so it survives 2x sampling wherever it lands
+	draw.Draw(img, image.Rect(0, 151, 400, 152), &image.Uniform{fixtureRed}, image.Point{}, draw.Src)
+
+	res, err := newTestWatcher(cfg, img).checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.RedLineFound || res.RedLineY < 150 || res.RedLineY > 151 {
+		t.Errorf("line = %v at Y=%d, want found at full-res Y 150-151", res.RedLineFound, res.RedLineY)
+	}
+	if len(res.Alerts) != 1 || res.Alerts[0].LineY != res.RedLineY {
+		t.Errorf("alerts = %+v, want one bubble alert on the line", res.Alerts)
+	}
+}
+
+func TestDetectionROI(t *testing.T) {
+	bounds := image.Rect(0, 0, 400, 300)
+	tests := []struct {
+		name    string
+		rect    image.Rectangle
+		want    image.Rectangle
+		wantErr bool
+	}{
+		{"margin fallback", image.Rectangle{}, image.Rect(40, 30, 360, 270), false},
+		{"explicit", image.Rect(0, 50, 250, 200), image.Rect(0, 50, 250, 200), false},
+		{"clamped", image.Rect(300, 200, 500, 400), image.Rect(300, 200, 400, 300), false},
+		{"outside", image.Rect(500, 0, 600, 100), image.Rectangle{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ROIRect = tt.rect
+			got, err := cfg.detectionROI(bounds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("roi = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCentralROIPerEdge(t *testing.T) {
+	cfg := testConfig()
+	cfg.ROIMarginTop, cfg.ROIMarginBottom = 0.05, 0.2 // menu bar, dock
+	roi := centralROI(image.Rect(0, 0, 400, 300), cfg.roiMargins())
+	// left and right fall back to ROIMarginPercent
+	if want := image.Rect(40, 15, 360, 240); roi != want {
+		t.Errorf("roi = %v, want %v", roi, want)
+	}
+
+	cfg.ROIMarginTop, cfg.ROIMarginBottom = 0.6, 0.5
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "ROIMarginTop + ROIMarginBottom") {
+		t.Errorf("Validate err = %v, want one about overlapping margins", err)
+	}
+}
+
+func TestCentralROIBounds(t *testing.T) {
+	even := func(f float64) roiMargins { return roiMargins{Top: f, Bottom: f, Left: f, Right: f} }
+	tests := []struct {
+		name    string
+		bounds  image.Rectangle
+		margins roiMargins
+		want    image.Rectangle // zero to only check it's non-empty and in bounds
+	}{
+		{"no margin", image.Rect(0, 0, 400, 300), even(0), image.Rect(0, 0, 400, 300)},
+		{"10%", image.Rect(0, 0, 400, 300), even(0.1), image.Rect(40, 30, 360, 270)},
+		{"49%", image.Rect(0, 0, 400, 300), even(0.49), image.Rect(196, 147, 204, 153)},
+		{"49% of a tiny capture", image.Rect(0, 0, 3, 3), even(0.49), image.Rect(1, 1, 2, 2)},
+		{"1x1", image.Rect(0, 0, 1, 1), even(0.1), image.Rect(0, 0, 1, 1)},
+		{"1x1 at 49%", image.Rect(0, 0, 1, 1), even(0.49), image.Rect(0, 0, 1, 1)},
+		{"offset bounds", image.Rect(-1920, 100, -1520, 400), even(0.1), image.Rect(-1880, 130, -1560, 370)},
+		{"offset tiny capture", image.Rect(2560, -5, 2562, -3), even(0.49), image.Rect(2560, -5, 2562, -3)},
+		{"margins meeting", image.Rect(0, 0, 400, 300), even(0.5), image.Rect(200, 150, 201, 151)},
+		{"margins overlapping", image.Rect(10, 10, 20, 20), roiMargins{Top: 0.9, Bottom: 0.9, Left: 1, Right: 0.3}, image.Rectangle{}},
+	}
+	for _, tt := range tests {
+		roi := centralROI(tt.bounds, tt.margins)
+		if roi.Empty() || !roi.In(tt.bounds) {
+			t.Errorf("%s: roi = %v, want a non-empty rectangle inside %v", tt.name, roi, tt.bounds)
+		}
+		if tt.want != (image.Rectangle{}) && roi != tt.want {
+			t.Errorf("%s: roi = %v, want %v", tt.name, roi, tt.want)
+		}
+	}
+}
+
+func TestSaveFramesWritesAnnotatedCopy(t *testing.T) {
+	cfg := testConfig()
+	cfg.SaveFrames = true
+	cfg.FrameDir = t.TempDir()
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+
+	if _, err := newTestWatcher(cfg, img).checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{framePrefix, annotatedPrefix} {
+		if m, _ := filepath.Glob(filepath.Join(cfg.FrameDir, prefix+"*"+cfg.imageExt())); len(m) != 1 {
+			t.Errorf("%d %s files saved, want 1", len(m), prefix)
+		}
+	}
+
+	roi := centralROI(img.Bounds(), cfg.roiMargins())
+	out := annotateFrame(img, roi, Line{Y: 150}, cfg)
+	if got := out.RGBAAt(200, 150); got != annotateLineColor {
+		t.Errorf("line marker pixel = %v, want %v", got, annotateLineColor)
+	}
+	if got := out.RGBAAt(328, 143); got != annotateBlobColor {
+		t.Errorf("blob outline pixel = %v, want %v", got, annotateBlobColor)
+	}
+	if img.RGBAAt(200, 150) != fixtureRed {
+		t.Error("annotateFrame drew on the original image")
+	}
+}
+
+func TestOverlayPath(t *testing.T) {
+	cfg := testConfig()
+	dir := t.TempDir()
+	cfg.OverlayPath = filepath.Join(dir, "overlay.png")
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+	w := newTestWatcher(cfg, img)
+	for range 2 {
+		if _, err := w.checkOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(cfg.OverlayPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := annotateFrame(img, centralROI(img.Bounds(), cfg.roiMargins()), Line{Y: 150}, cfg)
+	if c := color.RGBAModel.Convert(got.At(200, 150)); c != want.RGBAAt(200, 150) {
+		t.Errorf("overlay pixel on the line = %v, want the annotation's %v", c, want.RGBAAt(200, 150))
+	}
+	if m, _ := filepath.Glob(filepath.Join(dir, "*")); len(m) != 1 {
+		t.Errorf("overlay dir holds %v, want just overlay.png and no temp files", m)
+	}
+
+	cfg.DisplayIndices = []int{0, 1}
+	if _, err := newTestWatcher(cfg, img).checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"overlay-display0.png", "overlay-display1.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("multi-display overlay: %v", err)
+		}
+	}
+}
+
+func TestSaveFailureNonFatal(t *testing.T) {
+	cfg := testConfig()
+	cfg.SaveFrames = true
+	// a regular file where the frame directory should be: MkdirAll fails
+	cfg.FrameDir = filepath.Join(t.TempDir(), "frames")
+	if err := os.WriteFile(cfg.FrameDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img := newFixture(150, image.Rect(330, 145, 350, 155))
+
+	res, err := newTestWatcher(cfg, img).checkOnce(context.Background())
+	if err != nil {
+		t.Errorf("checkOnce err = %v, want the save failure only logged", err)
+	}
+	if len(res.Alerts) != 1 {
+		t.Errorf("%d alerts with saving broken, want 1", len(res.Alerts))
+	}
+
+	cfg.SaveFailureFatal = true
+	res, err = newTestWatcher(cfg, img).checkOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "frame dir") {
+		t.Errorf("SaveFailureFatal: checkOnce err = %v, want the save failure", err)
+	}
+	if len(res.Alerts) != 1 {
+		t.Errorf("SaveFailureFatal: %d alerts, want detection to have run first", len(res.Alerts))
+	}
+}
+
+func TestImageFormatJPEG(t *testing.T) {
+	var gotType string
+	var decodeErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		_, decodeErr = jpeg.Decode(r.Body)
+		fmt.Fprint(w, `{"stockPrice": 1}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.ImageFormat = imageFormatJPEG
+	cfg.AIEndpoint = srv.URL
+	cfg.SaveFrames = true
+	cfg.FrameDir = t.TempDir()
+
+	if _, err := newTestWatcher(cfg, newFixture(150, image.Rectangle{})).checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if gotType != "image/jpeg" || decodeErr != nil {
+		t.Errorf("AI upload Content-Type %q, decode err %v; want a JPEG", gotType, decodeErr)
+	}
+	if m, _ := filepath.Glob(filepath.Join(cfg.FrameDir, framePrefix+"*.jpg")); len(m) != 1 {
+		t.Errorf("%d .jpg frames saved, want 1", len(m))
+	}
+}
+
+func TestCheckOnceMultipleDisplays(t *testing.T) {
+	cfg := testConfig()
+	cfg.DisplayIndices = []int{0, 1, 2}
+	frames := map[int]image.Image{
+		0: newFixture(-1, image.Rectangle{}),
+		1: newFixture(150, image.Rect(330, 145, 350, 155)),
+	}
+	w := newTestWatcher(cfg, nil)
+	w.capture = func(display int) (image.Image, error) {
+		if img, ok := frames[display]; ok {
+			return img, nil
+		}
+		return nil, errString("unplugged")
+	}
+
+	res, err := w.checkOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "display 2") {
+		t.Errorf("err = %v, want display 2's capture error", err)
+	}
+	if !res.BubbleDetected || res.Display != 1 || res.RedLineY != 150 {
+		t.Errorf("result = %+v, want the bubble on display 1 at Y=150", res)
+	}
+	if len(res.Alerts) != 1 || res.Alerts[0].Display != 1 {
+		t.Errorf("alerts = %+v, want one alert tagged display 1", res.Alerts)
+	}
+}
+
+func TestRegionOnDisplay(t *testing.T) {
+	second := image.Rect(-1920, 0, 0, 1080) // a monitor to the left of the primary
+	got, err := regionOnDisplay(image.Rect(100, 50, 900, 650), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(-1820, 50, -1020, 650); got != want {
+		t.Errorf("regionOnDisplay = %v, want %v", got, want)
+	}
+
+	if _, err := regionOnDisplay(image.Rect(1500, 0, 2000, 500), second); err == nil {
+		t.Error("region running off the display accepted")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// watcherMetrics holds the counters exposed on /metrics. They are bumped from
+// checkOnce and the alert goroutines, so everything is atomic.
+type watcherMetrics struct {
+	framesProcessed       atomic.Int64
+	linesFound            atomic.Int64
+	bubblesDetected       atomic.Int64
+	alertsFired           atomic.Int64
+	alertsDropped         atomic.Int64 // over MaxConcurrentAlerts
+	aiRequestsDeduped     atomic.Int64 // answered by an identical pending request; see aiQueue
+	aiQueueDepth          atomic.Int64 // AI requests waiting or in flight (a gauge)
+	aiCallsShortCircuited atomic.Int64 // AI calls skipped while the circuit was open; see aiBreaker
+	aiCircuitState        atomic.Int64 // circuitClosed, circuitOpen or circuitHalfOpen (a gauge)
+	aiPricesRejected      atomic.Int64 // prices outside AIPriceMin/AIPriceMax
+	lastPollUnixNs        atomic.Int64 // end of the last poll that returned no error
+	lastTimings           atomic.Pointer[pollTimings]
+}
+
+// pollTimings is how long each phase of one checkOnce took. Phases after an
+// early return stay zero.
+type pollTimings struct {
+	Capture    time.Duration
+	LineScan   time.Duration
+	Save       time.Duration
+	AI         time.Duration
+	BubbleScan time.Duration
+	Total      time.Duration
+}
+
+// add sums o's stage timings into t; Total is the caller's to set.
+func (t *pollTimings) add(o pollTimings) {
+	t.Capture += o.Capture
+	t.LineScan += o.LineScan
+	t.Save += o.Save
+	t.AI += o.AI
+	t.BubbleScan += o.BubbleScan
+}
+
+// record logs the timings at debug level, warns when the poll took longer than
+// the poll interval, and keeps them for /healthz.
+func (t pollTimings) record(cfg Config) {
+	attrs := []any{"capture", t.Capture, "lineScan", t.LineScan, "save", t.Save,
+		"ai", t.AI, "bubbleScan", t.BubbleScan, "total", t.Total}
+	slog.Debug("poll timings", attrs...)
+	if t.Total > cfg.PollInterval {
+		slog.Warn("slow frame: poll took longer than PollInterval",
+			append(attrs, "pollInterval", cfg.PollInterval)...)
+	}
+	metrics.lastTimings.Store(&t)
+}
+
+// MarshalJSON reports the timings in milliseconds.
+func (t pollTimings) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return json.Marshal(map[string]float64{
+		"captureMs": ms(t.Capture), "lineScanMs": ms(t.LineScan), "saveMs": ms(t.Save),
+		"aiMs": ms(t.AI), "bubbleScanMs": ms(t.BubbleScan), "totalMs": ms(t.Total),
+	})
+}
+
+var metrics watcherMetrics
+
+// serveMetrics runs the /healthz, /metrics, /alerts, /pause and /resume
+// server on addr, plus /stream if stream is set, until ctx is cancelled,
+// then shuts it down. Requests see ctx, so open streams end with it.
+func serveMetrics(ctx context.Context, addr string, stream bool) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/alerts", handleAlerts)
+	mux.HandleFunc("/pause", handlePause)
+	mux.HandleFunc("/resume", handleResume)
+	if stream {
+		mux.HandleFunc("/stream", handleStream)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("metrics server shutdown error:", err)
+		}
+	}()
+
+	log.Printf("Metrics server listening on %s\n", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("metrics server error:", err)
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Status   string       `json:"status"`
+		Paused   bool         `json:"paused"` // alerts are held back; see alertsPaused
+		LastPoll *time.Time   `json:"lastPoll,omitempty"`
+		Timings  *pollTimings `json:"lastPollTimings,omitempty"`
+	}{Status: "ok", Paused: alertsPaused.Load(), Timings: metrics.lastTimings.Load()}
+	if ns := metrics.lastPollUnixNs.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		resp.LastPoll = &t
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("healthz encode error:", err)
+	}
+}
+
+// handleMetrics writes the counters and gauges in the Prometheus text format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	series := []struct {
+		name, kind, help string
+		value            int64
+	}{
+		{"bookmap_frames_processed_total", "counter", "Frames captured and scanned.", metrics.framesProcessed.Load()},
+		{"bookmap_lines_found_total", "counter", "Lines detected across all frames.", metrics.linesFound.Load()},
+		{"bookmap_bubbles_detected_total", "counter", "Price bubbles detected at a line.", metrics.bubblesDetected.Load()},
+		{"bookmap_alerts_fired_total", "counter", "Alerts triggered.", metrics.alertsFired.Load()},
+		{"bookmap_alerts_dropped_total", "counter", "Alerts dropped because MaxConcurrentAlerts were still being delivered.", metrics.alertsDropped.Load()},
+		{"bookmap_ai_requests_deduped_total", "counter", "AI requests answered by an identical request already pending.", metrics.aiRequestsDeduped.Load()},
+		{"bookmap_ai_queue_depth", "gauge", "AI requests waiting for a slot or in flight.", metrics.aiQueueDepth.Load()},
+		{"bookmap_ai_calls_short_circuited_total", "counter", "AI calls skipped because the endpoint kept failing.", metrics.aiCallsShortCircuited.Load()},
+		{"bookmap_ai_circuit_state", "gauge", "AI circuit breaker state: 0 closed, 1 open, 2 half-open.", metrics.aiCircuitState.Load()},
+		{"bookmap_ai_prices_rejected_total", "counter", "AI or OCR prices discarded for falling outside AIPriceMin/AIPriceMax.", metrics.aiPricesRejected.Load()},
+	}
+	for _, m := range series {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/gen2brain/beeep"
+)
+
+// Notifier delivers an alert somewhere: the desktop, a webhook, the log.
+type Notifier interface {
+	Notify(ctx context.Context, ev AlertEvent) error
+}
+
+// Notifier names accepted in Config.Notifiers.
+const (
+	notifierBeep    = "beep"
+	notifierWebhook = "webhook"
+	notifierLog     = "log"
+)
+
+// notifierName is the Config.Notifiers name n was built from, or "" for a
+// notifier that isn't one of them.
+func notifierName(n Notifier) string {
+	switch n.(type) {
+	case BeepNotifier:
+		return notifierBeep
+	case WebhookNotifier:
+		return notifierWebhook
+	case LogNotifier:
+		return notifierLog
+	}
+	return ""
+}
+
+// newNotifiers builds the notifiers named in cfg.Notifiers, in order.
+// "webhook" is skipped while AlertWebhookURL is empty, so it can stay in the
+// default list.
+func newNotifiers(cfg Config) ([]Notifier, error) {
+	text, err := parseAlertTemplates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out []Notifier
+	for _, name := range cfg.Notifiers {
+		switch name {
+		case notifierBeep:
+			if !desktopSupported {
+				slog.Warn("desktop notifications and beeps aren't supported on this platform; skipping the beep notifier")
+				continue
+			}
+			out = append(out, BeepNotifier{
+				Sound:      cfg.BeepEnabled,
+				SoundFile:  cfg.SoundFilePath,
+				FreqHz:     cfg.BeepFreqHz,
+				DurationMs: cfg.BeepDurationMs,
+				Escalation: cfg.AlertEscalation,
+				Text:       text,
+				failures:   &failureTracker{limit: cfg.NotifyFailureLimit},
+			})
+		case notifierWebhook:
+			if cfg.AlertWebhookURL != "" {
+				out = append(out, WebhookNotifier{URL: cfg.AlertWebhookURL})
+			}
+		case notifierLog:
+			out = append(out, LogNotifier{})
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return out, nil
+}
+
+// BeepNotifier shows a desktop notification and, if Sound is set, plays
+// SoundFile or a synthesized beep. On a machine without a GUI session both
+// fail on every alert, so after the failure tracker's limit of consecutive
+// failures it turns itself off for the rest of the run.
+type BeepNotifier struct {
+	Sound      bool
+	SoundFile  string // played with playSoundFile; empty means beep
+	FreqHz     float64
+	DurationMs int
+	Escalation []escalationStep // tones for escalated alerts, by AlertEvent.Escalation
+	Text       alertTemplates   // notification title and body
+
+	failures *failureTracker // nil never disables
+}
+
+func (n BeepNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	if n.failures.disabled() {
+		return nil
+	}
+
+	title, msg := n.Text.render(ev)
+	var errs []error
+	if err := beeep.Notify(title, msg, ""); err != nil {
+		errs = append(errs, fmt.Errorf("desktop notification: %w", err))
+	}
+	if n.Sound {
+		if err := n.playSound(ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if n.failures.record(err) {
+		slog.Warn("desktop notifications and sound keep failing; disabling them for this run (other notifiers still work)",
+			"failures", n.failures.limit, "err", err)
+		return nil
+	}
+	return err
+}
+
+// failureTracker counts consecutive failures of a notifier and trips once
+// limit is reached. A nil tracker, or a limit of 0, never trips.
+type failureTracker struct {
+	mu      sync.Mutex
+	limit   int
+	count   int
+	tripped bool
+}
+
+// record notes the outcome of one attempt and reports whether this failure
+// is the one that tripped the tracker. A success resets the count.
+func (t *failureTracker) record(err error) bool {
+	if t == nil || t.limit <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		t.count = 0
+		return false
+	}
+	t.count++
+	if t.count >= t.limit && !t.tripped {
+		t.tripped = true
+		return true
+	}
+	return false
+}
+
+func (t *failureTracker) disabled() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tripped
+}
+
+// reset re-enables a tripped tracker and clears its count.
+func (t *failureTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count, t.tripped = 0, false
+}
+
+// LogNotifier writes the alert to the log at warn level.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	slog.Warn("ALERT", alertAttrs(ev)...)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Where a frame's price came from, for the ai_price log event.
+const (
+	priceSourceAI  = "ai"
+	priceSourceOCR = "ocr" // EnableOCRFallback
+)
+
+// readPriceOCR reads the price printed in rect of img (a price bubble) with
+// the tesseract CLI, for when the AI endpoint is down. It is slower and less
+// robust than the model, so it only ever runs as a fallback.
+func readPriceOCR(ctx context.Context, img image.Image, rect image.Rectangle) (float64, error) {
+	path, err := exec.LookPath("tesseract")
+	if err != nil {
+		return 0, errString("tesseract is not installed")
+	}
+
+	rect = rect.Intersect(img.Bounds())
+	crop := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(crop, crop.Bounds(), img, rect.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, crop); err != nil {
+		return 0, fmt.Errorf("failed to encode bubble: %w", err)
+	}
+
+	// --psm 7: treat the image as a single line of text
+	cmd := exec.CommandContext(ctx, path, "stdin", "stdout", "--psm", "7",
+		"-c", "tessedit_char_whitelist=0123456789.,$")
+	cmd.Stdin = &buf
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("tesseract: %w", err)
+	}
+	return parseOCRPrice(string(out))
+}
+
+// parseOCRPrice turns tesseract's output, e.g. "$4,521.25\n", into a price.
+// Anything that isn't a single positive number is rejected.
+func parseOCRPrice(text string) (float64, error) {
+	s := strings.TrimSpace(text)
+	s = strings.TrimPrefix(s, "$")
+	s = strings.ReplaceAll(s, ",", "")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v > 0) || math.IsInf(v, 0) { // !(v > 0) also catches NaN
+		return 0, fmt.Errorf("OCR read %q, not a price", strings.TrimSpace(text))
+	}
+	return v, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParseOCRPrice(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		wantErr bool
+	}{
+		{"4521.25\n", 4521.25, false},
+		{" $4,521.25 \n\f", 4521.25, false},
+		{"17", 17, false},
+		{"", 0, true},
+		{"45 21.25", 0, true},
+		{"4521.2.5", 0, true},
+		{"NaN", 0, true},
+		{"0", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOCRPrice(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOCRPrice(%q) = %v, %v; want %v, error %v", tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// alertsPaused is set by /pause (or SIGUSR1) and cleared by /resume. Polls
+// carry on and are logged as usual while it is set, but checkDisplay raises
+// no alerts, before any cooldown or RearmAfterClearPolls sees them, and
+// dispatchAlerts drops any decided just before the pause.
+var alertsPaused atomic.Bool
+
+// setPaused pauses or resumes alerting, logging the change.
+func setPaused(paused bool) {
+	if alertsPaused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		slog.Info("alerts paused")
+	} else {
+		slog.Info("alerts resumed")
+	}
+}
+
+// togglePaused flips alertsPaused, for SIGUSR1.
+func togglePaused() {
+	setPaused(!alertsPaused.Load())
+}
+
+// handlePause and handleResume serve POST /pause and POST /resume, replying
+// with the new state.
+func handlePause(w http.ResponseWriter, r *http.Request)  { handleSetPaused(w, r, true) }
+func handleResume(w http.ResponseWriter, r *http.Request) { handleSetPaused(w, r, false) }
+
+func handleSetPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	setPaused(paused)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Paused bool `json:"paused"`
+	}{alertsPaused.Load()}); err != nil {
+		log.Println("pause encode error:", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	t.Cleanup(func() { setPaused(false) })
+	paused := func(handler http.HandlerFunc, method, path string) (int, bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, path, nil))
+		var got struct {
+			Paused bool `json:"paused"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return rec.Code, got.Paused
+	}
+	n := &recordingNotifier{}
+	deliver := func() int {
+		t.Helper()
+		n.events = nil
+		dispatchAlerts(context.Background(), []AlertEvent{{Kind: alertBubble, LineY: 120, Time: time.Now()}}, []Notifier{n}, testConfig())
+		alertsInFlight.Wait()
+		return len(n.events)
+	}
+
+	if code, _ := paused(handlePause, "GET", "/pause"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /pause = %d, want 405", code)
+	}
+	if code, p := paused(handlePause, "POST", "/pause"); code != http.StatusOK || !p {
+		t.Errorf("POST /pause = %d, paused %v; want 200 and paused", code, p)
+	}
+	if _, p := paused(handleHealthz, "GET", "/healthz"); !p {
+		t.Error("/healthz doesn't report the pause")
+	}
+	if got := deliver(); got != 0 {
+		t.Errorf("%d alerts delivered while paused, want none", got)
+	}
+
+	if code, p := paused(handleResume, "POST", "/resume"); code != http.StatusOK || p {
+		t.Errorf("POST /resume = %d, paused %v; want 200 and not paused", code, p)
+	}
+	if got := deliver(); got != 1 {
+		t.Errorf("%d alerts delivered after resuming, want 1", got)
+	}
+
+	togglePaused() // SIGUSR1
+	if _, p := paused(handleHealthz, "GET", "/healthz"); !p {
+		t.Error("toggling didn't pause alerts")
+	}
+}
+
+func TestPauseKeepsCooldownAndRearm(t *testing.T) {
+	t.Cleanup(func() { setPaused(false) })
+	cfg := testConfig()
+	cfg.AlertCooldown = time.Hour
+	cfg.RearmAfterClearPolls = 3
+	w := newTestWatcher(cfg, newFixture(150, image.Rect(330, 145, 350, 155)))
+	poll := func() int {
+		t.Helper()
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(res.Alerts)
+	}
+
+	setPaused(true)
+	if n := poll(); n != 0 {
+		t.Errorf("%d alerts raised while paused, want none", n)
+	}
+	setPaused(false)
+	if n := poll(); n != 1 {
+		t.Errorf("%d alerts on the first poll after resuming with the bubble still there, want 1", n)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyPauseToggle relays SIGUSR1, which toggles alertsPaused, to c.
+func notifyPauseToggle(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyPauseToggle does nothing: Windows has no SIGUSR1, so alerts can only
+// be paused through /pause.
+func notifyPauseToggle(chan<- os.Signal) {}
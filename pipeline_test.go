@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPipeline drives the whole poll the way run does: an injected capture,
+// detection, the AI request to a fake endpoint, the cooldown and dispatch to
+// a notifier.
+func TestPipeline(t *testing.T) {
+	var aiCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aiCalls.Add(1)
+		if _, err := png.Decode(r.Body); err != nil {
+			http.Error(w, "not a png: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"stockPrice": 4521.25}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.AlertCooldown = time.Minute
+	plain := newFixture(150, image.Rectangle{})
+	bubble := newFixture(150, image.Rect(330, 145, 350, 155))
+
+	frame := plain
+	w := newTestWatcher(cfg, nil)
+	w.capture = func(int) (image.Image, error) { return frame, nil }
+	clock := newFakeClock()
+	w.clock = clock
+	rec := &recordingNotifier{}
+	w.notifiers = []Notifier{rec}
+
+	poll := func(img *image.RGBA) []AlertEvent {
+		t.Helper()
+		frame = img
+		before := len(rec.events)
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatchAlerts(context.Background(), res.Alerts, w.notifiers, w.cfg)
+		alertsInFlight.Wait()
+		clock.Advance(cfg.PollInterval)
+		return rec.events[before:]
+	}
+
+	if got := poll(plain); len(got) != 0 {
+		t.Errorf("plain fixture: %d alerts, want none", len(got))
+	}
+	got := poll(bubble)
+	if len(got) != 1 {
+		t.Fatalf("bubble fixture: %d alerts, want 1", len(got))
+	}
+	if ev := got[0]; ev.Kind != alertBubble || ev.LineY != 150 || ev.Price != 4521.25 {
+		t.Errorf("alert = %s at Y=%d, price %v; want a bubble alert at Y=150, price 4521.25", ev.Kind, ev.LineY, ev.Price)
+	}
+	if got := poll(bubble); len(got) != 0 {
+		t.Errorf("bubble fixture again within AlertCooldown: %d alerts, want none", len(got))
+	}
+	clock.Advance(cfg.AlertCooldown)
+	if got := poll(bubble); len(got) != 1 {
+		t.Errorf("bubble fixture after AlertCooldown: %d alerts, want 1", len(got))
+	}
+	if n := aiCalls.Load(); n != 4 {
+		t.Errorf("%d AI requests, want one per poll", n)
+	}
+}
+
+// TestPipelineMirroredDisplays shows the same frame on two displays: the
+// second display's read re-uses the first's answer instead of asking again.
+func TestPipelineMirroredDisplays(t *testing.T) {
+	var aiCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aiCalls.Add(1)
+		fmt.Fprint(w, `{"stockPrice": 4521.25}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AIEndpoint = srv.URL
+	cfg.DisplayIndices = []int{0, 1}
+	bubble := newFixture(150, image.Rect(330, 145, 350, 155))
+	w := newTestWatcher(cfg, nil)
+	w.capture = func(int) (image.Image, error) { return bubble, nil }
+
+	res, err := w.checkOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Alerts) != 2 {
+		t.Fatalf("%d alerts, want one per display", len(res.Alerts))
+	}
+	for _, ev := range res.Alerts {
+		if ev.Price != 4521.25 {
+			t.Errorf("display %d alert price %v, want 4521.25", ev.Display, ev.Price)
+		}
+	}
+	if n := aiCalls.Load(); n != 1 {
+		t.Errorf("%d AI requests, want 1", n)
+	}
+
+	// the answer is only kept for the poll it was read in
+	if _, err := w.checkOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := aiCalls.Load(); n != 2 {
+		t.Errorf("%d AI requests after a second poll, want 2", n)
+	}
+}
+
+// TestPipelineConcurrentAI: with several displays their AI requests are in
+// flight together, up to AIConcurrency.
+func TestPipelineConcurrentAI(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		var running, peak atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := running.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(50 * time.Millisecond)
+			running.Add(-1)
+			fmt.Fprint(w, `{"stockPrice": 4521.25}`)
+		}))
+
+		cfg := testConfig()
+		cfg.AIEndpoint = srv.URL
+		cfg.AIConcurrency = concurrency
+		cfg.DisplayIndices = []int{0, 1}
+		frames := []*image.RGBA{newFixture(100, image.Rectangle{}), newFixture(200, image.Rectangle{})}
+		w := newTestWatcher(cfg, nil)
+		w.capture = func(display int) (image.Image, error) { return frames[display], nil }
+
+		res, err := w.checkOnce(context.Background())
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.RedLineFound || res.Display != 0 || res.RedLineY != 100 || res.StockPrice != 4521.25 {
+			t.Errorf("AIConcurrency %d: line %v at Y=%d on display %d, price %v; want display 0's line at Y=100, priced",
+				concurrency, res.RedLineFound, res.RedLineY, res.Display, res.StockPrice)
+		}
+		if p := peak.Load(); p != int32(concurrency) {
+			t.Errorf("AIConcurrency %d: %d AI requests in flight at once", concurrency, p)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// Screenshots come back as *image.RGBA, so the counters below read Pix
+// directly for that case; going through img.At(x, y).RGBA() costs an
+// interface call and a 16-bit conversion per pixel, which adds up on a 4K
+// display. The pixel test is called inline rather than through a func value so
+// the compiler can inline it into the loop. Other image types take the generic
+// path.
+
+// countLinePixels counts the pixels in rect that fall inside p.
+func countLinePixels(img image.Image, rect image.Rectangle, p ColorProfile) int {
+	count := 0
+
+	if rgba, ok := img.(*image.RGBA); ok {
+		rect = rect.Intersect(rgba.Rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			row := pixRow(rgba, rect, y)
+			for i := 0; i < len(row); i += 4 {
+				if isLineColor(row[i], row[i+1], row[i+2], p) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b := rgbAt(img, x, y)
+			if isLineColor(r, g, b, p) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// rowScan accumulates a rowStat as a row's pixels are visited left to right.
+type rowScan struct {
+	st            rowStat
+	run, runStart int
+}
+
+func newRowScan() rowScan {
+	return rowScan{st: rowStat{first: -1, last: -1}}
+}
+
+func (s *rowScan) add(x int, match bool) {
+	if !match {
+		s.run = 0
+		return
+	}
+	if s.st.count == 0 {
+		s.st.first = x
+	} else if s.run == 0 {
+		gap := x - s.st.last - 1
+		s.st.gaps++
+		s.st.gapSum += gap
+		s.st.gapSqSum += gap * gap
+	}
+	s.st.count++
+	s.st.last = x
+	if s.run == 0 {
+		s.runStart = x
+	}
+	s.run++
+	if s.run > s.st.runLen {
+		s.st.runLen, s.st.runStart = s.run, s.runStart
+	}
+}
+
+// result returns the stat with counts and run lengths scaled back up by the
+// sampling stride, so they stay comparable to full-resolution thresholds.
+func (s *rowScan) result(stride int) rowStat {
+	st := s.st
+	st.count *= stride
+	st.runLen *= stride
+	return st
+}
+
+// scanLineRow collects rowStat for the pixels of row y in [x0, x1) that fall
+// inside p, looking at every stride-th pixel only.
+func scanLineRow(img image.Image, y, x0, x1 int, p ColorProfile, stride int) rowStat {
+	stride = max(stride, 1)
+	s := newRowScan()
+
+	if rgba, ok := img.(*image.RGBA); ok {
+		rect := image.Rect(x0, y, x1, y+1).Intersect(rgba.Rect)
+		if rect.Empty() {
+			return s.st
+		}
+		row := pixRow(rgba, rect, y)
+		for i, x := 0, rect.Min.X; i < len(row); i, x = i+4*stride, x+stride {
+			s.add(x, isLineColor(row[i], row[i+1], row[i+2], p))
+		}
+	} else {
+		for x := x0; x < x1; x += stride {
+			r, g, b := rgbAt(img, x, y)
+			s.add(x, isLineColor(r, g, b, p))
+		}
+	}
+	return s.result(stride)
+}
+
+// scanEdgeRow is scanLineRow for edge mode: a pixel only counts if it falls
+// inside p and is at least delta redder (see redness) than the pixel directly
+// above or below it. Pixels outside the image count as black.
+func scanEdgeRow(img image.Image, y, x0, x1 int, p ColorProfile, stride, delta int) rowStat {
+	stride = max(stride, 1)
+	s := newRowScan()
+	for x := x0; x < x1; x += stride {
+		r, g, b := rgbAt(img, x, y)
+		if !isLineColor(r, g, b, p) {
+			s.add(x, false)
+			continue
+		}
+		here := redness(r, g, b)
+		above := redness(rgbAt(img, x, y-1))
+		below := redness(rgbAt(img, x, y+1))
+		s.add(x, here-above >= delta || here-below >= delta)
+	}
+	return s.result(stride)
+}
+
+// redness is how much a pixel's red exceeds the mean of its green and blue.
+func redness(r, g, b uint8) int {
+	return int(r) - (int(g)+int(b))/2
+}
+
+// brightBlob counts the bubble pixels in rect (bright, or dark with
+// BubblePolarity "dark"; see bubbleTest) and returns their bounding box
+// (empty when there are none). With cfg.ScanStride > 1 it samples every
+// stride-th pixel of every stride-th row; each sample then stands for a
+// stride x stride cell, in the count and in the box.
+func brightBlob(img image.Image, rect image.Rectangle, cfg Config) (int, image.Rectangle) {
+	stride := max(cfg.ScanStride, 1)
+	isBubble := cfg.bubbleTest()
+	count := 0
+	var box image.Rectangle
+	add := func(x, y int) {
+		if count == 0 {
+			box = image.Rect(x, y, x+stride, y+stride)
+		} else {
+			box.Min.X, box.Max.X = min(box.Min.X, x), max(box.Max.X, x+stride)
+			box.Max.Y = y + stride // rows are scanned top to bottom
+		}
+		count++
+	}
+
+	if rgba, ok := img.(*image.RGBA); ok {
+		rect = rect.Intersect(rgba.Rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y += stride {
+			row := pixRow(rgba, rect, y)
+			for i := 0; i < len(row); i += 4 * stride {
+				if isBubble(row[i], row[i+1], row[i+2], cfg) {
+					add(rect.Min.X+i/4, y)
+				}
+			}
+		}
+	} else {
+		for y := rect.Min.Y; y < rect.Max.Y; y += stride {
+			for x := rect.Min.X; x < rect.Max.X; x += stride {
+				r, g, b := rgbAt(img, x, y)
+				if isBubble(r, g, b, cfg) {
+					add(x, y)
+				}
+			}
+		}
+	}
+	if stride > 1 {
+		box = box.Intersect(rect)
+	}
+	return count * stride * stride, box
+}
+
+// meanBrightness is the average r+g+b over rect, sampling every stride-th
+// pixel of every stride-th row. An empty rect is 0.
+func meanBrightness(img image.Image, rect image.Rectangle, stride int) int {
+	stride = max(stride, 1)
+	var sum, n int
+	for y := rect.Min.Y; y < rect.Max.Y; y += stride {
+		for x := rect.Min.X; x < rect.Max.X; x += stride {
+			r, g, b := rgbAt(img, x, y)
+			sum += int(r) + int(g) + int(b)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / n
+}
+
+// meanLineColor is the average color of the pixels in row y between x0 and x1
+// that fall inside p, sampling every stride-th pixel; black if none do. It
+// only runs on a detected line's row, so takes the generic path.
+func meanLineColor(img image.Image, y, x0, x1 int, p ColorProfile, stride int) color.RGBA {
+	stride = max(stride, 1)
+	var sr, sg, sb, n int
+	for x := x0; x < x1; x += stride {
+		r, g, b := rgbAt(img, x, y)
+		if isLineColor(r, g, b, p) {
+			sr, sg, sb = sr+int(r), sg+int(g), sb+int(b)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.RGBA{A: 0xff}
+	}
+	return color.RGBA{R: uint8(sr / n), G: uint8(sg / n), B: uint8(sb / n), A: 0xff}
+}
+
+// pixRow returns the raw RGBA bytes of row y between rect.Min.X and rect.Max.X.
+// rect must already be clipped to rgba.Rect.
+func pixRow(rgba *image.RGBA, rect image.Rectangle, y int) []byte {
+	i := rgba.PixOffset(rect.Min.X, y)
+	n := rect.Dx() * 4
+	return rgba.Pix[i : i+n : i+n]
+}
+
+// averageBrightness returns the mean (r+g+b)/3 of img on a 0-255 scale. It
+// samples a sparse grid; that's plenty to tell a black frame from a chart.
+func averageBrightness(img image.Image) float64 {
+	const step = 8
+	b := img.Bounds()
+	var sum, n int
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, bl := rgbAt(img, x, y)
+			sum += int(r) + int(g) + int(bl)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(sum) / float64(n) / 3
+}
+
+// dominantColorShare returns the fraction of rect's pixels that share its
+// most common color, with colors quantized to 16 levels per channel so noise
+// and compression don't split one background into many colors. Like
+// averageBrightness it samples a sparse grid.
+func dominantColorShare(img image.Image, rect image.Rectangle) float64 {
+	const step = 8
+	counts := map[[3]uint8]int{}
+	n, top := 0, 0
+	for y := rect.Min.Y; y < rect.Max.Y; y += step {
+		for x := rect.Min.X; x < rect.Max.X; x += step {
+			r, g, b := rgbAt(img, x, y)
+			k := [3]uint8{r >> 4, g >> 4, b >> 4}
+			counts[k]++
+			top = max(top, counts[k])
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(top) / float64(n)
+}
+
+// rgbAt returns the 8-bit RGB components of the pixel at (x, y).
+func rgbAt(img image.Image, x, y int) (r, g, b uint8) {
+	if rgba, ok := img.(*image.RGBA); ok {
+		if !(image.Point{x, y}.In(rgba.Rect)) {
+			return 0, 0, 0
+		}
+		i := rgba.PixOffset(x, y)
+		return rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2]
+	}
+	r16, g16, b16, _ := img.At(x, y).RGBA()
+	return uint8(r16 >> 8), uint8(g16 >> 8), uint8(b16 >> 8)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// profileMux serves the net/http/pprof handlers under /debug/pprof/. They are
+// registered on a mux of their own rather than http.DefaultServeMux, so they
+// are only reachable on ProfileAddr.
+func profileMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// serveProfile runs the pprof server for -profile on addr until ctx is
+// cancelled, then shuts it down.
+func serveProfile(ctx context.Context, addr string) {
+	srv := &http.Server{Addr: addr, Handler: profileMux(), BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("profile server shutdown error:", err)
+		}
+	}()
+
+	log.Printf("pprof listening on %s\n", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("profile server error:", err)
+	}
+}
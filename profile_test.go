@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfileMux(t *testing.T) {
+	rec := httptest.NewRecorder()
+	profileMux().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("/debug/pprof/ = %d %q, want the pprof index", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	profileMux().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/heap?debug=1", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "heap profile") {
+		t.Errorf("/debug/pprof/heap = %d, want a heap profile", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseTimeOfDay parses a local "15:04" time of day into how long after
+// midnight it is.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day like \"21:30\"", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// inQuietHours reports whether t, in local time, falls in
+// [QuietHoursStart, QuietHoursEnd). A start later than the end wraps past
+// midnight, so "22:00" to "07:00" covers the night. Unset quiet hours, or a
+// config that doesn't validate, are never quiet.
+func (cfg Config) inQuietHours(t time.Time) bool {
+	if cfg.QuietHoursStart == "" || cfg.QuietHoursEnd == "" {
+		return false
+	}
+	start, err1 := parseTimeOfDay(cfg.QuietHoursStart)
+	end, err2 := parseTimeOfDay(cfg.QuietHoursEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	t = t.Local()
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// quietNotifiers returns the notifiers named in QuietHoursNotifiers, the
+// ones still told about alerts during quiet hours.
+func quietNotifiers(notifiers []Notifier, cfg Config) []Notifier {
+	var out []Notifier
+	for _, n := range notifiers {
+		for _, name := range cfg.QuietHoursNotifiers {
+			if notifierName(n) == name {
+				out = append(out, n)
+				break
+			}
+		}
+	}
+	return out
+}
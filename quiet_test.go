@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hh, mm int) time.Time { return time.Date(2024, 3, 1, hh, mm, 0, 0, time.Local) }
+	tests := []struct {
+		start, end string
+		t          time.Time
+		want       bool
+	}{
+		{"", "", at(3, 0), false},
+		{"12:00", "13:30", at(11, 59), false},
+		{"12:00", "13:30", at(12, 0), true},
+		{"12:00", "13:30", at(13, 29), true},
+		{"12:00", "13:30", at(13, 30), false},
+		// past midnight
+		{"22:00", "07:00", at(21, 59), false},
+		{"22:00", "07:00", at(23, 15), true},
+		{"22:00", "07:00", at(0, 0), true},
+		{"22:00", "07:00", at(6, 59), true},
+		{"22:00", "07:00", at(7, 0), false},
+		{"22:00", "07:00", at(12, 0), false},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.QuietHoursStart, cfg.QuietHoursEnd = tt.start, tt.end
+		if got := cfg.inQuietHours(tt.t); got != tt.want {
+			t.Errorf("%s-%s at %s: quiet = %v, want %v", tt.start, tt.end, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.QuietHoursStart, cfg.QuietHoursEnd = "25:00", ""
+	err := cfg.Validate()
+	for _, want := range []string{"QuietHoursStart and QuietHoursEnd must be set together", "QuietHoursStart:"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate err = %v, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestTriggerAlertQuietHours(t *testing.T) {
+	cfg := testConfig()
+	cfg.QuietHoursStart, cfg.QuietHoursEnd = "22:00", "07:00"
+	n := &recordingNotifier{}
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, time.Local)
+
+	triggerAlert(context.Background(), AlertEvent{Kind: alertBubble, Time: night}, []Notifier{n}, cfg)
+	if len(n.events) != 0 {
+		t.Errorf("a notifier outside QuietHoursNotifiers got %d alerts during quiet hours", len(n.events))
+	}
+	triggerAlert(context.Background(), AlertEvent{Kind: alertBubble, Time: night.Add(9 * time.Hour)}, []Notifier{n}, cfg)
+	if len(n.events) != 1 {
+		t.Errorf("got %d alerts after quiet hours, want 1", len(n.events))
+	}
+
+	cfg.QuietHoursNotifiers = []string{notifierLog, notifierWebhook}
+	all := []Notifier{BeepNotifier{}, WebhookNotifier{URL: "http://example.invalid"}, LogNotifier{}}
+	if got, want := quietNotifiers(all, cfg), all[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("quiet notifiers = %v, want the webhook and log ones", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "log/slog"
+
+// reload re-reads the settings (the config file at path, then the
+// environment) and, if they are valid, queues them for run to switch to
+// before its next poll; otherwise the current config stays. It is safe to
+// call from any goroutine, e.g. on SIGHUP.
+func (w *Watcher) reload(path string) {
+	cfg, err := LoadConfig(path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		slog.Error("config reload failed, keeping the current config", "path", path, "err", err)
+		return
+	}
+	w.pending.Store(&cfg)
+	slog.Info("config reloaded, applying before the next poll", "path", path)
+}
+
+// applyConfig switches the watcher to cfg. It must run on the goroutine that
+// runs the poll loop. MetricsAddr, ProfileAddr, StreamFrames, ResultsLogPath,
+// AlertLogPath, StatePath and MaxRuntime are only read at startup, so changes
+// to them wait for a restart.
+func (w *Watcher) applyConfig(cfg Config) {
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		slog.Error("config reload failed, keeping the current config", "err", err)
+		return
+	}
+	if err := setupLogging(cfg); err != nil {
+		slog.Error("config reload: keeping the current logging setup", "err", err)
+	}
+	if cfg.MetricsAddr != w.cfg.MetricsAddr || cfg.ProfileAddr != w.cfg.ProfileAddr || cfg.StreamFrames != w.cfg.StreamFrames || cfg.ResultsLogPath != w.cfg.ResultsLogPath ||
+		cfg.AlertLogPath != w.cfg.AlertLogPath || cfg.StatePath != w.cfg.StatePath || cfg.MaxRuntime != w.cfg.MaxRuntime {
+		slog.Warn("MetricsAddr, ProfileAddr, StreamFrames, ResultsLogPath, AlertLogPath, StatePath and MaxRuntime changes take effect after a restart")
+		cfg.StreamFrames = w.cfg.StreamFrames // /stream is only registered at startup
+	}
+
+	if cfg.AlertHistorySize != w.cfg.AlertHistorySize {
+		recentAlerts.setSize(cfg.AlertHistorySize) // starts the history over
+	}
+	if cfg.AIConcurrency != w.cfg.AIConcurrency {
+		w.ai = newAIQueue(cfg.AIConcurrency) // nothing is queued between polls
+	}
+	if cfg.AITimeout != w.cfg.AITimeout || cfg.AIConcurrency != w.cfg.AIConcurrency || cfg.AIIdleConnTimeout != w.cfg.AIIdleConnTimeout {
+		w.aiClient.CloseIdleConnections()
+		w.aiClient = newAIClient(cfg)
+	}
+	if cfg.AIBreakerFailures != w.cfg.AIBreakerFailures || cfg.AIBreakerCooldown != w.cfg.AIBreakerCooldown {
+		w.breaker = newAIBreaker(cfg.AIBreakerFailures, cfg.AIBreakerCooldown) // closed again
+	}
+	w.cfg = cfg
+	w.notifiers = notifiers
+	w.cooldown.period = cfg.AlertCooldown
+	slog.Info("effective config", "config", cfg)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.conf")
+	write := func(conf string) {
+		if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := newTestWatcher(testConfig(), newFixture(150, image.Rectangle{}))
+
+	write("WATCHER_POLL_INTERVAL=0s\n") // invalid: keep the current config
+	w.reload(path)
+	if w.pending.Load() != nil {
+		t.Fatal("an invalid config was queued")
+	}
+
+	write("WATCHER_POLL_INTERVAL=2s\nWATCHER_ALERT_COOLDOWN=1m\n")
+	w.reload(path)
+	next := w.pending.Swap(nil)
+	if next == nil {
+		t.Fatal("a valid config wasn't queued")
+	}
+	w.applyConfig(*next)
+	if w.cfg.PollInterval != 2*time.Second || w.cooldown.period != time.Minute {
+		t.Errorf("PollInterval %s, cooldown %s after reload; want 2s, 1m", w.cfg.PollInterval, w.cooldown.period)
+	}
+}
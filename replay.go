@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// replayRecord is one line of -replay output: the results-log record for the
+// frame, plus the file it came from.
+type replayRecord struct {
+	File string `json:"file"`
+	frameRecord
+}
+
+// replayConfig returns cfg adjusted for replaying saved frames: one "display"
+// (the file), no AI request, nothing written to disk and no alert cooldown,
+// since frames replay far faster than they were captured. Today's cursor
+// position has nothing to do with the saved frames, so it isn't masked.
+func replayConfig(cfg Config) Config {
+	cfg.DisplayIndices = nil
+	cfg.AIEndpoint = ""
+	cfg.EnableOCRFallback = false
+	cfg.SaveFrames = false
+	cfg.OverlayPath = ""
+	cfg.ResultsLogPath = ""
+	cfg.AlertLogPath = ""
+	cfg.AlertCooldown = 0
+	cfg.IgnoreCursorRegion = false
+	return cfg
+}
+
+// replayFrames lists the saved frames in dir in name order, which for
+// saveFrame's timestamped names is capture order. Annotated copies are
+// skipped.
+func replayFrames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replay dir: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, annotatedPrefix) || !slices.Contains(frameExts, strings.ToLower(filepath.Ext(name))) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// runReplay runs detection over every frame in dir, in order, and prints one
+// JSON line per file to out. Confirmation carries over from frame to frame as
+// it would live, but alerts are only reported, never sent. It returns the
+// process exit code: 0 if every frame was read, 2 otherwise.
+func runReplay(ctx context.Context, dir string, cfg Config, out io.Writer) int {
+	files, err := replayFrames(dir)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	w, err := newWatcher(replayConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(out, "failed to set up watcher:", err)
+		return 2
+	}
+	defer w.Close()
+	w.screens = func() []image.Rectangle { return nil } // the frames are off disk, not the screen
+
+	enc := json.NewEncoder(out)
+	code := 0
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return 2
+		}
+		w.capture = func(int) (image.Image, error) { return loadImage(file) }
+		res, err := w.checkOnce(ctx)
+		if err != nil {
+			code = 2
+		}
+		if err := enc.Encode(replayRecord{File: filepath.Base(file), frameRecord: newFrameRecord(res, err)}); err != nil {
+			return 2
+		}
+	}
+	return code
+}
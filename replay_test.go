@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig()
+	// a production config's overlay must not be replaced by replayed frames
+	cfg.OverlayPath = filepath.Join(t.TempDir(), "overlay.png")
+	write := func(name string, img image.Image) {
+		t.Helper()
+		if err := saveImageToFile(img, filepath.Join(dir, name), cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("frame-2.png", newFixture(150, image.Rectangle{}))
+	write("frame-1.png", newFixture(150, image.Rect(330, 145, 350, 155)))
+	write(annotatedPrefix+"1.png", newFixture(150, image.Rect(330, 145, 350, 155)))
+	if err := os.WriteFile(filepath.Join(dir, "frame-3.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("skip me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := runReplay(context.Background(), dir, cfg, &out); code != 2 {
+		t.Errorf("exit code = %d, want 2 for the unreadable frame", code)
+	}
+
+	var recs []replayRecord
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var rec replayRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(recs), recs)
+	}
+
+	if r := recs[0]; r.File != "frame-1.png" || !r.BubbleDetected || len(r.Alerts) != 1 || r.LineY == nil || *r.LineY != 150 {
+		t.Errorf("frame-1: %+v, want a bubble alert at Y=150", r)
+	}
+	if r := recs[1]; r.File != "frame-2.png" || !r.LineFound || r.BubbleDetected || len(r.Alerts) != 0 {
+		t.Errorf("frame-2: %+v, want a line and no bubble", r)
+	}
+	if r := recs[2]; r.File != "frame-3.png" || r.Error == "" {
+		t.Errorf("frame-3: %+v, want a decode error", r)
+	}
+	if _, err := os.Stat(cfg.OverlayPath); !os.IsNotExist(err) {
+		t.Errorf("replay wrote OverlayPath (stat err %v)", err)
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig()
+	good := filepath.Join(dir, "frame-1.png")
+	if err := saveImageToFile(newFixture(150, image.Rectangle{}), good, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if img, err := loadImage(good); err != nil || img.Bounds() != image.Rect(0, 0, 400, 300) {
+		t.Fatalf("loadImage = %v, %v; want the 400x300 fixture", img, err)
+	}
+
+	data, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"truncated.png": data[:len(data)/2],
+		"notes.png":     []byte("not a png"),
+		"empty.png":     nil,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		file, want string
+	}{
+		{"truncated.png", "truncated.png is truncated"},
+		{"notes.png", "notes.png is not a PNG or JPEG image"},
+		{"empty.png", "empty.png is empty"},
+		{"missing.png", "failed to read image"},
+	}
+	for _, tt := range tests {
+		_, err := loadImage(filepath.Join(dir, tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadImage(%s) err = %v, want %q", tt.file, err, tt.want)
+		}
+	}
+}
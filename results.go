@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// resultsFlushInterval is how long a poll's record may sit in the results
+// buffer before it is written out.
+const resultsFlushInterval = 5 * time.Second
+
+// resultsLog appends one JSON line per poll to cfg.ResultsLogPath, for
+// offline analysis. Writes are buffered; before each flush the path is
+// checked, and if the file was rotated away (renamed or deleted) a new one is
+// opened in its place.
+type resultsLog struct {
+	mu        sync.Mutex
+	path      string
+	f         *os.File
+	w         *bufio.Writer
+	lastFlush time.Time
+}
+
+// frameRecord is one line of the results log.
+type frameRecord struct {
+	Time           time.Time             `json:"time"`
+	Error          string                `json:"error,omitempty"`
+	LineFound      bool                  `json:"lineFound"`
+	LineY          *int                  `json:"lineY"`
+	LineConfidence *float64              `json:"lineConfidence"`
+	LineColor      string                `json:"lineColor,omitempty"`
+	Display        *int                  `json:"display"`
+	BubbleDetected bool                  `json:"bubbleDetected"`
+	Price          *float64              `json:"price"` // null when the AI step produced no price
+	PriceStale     bool                  `json:"priceStale,omitempty"`
+	Alerts         []alertWebhookPayload `json:"alerts"`
+	Timings        pollTimings           `json:"timings"`
+}
+
+func openResultsLog(path string) (*resultsLog, error) {
+	l := &resultsLog{path: path, lastFlush: time.Now()}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *resultsLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open results log: %w", err)
+	}
+	l.f, l.w = f, bufio.NewWriter(f)
+	return nil
+}
+
+// write appends the record for one poll. A nil log does nothing, so callers
+// needn't check whether ResultsLogPath is set.
+func (l *resultsLog) write(res FrameResult, pollErr error) {
+	if l == nil {
+		return
+	}
+
+	rec := newFrameRecord(res, pollErr)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := json.NewEncoder(l.w).Encode(rec); err != nil {
+		log.Println("results log error:", err)
+		return
+	}
+	if time.Since(l.lastFlush) >= resultsFlushInterval {
+		if err := l.flushLocked(); err != nil {
+			log.Println("results log error:", err)
+		}
+	}
+}
+
+// newFrameRecord returns the record describing one poll.
+func newFrameRecord(res FrameResult, pollErr error) frameRecord {
+	rec := frameRecord{
+		Time:           time.Now(),
+		LineFound:      res.RedLineFound,
+		BubbleDetected: res.BubbleDetected,
+		Alerts:         []alertWebhookPayload{},
+		Timings:        res.Timings,
+	}
+	if pollErr != nil {
+		rec.Error = pollErr.Error()
+	}
+	if res.RedLineFound {
+		rec.LineY, rec.Display = &res.RedLineY, &res.Display
+		rec.LineConfidence, rec.LineColor = &res.LineConfidence, res.LineColor
+	}
+	if !math.IsNaN(res.StockPrice) {
+		rec.Price, rec.PriceStale = &res.StockPrice, res.PriceStale
+	}
+	for _, ev := range res.Alerts {
+		rec.Alerts = append(rec.Alerts, webhookPayload(ev))
+	}
+	return rec
+}
+
+// flushLocked writes the buffer out and reopens the path if the file was
+// rotated. l.mu must be held.
+func (l *resultsLog) flushLocked() error {
+	l.lastFlush = time.Now()
+	if err := l.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush results log: %w", err)
+	}
+
+	cur, err := l.f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat results log: %w", err)
+	}
+	if onDisk, err := os.Stat(l.path); err == nil && os.SameFile(cur, onDisk) {
+		return nil
+	}
+	l.f.Close()
+	return l.open()
+}
+
+// Close flushes anything buffered and closes the file.
+func (l *resultsLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return fmt.Errorf("failed to flush results log: %w", err)
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readRecords(t *testing.T, path string) []frameRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var recs []frameRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec frameRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestResultsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	l, err := openResultsLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit := FrameResult{RedLineFound: true, RedLineY: 150, BubbleDetected: true, StockPrice: 4521.25,
+		Alerts: []AlertEvent{{Kind: alertBubble, LineY: 150, Color: "red", Price: 4521.25, Time: time.Now()}}}
+	l.write(hit, nil)
+	l.write(FrameResult{StockPrice: math.NaN()}, errString("capture failed"))
+
+	// rotate the file away; the next flush should start a new one
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	if err := l.flushLocked(); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Unlock()
+	l.write(FrameResult{StockPrice: math.NaN()}, nil)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	old := readRecords(t, path+".1")
+	if len(old) != 2 {
+		t.Fatalf("rotated file has %d records, want 2", len(old))
+	}
+	if *old[0].LineY != 150 || *old[0].Price != 4521.25 || len(old[0].Alerts) != 1 {
+		t.Errorf("first record = %+v", old[0])
+	}
+	if old[1].Error != "capture failed" || old[1].Price != nil || old[1].LineY != nil {
+		t.Errorf("second record = %+v", old[1])
+	}
+	if cur := readRecords(t, path); len(cur) != 1 {
+		t.Errorf("new file has %d records, want 1", len(cur))
+	}
+}
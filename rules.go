@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Alert rule conditions besides the alert kinds themselves.
+const (
+	ruleFaint = "faint" // any alert on a line whose Confidence is below FaintLineConfidence
+	ruleAny   = "*"     // every alert; put it last as a catch-all
+)
+
+// alertRule sends alerts matching Condition (an alert kind, "faint" or "*")
+// only to Notifiers. Empty Notifiers still records the alert (recentAlerts,
+// AlertLogPath) but tells no one.
+type alertRule struct {
+	Condition string
+	Notifiers []string
+}
+
+// matches reports whether ev meets the rule's condition.
+func (r alertRule) matches(ev AlertEvent, cfg Config) bool {
+	switch r.Condition {
+	case ruleAny:
+		return true
+	case ruleFaint:
+		return ev.Confidence > 0 && ev.Confidence < cfg.FaintLineConfidence
+	}
+	return r.Condition == ev.Kind
+}
+
+// ruleNotifiers returns the notifiers the first AlertRules rule matching ev
+// names. With no rules, or none matching, every notifier is used, as before
+// rules existed.
+func ruleNotifiers(ev AlertEvent, notifiers []Notifier, cfg Config) []Notifier {
+	for _, r := range cfg.AlertRules {
+		if !r.matches(ev, cfg) {
+			continue
+		}
+		var out []Notifier
+		for _, n := range notifiers {
+			if slices.Contains(r.Notifiers, notifierName(n)) {
+				out = append(out, n)
+			}
+		}
+		slog.Debug("alert rule matched", "kind", ev.Kind, "condition", r.Condition, "notifiers", r.Notifiers)
+		return out
+	}
+	return notifiers
+}
+
+// alertRulesVar parses AlertRules as comma-separated
+// "condition:notifier+notifier" rules, e.g.
+// "faint:log,bubble:beep+log,line_moved:webhook". "faint:" tells no one.
+func alertRulesVar(p *[]alertRule) func(string) error {
+	return func(s string) error {
+		var out []alertRule
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			cond, names, ok := strings.Cut(v, ":")
+			if !ok || strings.TrimSpace(cond) == "" {
+				return errString(`not a list of "condition:notifier+notifier" rules (e.g. "faint:log,bubble:beep+log")`)
+			}
+			r := alertRule{Condition: strings.TrimSpace(cond)}
+			for _, name := range strings.Split(names, "+") {
+				if name = strings.TrimSpace(name); name != "" {
+					r.Notifiers = append(r.Notifiers, name)
+				}
+			}
+			out = append(out, r)
+		}
+		*p = out
+		return nil
+	}
+}
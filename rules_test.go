@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertRules(t *testing.T) {
+	t.Setenv("WATCHER_ALERT_RULES", "faint:log, bubble:beep+log, line_moved:webhook, crossing:")
+	cfg, err := LoadConfigFromEnv(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []alertRule{
+		{ruleFaint, []string{notifierLog}},
+		{alertBubble, []string{notifierBeep, notifierLog}},
+		{alertLineMoved, []string{notifierWebhook}},
+		{alertCrossing, nil},
+	}
+	if !reflect.DeepEqual(cfg.AlertRules, want) {
+		t.Fatalf("AlertRules = %+v, want %+v", cfg.AlertRules, want)
+	}
+
+	beep, webhook, logn := BeepNotifier{}, WebhookNotifier{URL: "http://example.invalid"}, LogNotifier{}
+	all := []Notifier{beep, webhook, logn}
+	tests := []struct {
+		name string
+		ev   AlertEvent
+		want []Notifier
+	}{
+		{"bubble", AlertEvent{Kind: alertBubble, Confidence: 3}, []Notifier{beep, logn}},
+		{"faint bubble", AlertEvent{Kind: alertBubble, Confidence: 1.2}, []Notifier{logn}},
+		{"line moved", AlertEvent{Kind: alertLineMoved, Confidence: 3}, []Notifier{webhook}},
+		{"crossing", AlertEvent{Kind: alertCrossing, Confidence: 3}, nil},
+		{"no rule", AlertEvent{Kind: alertSummary}, all},
+	}
+	for _, tt := range tests {
+		if got := ruleNotifiers(tt.ev, all, cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: notifiers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// by default there are no rules and every notifier hears every alert
+	if got := ruleNotifiers(AlertEvent{Kind: alertBubble, Confidence: 1.2}, all, testConfig()); !reflect.DeepEqual(got, all) {
+		t.Errorf("default: notifiers = %v, want all of them", got)
+	}
+	ev := AlertEvent{Kind: alertCrossing, Confidence: 3, Time: time.Now()}
+	n := &recordingNotifier{}
+	triggerAlert(context.Background(), ev, []Notifier{n}, testConfig())
+	if len(n.events) != 1 {
+		t.Errorf("default: got %d alerts, want 1", len(n.events))
+	}
+
+	cfg.AlertRules = []alertRule{{"bubbles", []string{"pager"}}}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `unknown condition "bubbles"`) || !strings.Contains(err.Error(), `unknown notifier "pager"`) {
+		t.Errorf("Validate err = %v, want the unknown condition and notifier", err)
+	}
+
+	t.Setenv("WATCHER_ALERT_RULES", "bubble")
+	if _, err := LoadConfigFromEnv(testConfig()); err == nil {
+		t.Error(`a rule without its ":" was accepted`)
+	}
+}
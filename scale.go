@@ -0,0 +1,68 @@
+package main
+
+import "image"
+
+// downscale shrinks img by an integer factor with nearest-neighbour sampling:
+// output pixel (x, y) is input pixel (d*x, d*y) relative to the bounds'
+// origin. Lines thinner than d rows can fall between samples, which is fine
+// for the thick lines ScaleDivisor is meant for.
+func downscale(img image.Image, d int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()/d, b.Dy()/d))
+
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := 0; y < out.Rect.Dy(); y++ {
+			src := rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y+y*d):]
+			dst := out.Pix[out.PixOffset(0, y):]
+			for x := 0; x < out.Rect.Dx(); x++ {
+				copy(dst[x*4:x*4+4], src[x*d*4:x*d*4+4])
+			}
+		}
+		return out
+	}
+
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			out.Set(x, y, img.At(b.Min.X+x*d, b.Min.Y+y*d))
+		}
+	}
+	return out
+}
+
+// scaledBy returns cfg with its pixel-count thresholds shrunk for an image
+// downscaled by d, so the same settings work at any ScaleDivisor. Lengths
+// divide by d, areas by d².
+func (cfg Config) scaledBy(d int) Config {
+	cfg.MinRedRunLength /= d
+	cfg.MinRedPixelsPerRow /= d
+	cfg.MinRedPixelsPerCol /= d
+	cfg.LineMergeGap /= d
+	cfg.MaxDistanceBubbleToLine /= d
+	// a set distance stays set rather than rounding down to "unset"
+	if cfg.BubbleDistanceAbove > 0 {
+		cfg.BubbleDistanceAbove = max(cfg.BubbleDistanceAbove/d, 1)
+	}
+	if cfg.BubbleDistanceBelow > 0 {
+		cfg.BubbleDistanceBelow = max(cfg.BubbleDistanceBelow/d, 1)
+	}
+	cfg.BubbleLineEndWindow /= d
+	cfg.CursorRadius /= d
+	cfg.BubbleMinBrightPixels /= d * d
+	cfg.BubbleMinWidth /= d
+	cfg.BubbleMaxWidth /= d
+	cfg.BubbleMinHeight /= d
+	cfg.BubbleMaxHeight /= d
+	return cfg
+}
+
+// scaleLineUp maps a line found in a downscaled image back to full-resolution
+// coordinates, relative to origin (the full image's bounds.Min).
+func scaleLineUp(l Line, d int, origin image.Point) Line {
+	l.Y = origin.Y + l.Y*d
+	l.CenterX = origin.X + l.CenterX*d
+	l.EndX = origin.X + l.EndX*d
+	l.Pixels *= d
+	l.RunLength *= d
+	l.Thickness *= d
+	return l
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// roiSelectFile is where -select-roi saves the frame to pick the ROI from.
+const roiSelectFile = "roi-select.png"
+
+// runSelectROI captures one frame from the first configured display, saves
+// it as roiSelectFile to look at in an image viewer, and takes the rectangle
+// to scan from rect (the -roi flag) or, if that is empty, from a line typed
+// on in. It prints the resulting WATCHER_ROI_RECT setting and, with a
+// configPath, writes it into that file too. It returns the process exit code.
+func (w *Watcher) runSelectROI(in io.Reader, out io.Writer, rect, configPath string) int {
+	img, err := w.capture(w.cfg.displays()[0])
+	if err != nil {
+		fmt.Fprintln(out, "capture failed:", err)
+		return 2
+	}
+	if err := writePNG(roiSelectFile, img); err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	b := img.Bounds()
+	fmt.Fprintf(out, "Saved the %dx%d capture to %s. Open it in an image viewer that shows pixel coordinates.\n",
+		b.Dx(), b.Dy(), roiSelectFile)
+
+	var roi image.Rectangle
+	if rect != "" {
+		if roi, err = parseROI(rect, b); err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+	} else {
+		scanner := bufio.NewScanner(in)
+		for {
+			fmt.Fprint(out, "Enter the top-left and bottom-right corners of the chart to scan as x0,y0,x1,y1: ")
+			if !scanner.Scan() {
+				fmt.Fprintln(out, "\nno rectangle entered")
+				return 2
+			}
+			if roi, err = parseROI(scanner.Text(), b); err == nil {
+				break
+			}
+			fmt.Fprintln(out, err)
+		}
+	}
+
+	value := fmt.Sprintf("%d,%d,%d,%d", roi.Min.X, roi.Min.Y, roi.Max.X, roi.Max.Y)
+	fmt.Fprintf(out, "WATCHER_ROI_RECT=%s\n", value)
+	if configPath != "" {
+		if err := setConfigValue(configPath, "WATCHER_ROI_RECT", value); err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		fmt.Fprintln(out, "Saved to", configPath)
+	}
+	return 0
+}
+
+// parseROI parses an "x0,y0,x1,y1" rectangle and checks it is a usable
+// ROIRect for a capture with the given bounds.
+func parseROI(s string, bounds image.Rectangle) (image.Rectangle, error) {
+	var r image.Rectangle
+	if err := rectVar(&r)(strings.TrimSpace(s)); err != nil {
+		return r, err
+	}
+	if r.Min.X >= r.Max.X || r.Min.Y >= r.Max.Y {
+		return r, fmt.Errorf("%v is empty; give the top-left corner first", r)
+	}
+	if !r.In(bounds) {
+		return r, fmt.Errorf("%v doesn't fit in the %dx%d capture", r, bounds.Dx(), bounds.Dy())
+	}
+	return r, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to save capture: %w", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save capture: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save capture: %w", err)
+	}
+	return nil
+}
+
+// setConfigValue sets name to value in the config file at path: the first
+// line setting name is replaced, or the setting is appended. A missing file
+// is created.
+func setConfigValue(path, name, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	setting := name + "=" + value
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	replaced := false
+	for i, line := range lines {
+		if key, _, ok := strings.Cut(strings.TrimSpace(line), "="); ok && strings.TrimSpace(key) == name {
+			lines[i], replaced = setting, true
+			break
+		}
+	}
+	if !replaced {
+		lines = append(lines, setting)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSelectROI(t *testing.T) {
+	t.Chdir(t.TempDir())
+	configPath := filepath.Join(t.TempDir(), "watcher.conf")
+	if err := os.WriteFile(configPath, []byte("# desk setup\nWATCHER_ROI_RECT=0,0,10,10\nWATCHER_DRY_RUN=true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWatcher(testConfig(), newFixture(150, image.Rectangle{}))
+
+	// a typo and a rectangle off the 400x300 capture are asked again
+	in := strings.NewReader("40 30 360 270\n300,200,500,290\n40,30,360,270\n")
+	var out bytes.Buffer
+	if code := w.runSelectROI(in, &out, "", configPath); code != 0 {
+		t.Fatalf("exit code %d:\n%s", code, out.String())
+	}
+	if n := strings.Count(out.String(), "Enter the top-left"); n != 3 {
+		t.Errorf("prompted %d times, want 3:\n%s", n, out.String())
+	}
+	if _, err := os.Stat(roiSelectFile); err != nil {
+		t.Errorf("capture not saved: %v", err)
+	}
+
+	cfg, err := LoadConfigFile(defaultConfig(), configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ROIRect != image.Rect(40, 30, 360, 270) || !cfg.DryRun {
+		t.Errorf("config file now has ROIRect %v, DryRun %v; want the new rectangle and the other settings kept", cfg.ROIRect, cfg.DryRun)
+	}
+	if data, _ := os.ReadFile(configPath); strings.Count(string(data), "WATCHER_ROI_RECT") != 1 {
+		t.Errorf("config file:\n%s\nwant the old WATCHER_ROI_RECT replaced", data)
+	}
+
+	out.Reset()
+	if code := w.runSelectROI(strings.NewReader(""), &out, "0,0,400,301", ""); code != 2 {
+		t.Errorf("-roi off the capture: exit code %d, want 2", code)
+	}
+	out.Reset()
+	if code := w.runSelectROI(strings.NewReader(""), &out, "10,20,110,220", ""); code != 0 || !strings.Contains(out.String(), "WATCHER_ROI_RECT=10,20,110,220\n") {
+		t.Errorf("-roi: exit code %d, output:\n%s", code, out.String())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// The startup self-check tries each display selfCheckAttempts times,
+// selfCheckRetry apart, so one frame caught mid-wake doesn't fail it.
+const selfCheckAttempts = 3
+
+var selfCheckRetry = time.Second // a var so tests needn't wait
+
+// selfCheck captures cfg's displays once before the loop starts. A capture
+// that errors or comes back blank (see validateCapture) on every display,
+// every attempt, is what a missing Screen Recording permission looks like on
+// macOS; instead of polling that forever, selfCheck returns an error saying
+// how to fix it. One good display is enough: a single unplugged one is
+// checkLayout's business.
+func (w *Watcher) selfCheck(ctx context.Context) error {
+	var errs []error
+	for attempt := 1; attempt <= selfCheckAttempts; attempt++ {
+		errs = errs[:0]
+		for _, display := range w.cfg.displays() {
+			if _, err := w.capture(display); err != nil {
+				errs = append(errs, fmt.Errorf("display %d: %w", display, err))
+				continue
+			}
+			slog.Debug("self-check capture ok", "display", display, "attempt", attempt)
+			return nil
+		}
+		slog.Warn("self-check capture failed", "attempt", attempt, "of", selfCheckAttempts, "err", errors.Join(errs...))
+		if attempt < selfCheckAttempts {
+			select {
+			case <-time.After(selfCheckRetry):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return fmt.Errorf("the screen can't be captured (%w)\n%s", errors.Join(errs...), captureHelp)
+}
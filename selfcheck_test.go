@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfCheck(t *testing.T) {
+	defer func(d time.Duration) { selfCheckRetry = d }(selfCheckRetry)
+	selfCheckRetry = time.Millisecond
+
+	cfg := testConfig()
+	cfg.DisplayIndices = []int{0, 1}
+	blank := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	w := newTestWatcher(cfg, nil)
+	var captures int
+	w.capture = func(int) (image.Image, error) {
+		captures++
+		return nil, validateCapture(blank, cfg.MinCaptureBrightness)
+	}
+	err := w.selfCheck(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "looks blank") || !strings.Contains(err.Error(), captureHelp) {
+		t.Errorf("selfCheck err = %v, want the blank capture and how to fix it", err)
+	}
+	if captures != 2*selfCheckAttempts {
+		t.Errorf("%d captures, want %d attempts on both displays", captures, selfCheckAttempts)
+	}
+
+	// the second display coming good on the second attempt is enough
+	captures = 0
+	w.capture = func(display int) (image.Image, error) {
+		captures++
+		if display == 1 && captures > 2 {
+			return newFixture(150, image.Rectangle{}), nil
+		}
+		return nil, errString("capture failed")
+	}
+	if err := w.selfCheck(context.Background()); err != nil {
+		t.Errorf("selfCheck err = %v once display 1 captured", err)
+	}
+}
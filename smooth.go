@@ -0,0 +1,40 @@
+package main
+
+import "slices"
+
+// lineSmoother keeps the strongest line's last few Ys per display and
+// reports their median, which the pixel or two of anti-aliasing jitter
+// between polls doesn't move. A real move shows once it has lasted for half
+// the window.
+type lineSmoother struct {
+	ys map[int][]int // per display, oldest first
+}
+
+func newLineSmoother() *lineSmoother {
+	return &lineSmoother{ys: map[int][]int{}}
+}
+
+// add records y for display and returns the median of the last window Ys,
+// the lower middle one of an even count so it is always a Y that was seen.
+// A window of 0 or 1 returns y as-is.
+func (s *lineSmoother) add(display, y, window int) int {
+	if window <= 1 {
+		delete(s.ys, display)
+		return y
+	}
+	ys := append(s.ys[display], y)
+	if len(ys) > window {
+		ys = ys[len(ys)-window:]
+	}
+	s.ys[display] = ys
+
+	sorted := slices.Clone(ys)
+	slices.Sort(sorted)
+	return sorted[(len(sorted)-1)/2]
+}
+
+// reset forgets display's history, e.g. when its line disappears, so a line
+// that turns up elsewhere isn't pulled back towards where the old one was.
+func (s *lineSmoother) reset(display int) {
+	delete(s.ys, display)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestLineSmoother(t *testing.T) {
+	s := newLineSmoother()
+	for i, y := range []int{150, 151, 149, 150, 152, 148, 150, 151, 149} {
+		if got := s.add(0, y, 5); got != 150 {
+			t.Errorf("poll %d (Y=%d): median %d, want a steady 150", i, y, got)
+		}
+	}
+
+	// a real move takes over once it fills half the window
+	for i, want := range []int{150, 151, 180} {
+		if got := s.add(0, 180, 5); got != want {
+			t.Errorf("poll %d after the move: median %d, want %d", i, got, want)
+		}
+	}
+
+	s.reset(0)
+	if got := s.add(0, 90, 5); got != 90 {
+		t.Errorf("median after reset = %d, want the new line's 90", got)
+	}
+	if got := s.add(1, 40, 5); got != 40 {
+		t.Errorf("display 1 median = %d, want its own 40", got)
+	}
+	if got := s.add(0, 95, 1); got != 95 {
+		t.Errorf("window 1 returned %d, want the raw 95", got)
+	}
+}
+
+func TestLineSmoothingStopsMoveAlerts(t *testing.T) {
+	cfg := testConfig()
+	cfg.LineMoveThreshold = 3
+	cfg.LineSmoothing = 3
+	w := newTestWatcher(cfg, nil)
+
+	// ±4px of jitter would be a move every poll without smoothing
+	for i, y := range []int{150, 154, 150, 146, 150} {
+		w.capture = func(int) (image.Image, error) { return newFixture(y, image.Rectangle{}), nil }
+		res, err := w.checkOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.RedLineY != 150 || len(res.Alerts) != 0 {
+			t.Errorf("poll %d (Y=%d): reported Y=%d with alerts %+v, want a steady 150 and none", i, y, res.RedLineY, res.Alerts)
+		}
+	}
+}
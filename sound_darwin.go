@@ -0,0 +1,22 @@
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// playSoundFile plays a wav/aiff/mp3 file with afplay and waits for it to
+// finish.
+func playSoundFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if out, err := exec.Command("afplay", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("afplay: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
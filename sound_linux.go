@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// playSoundFile plays a wav file with paplay (PulseAudio or PipeWire), or
+// with ALSA's aplay where paplay isn't installed, and waits for it to finish.
+func playSoundFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	player := "paplay"
+	if _, err := exec.LookPath(player); err != nil {
+		player = "aplay"
+	}
+	if out, err := exec.Command(player, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", player, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+// playSoundFile has no player on this platform; playSound falls back to the
+// beep.
+func playSoundFile(path string) error {
+	return errString("sound files are only supported on macOS, Linux and Windows")
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// playSoundFile plays a wav file through PowerShell's Media.SoundPlayer and
+// waits for it to finish.
+func playSoundFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	// the path goes through the environment: -Command joins every argument
+	// after it into the script, so a path argument would run as code
+	const script = `(New-Object Media.SoundPlayer $env:WATCHER_SOUND).PlaySync()`
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(), "WATCHER_SOUND="+path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("powershell: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// metricsState is the part of watcherMetrics kept in cfg.StatePath, so the
+// totals survive a restart.
+type metricsState struct {
+	FramesProcessed int64     `json:"framesProcessed"`
+	LinesFound      int64     `json:"linesFound"`
+	BubblesDetected int64     `json:"bubblesDetected"`
+	AlertsFired     int64     `json:"alertsFired"`
+	AlertsDropped   int64     `json:"alertsDropped"`
+	SavedAt         time.Time `json:"savedAt"`
+}
+
+// snapshot returns the current counters.
+func (m *watcherMetrics) snapshot() metricsState {
+	return metricsState{
+		FramesProcessed: m.framesProcessed.Load(),
+		LinesFound:      m.linesFound.Load(),
+		BubblesDetected: m.bubblesDetected.Load(),
+		AlertsFired:     m.alertsFired.Load(),
+		AlertsDropped:   m.alertsDropped.Load(),
+	}
+}
+
+// restore sets the counters to s.
+func (m *watcherMetrics) restore(s metricsState) {
+	m.framesProcessed.Store(s.FramesProcessed)
+	m.linesFound.Store(s.LinesFound)
+	m.bubblesDetected.Store(s.BubblesDetected)
+	m.alertsFired.Store(s.AlertsFired)
+	m.alertsDropped.Store(s.AlertsDropped)
+}
+
+// loadMetricsState restores the counters saved at path. A missing file is a
+// first run; an unreadable or corrupt one is reported and the counters start
+// from zero.
+func loadMetricsState(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var s metricsState
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	if err == nil && (s.FramesProcessed < 0 || s.LinesFound < 0 || s.BubblesDetected < 0 || s.AlertsFired < 0 || s.AlertsDropped < 0) {
+		err = errString("negative counter")
+	}
+	if err != nil {
+		slog.Warn("ignoring unreadable state file, counters start from zero", "path", path, "err", err)
+		return
+	}
+	metrics.restore(s)
+	slog.Info("counters restored", "path", path, "savedAt", s.SavedAt, "framesProcessed", s.FramesProcessed, "alertsFired", s.AlertsFired)
+}
+
+// saveMetricsState writes the counters to path. It writes a temporary file
+// and renames it into place, so a crash mid-write leaves the previous state
+// rather than a truncated one.
+func saveMetricsState(path string) error {
+	s := metrics.snapshot()
+	s.SavedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// saveStatePeriodically saves the counters to path every interval until ctx
+// is cancelled. The final save on shutdown is up to the caller, once the
+// alerts in flight have been counted.
+func saveStatePeriodically(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := saveMetricsState(path); err != nil {
+				log.Println("state save error:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricsState(t *testing.T) {
+	saved := metrics.snapshot()
+	t.Cleanup(func() { metrics.restore(saved) })
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	want := metricsState{FramesProcessed: 120, LinesFound: 80, BubblesDetected: 7, AlertsFired: 3, AlertsDropped: 1}
+	metrics.restore(want)
+	if err := saveMetricsState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.restore(metricsState{})
+	loadMetricsState(path)
+	if got := metrics.snapshot(); got != want {
+		t.Errorf("restored %+v, want %+v", got, want)
+	}
+
+	// a missing file leaves the counters alone
+	loadMetricsState(filepath.Join(t.TempDir(), "none.json"))
+	if got := metrics.snapshot(); got != want {
+		t.Errorf("after a missing file: %+v, want %+v", got, want)
+	}
+
+	// a truncated or nonsensical file starts fresh
+	for _, corrupt := range []string{`{"framesProcessed": 12`, `{"framesProcessed": -5}`} {
+		if err := os.WriteFile(path, []byte(corrupt), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		metrics.restore(metricsState{})
+		loadMetricsState(path)
+		if got := metrics.snapshot(); got != (metricsState{}) {
+			t.Errorf("state %q: restored %+v, want zero counters", corrupt, got)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state dir has %d entries, want just the state file", len(entries))
+	}
+}
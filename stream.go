@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// streamBoundary separates the parts of the /stream response.
+const streamBoundary = "bookmapframe"
+
+// liveFrames holds the latest frame for /stream; checkDisplay publishes to it
+// when StreamFrames is on.
+var liveFrames frameFeed
+
+// frameFeed keeps the most recent frame and wakes up the streams waiting for
+// the next one. The JPEG is encoded on first request, once per frame however
+// many viewers there are, and not at all while nobody is watching.
+type frameFeed struct {
+	mu      sync.Mutex
+	img     image.Image
+	quality int
+	jpeg    []byte
+	next    chan struct{} // closed by publish
+}
+
+// publish replaces the current frame with img, JPEG-encoded at quality when
+// it is first streamed.
+func (f *frameFeed) publish(img image.Image, quality int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.img, f.quality, f.jpeg = img, quality, nil
+	if f.next != nil {
+		close(f.next)
+	}
+	f.next = make(chan struct{})
+}
+
+// frame returns the current frame as JPEG (nil before the first publish) and
+// a channel that is closed when it is replaced.
+func (f *frameFeed) frame() ([]byte, <-chan struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.next == nil {
+		f.next = make(chan struct{})
+	}
+	if f.img != nil && f.jpeg == nil {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, f.img, &jpeg.Options{Quality: f.quality}); err != nil {
+			return nil, f.next, fmt.Errorf("failed to encode stream frame: %w", err)
+		}
+		f.jpeg = buf.Bytes()
+	}
+	return f.jpeg, f.next, nil
+}
+
+// handleStream serves liveFrames as MJPEG (multipart/x-mixed-replace), one
+// part per poll, until the client goes away or the server shuts down.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+streamBoundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	for {
+		buf, next, err := liveFrames.frame()
+		if err != nil {
+			log.Println("stream error:", err)
+		} else if buf != nil {
+			if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", streamBoundary, len(buf)); err != nil {
+				return
+			}
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+			if _, err := io.WriteString(w, "\r\n"); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		select {
+		case <-next:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleStream(t *testing.T) {
+	liveFrames.publish(newFixture(150, image.Rectangle{}), 80)
+	srv := httptest.NewServer(http.HandlerFunc(handleStream))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("Content-Type = %q, want multipart/x-mixed-replace", resp.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(resp.Body, params["boundary"])
+
+	next := func() image.Image {
+		t.Helper()
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := part.Header.Get("Content-Type"); ct != "image/jpeg" {
+			t.Errorf("part Content-Type = %q, want image/jpeg", ct)
+		}
+		img, err := jpeg.Decode(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	if b := next().Bounds(); b != image.Rect(0, 0, 400, 300) {
+		t.Errorf("first frame is %v, want the 400x300 fixture", b)
+	}
+	liveFrames.publish(image.NewRGBA(image.Rect(0, 0, 64, 48)), 80)
+	if b := next().Bounds(); b != image.Rect(0, 0, 64, 48) {
+		t.Errorf("second frame is %v, want the newly published 64x48 one", b)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// themes are named sets of pixel-classification thresholds for Bookmap's
+// color themes, selected with Config.Theme. A theme is applied on top of the
+// built-in defaults and under the config file and environment, so any field
+// can still be tuned individually.
+var themes = map[string]func(*Config){
+	// the built-in defaults: bright red lines and white price bubbles on
+	// Bookmap's standard dark background
+	"dark": func(*Config) {},
+
+	// light background: the bubbles are only a little brighter than the
+	// chart, and the red lines are drawn darker
+	"light": func(cfg *Config) {
+		cfg.RedMinR, cfg.RedMaxG, cfg.RedMaxB = 150, 90, 90
+		cfg.BubbleBrightThreshold = 735 // near-white only; the chart itself is ~690
+	},
+
+	// dimmed or low-contrast dark themes: classify by hue so a dull red line
+	// still matches, and accept greyer bubbles
+	"low-contrast": func(cfg *Config) {
+		cfg.ColorSpace = colorSpaceHSV
+		cfg.RedMinSat, cfg.RedMinVal = 0.35, 0.25
+		cfg.BubbleBrightThreshold = 480
+	},
+}
+
+// themeNames lists the built-in themes, sorted, for error messages.
+func themeNames() string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// applyTheme applies the named theme's thresholds to cfg. An empty name
+// leaves cfg alone.
+func (cfg *Config) applyTheme(name string) error {
+	if name == "" {
+		return nil
+	}
+	apply, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q (want one of %s)", name, themeNames())
+	}
+	apply(cfg)
+	return nil
+}
+
+// defaultSensitivity leaves the thresholds as they are.
+const defaultSensitivity = 0.5
+
+// sensitivityScale is what Config.Sensitivity multiplies the detection
+// thresholds by: 2^(1-2s), so 0 (strict) doubles them, 0.5 keeps them and 1
+// (lenient) halves them, each step of 0.25 a factor of √2.
+func sensitivityScale(s float64) float64 {
+	return math.Exp2(1 - 2*s)
+}
+
+// applySensitivity scales the pixel-count thresholds by sensitivityScale:
+// MinRedRunLength, MinRedPixelsPerRow (and MinRedPixelsPerRowFraction when
+// set), MinRedPixelsPerCol and BubbleMinBrightPixels. Like a theme it is
+// applied under the config file and environment, so a threshold set there is
+// taken as given.
+func (cfg *Config) applySensitivity(s float64) {
+	k := sensitivityScale(s)
+	scale := func(v int) int { return int(math.Round(float64(v) * k)) }
+	cfg.MinRedRunLength = scale(cfg.MinRedRunLength)
+	cfg.MinRedPixelsPerRow = scale(cfg.MinRedPixelsPerRow)
+	cfg.MinRedPixelsPerRowFraction = min(cfg.MinRedPixelsPerRowFraction*k, 1)
+	cfg.MinRedPixelsPerCol = scale(cfg.MinRedPixelsPerCol)
+	cfg.BubbleMinBrightPixels = scale(cfg.BubbleMinBrightPixels)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse --short HEAD)"
+//
+// When they are left empty the values come from the module's build info.
+var (
+	version string
+	commit  string
+)
+
+// buildVersion describes the running binary.
+type buildVersion struct {
+	Version string
+	Commit  string // "+dirty" is appended for builds from a modified tree
+	Go      string
+}
+
+func readBuildVersion() buildVersion {
+	v := buildVersion{Version: version, Commit: commit, Go: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v.withDefaults()
+	}
+	if v.Version == "" && info.Main.Version != "(devel)" {
+		v.Version = info.Main.Version
+	}
+	if v.Commit == "" {
+		var dirty bool
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v.Commit = s.Value
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if len(v.Commit) > 12 {
+			v.Commit = v.Commit[:12]
+		}
+		if dirty && v.Commit != "" {
+			v.Commit += "+dirty"
+		}
+	}
+	return v.withDefaults()
+}
+
+func (v buildVersion) withDefaults() buildVersion {
+	if v.Version == "" {
+		v.Version = "dev"
+	}
+	if v.Commit == "" {
+		v.Commit = "unknown"
+	}
+	return v
+}
+
+func (v buildVersion) String() string {
+	return fmt.Sprintf("bookmap_watcher %s (commit %s, %s)", v.Version, v.Commit, v.Go)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// alertWebhookTimeout bounds a single webhook delivery.
+const alertWebhookTimeout = 3 * time.Second
+
+// alertWebhookPayload is the JSON body POSTed by WebhookNotifier.
+type alertWebhookPayload struct {
+	Kind    string    `json:"kind"`
+	Display int       `json:"display"`
+	LineY   int       `json:"lineY"`
+	Color   string    `json:"color"`
+	Price   *float64  `json:"price"` // null when the AI step produced no price
+	Time    time.Time `json:"time"`
+
+	Escalation int  `json:"escalation,omitempty"` // AlertEscalation level, bubble alerts only
+	PrevLineY  *int `json:"prevLineY,omitempty"`  // line-moved alerts only
+
+	Alerts []alertWebhookPayload `json:"alerts,omitempty"` // summary alerts: the batched alerts
+}
+
+// WebhookNotifier POSTs each alert to URL as JSON.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	return sendWebhook(ctx, n.URL, webhookPayload(ev))
+}
+
+func webhookPayload(ev AlertEvent) alertWebhookPayload {
+	payload := alertWebhookPayload{Kind: ev.Kind, Display: ev.Display, LineY: ev.LineY, Color: ev.Color, Time: ev.Time, Escalation: ev.Escalation}
+	if !math.IsNaN(ev.Price) {
+		payload.Price = &ev.Price
+	}
+	if ev.Kind == alertLineMoved {
+		payload.PrevLineY = &ev.PrevLineY
+	}
+	for _, b := range ev.Batch {
+		payload.Alerts = append(payload.Alerts, webhookPayload(b))
+	}
+	return payload
+}
+
+func sendWebhook(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, alertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// findWindowScript prints "x,y,w,h" of the first visible window whose title
+// contains argv 1, or nothing if there is none.
+const findWindowScript = `on run argv
+	set needle to item 1 of argv
+	tell application "System Events"
+		repeat with p in (every process whose visible is true)
+			repeat with w in (every window of p)
+				if name of w contains needle then
+					set {x, y} to position of w
+					set {ww, hh} to size of w
+					return (x as text) & "," & (y as text) & "," & (ww as text) & "," & (hh as text)
+				end if
+			end repeat
+		end repeat
+	end tell
+	return ""
+end run`
+
+// findWindowBounds returns the screen rectangle of the first window whose
+// title contains title. It asks System Events via osascript, which needs the
+// Accessibility permission.
+func findWindowBounds(title string) (image.Rectangle, error) {
+	out, err := exec.Command("osascript", "-e", findWindowScript, title).Output()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("window lookup failed: %w", err)
+	}
+
+	s := strings.TrimSpace(string(out))
+	if s == "" {
+		return image.Rectangle{}, fmt.Errorf("no window titled %q", title)
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("unexpected window lookup output %q", s)
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("unexpected window lookup output %q", s)
+		}
+		v[i] = n
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package main
+
+import "image"
+
+// findWindowBounds is only implemented on macOS; elsewhere window capture
+// falls back to the full display.
+func findWindowBounds(title string) (image.Rectangle, error) {
+	return image.Rectangle{}, errString("window lookup is only supported on macOS")
+}